@@ -1,16 +1,82 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/joho/godotenv"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
 	"github.com/sashakosti/Go_Bot_Svintus/internal/telegram"
 )
 
 func main() {
-	bot, err := telegram.NewBot()
+	recalc := flag.Bool("recalc", false, "check every chat's player scores against stored game results (each game under the scoring it was recorded with) and exit")
+	fix := flag.Bool("fix", false, "with -recalc: fix the discrepancies found")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *recalc {
+		if err := runRecalc(ctx, *fix); err != nil {
+			log.Fatalf("recalc failed: %v", err)
+		}
+		return
+	}
+
+	bot, err := telegram.NewBot(ctx)
 	if err != nil {
 		log.Fatalf("failed to create bot: %v", err)
 	}
+	defer bot.Close()
+
+	bot.Start(ctx)
+	log.Println("Bot stopped")
+}
+
+// runRecalc сверяет очки игроков всех чатов с результатами игр и печатает расхождения.
+// Очки каждой игры считаются по стратегии, с которой она записана, как в /recalc.
+// Если fix, расхождения исправляются (по одной транзакции на чат).
+func runRecalc(ctx context.Context, fix bool) error {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, using system variables")
+	}
 
-	bot.Start()
+	store, err := telegram.OpenStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	svc := service.New(store, service.Config{})
+	chats, err := store.ListChats(ctx)
+	if err != nil {
+		return err
+	}
+
+	inconsistent := 0
+	for _, chatID := range chats {
+		report, err := svc.RecalcScores(ctx, chatID, fix)
+		if err != nil {
+			return fmt.Errorf("chat %d: %w", chatID, err)
+		}
+		if report.Consistent() {
+			continue
+		}
+		inconsistent++
+		fmt.Printf("chat %d: %d games, %d results with wrong points\n", chatID, report.Games, report.WrongResults)
+		for _, d := range report.Discrepancies {
+			fmt.Printf("  %s (%d): %d -> %d\n", d.Player.DisplayName, d.Player.TGID, d.Stored, d.Expected)
+		}
+		if report.Fixed {
+			fmt.Println("  fixed")
+		}
+	}
+	fmt.Printf("checked %d chats, %d with discrepancies\n", len(chats), inconsistent)
+	return nil
 }
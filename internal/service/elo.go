@@ -0,0 +1,45 @@
+package service
+
+import "math"
+
+const (
+	// InitialRating - рейтинг Эло нового игрока.
+	InitialRating = 1500.0
+	// eloK - максимальное изменение рейтинга за одну игру.
+	eloK = 32.0
+)
+
+// CalculateElo рассчитывает новые рейтинги после многопользовательской игры.
+// Игра раскладывается на попарные встречи: каждый игрок "выигрывает" у тех, кто
+// занял место ниже, и "проигрывает" тем, кто выше. Изменение рейтинга делится на
+// число соперников, чтобы игра на шестерых не весила больше, чем дуэль.
+// places[i] - место игрока с рейтингом ratings[i].
+func CalculateElo(ratings []float64, places []int) []float64 {
+	n := len(ratings)
+	updated := make([]float64, n)
+	copy(updated, ratings)
+	if n < 2 {
+		return updated
+	}
+
+	k := eloK / float64(n-1)
+	for i := 0; i < n; i++ {
+		var delta float64
+		for j := 0; j < n; j++ {
+			if i == j {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+			var actual float64
+			switch {
+			case places[i] < places[j]:
+				actual = 1
+			case places[i] == places[j]:
+				actual = 0.5
+			}
+			delta += actual - expected
+		}
+		updated[i] = ratings[i] + k*delta
+	}
+	return updated
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalculateElo_Duel(t *testing.T) {
+	got := CalculateElo([]float64{1500, 1500}, []int{1, 2})
+	if math.Abs(got[0]-1516) > 1e-9 || math.Abs(got[1]-1484) > 1e-9 {
+		t.Errorf("ожидалось 1516 и 1484, получено %v", got)
+	}
+}
+
+func TestCalculateElo_Multiplayer(t *testing.T) {
+	ratings := []float64{1500, 1600, 1400, 1500}
+	places := []int{1, 2, 3, 4}
+	got := CalculateElo(ratings, places)
+
+	var before, after float64
+	for i := range ratings {
+		before += ratings[i]
+		after += got[i]
+	}
+	if math.Abs(before-after) > 1e-9 {
+		t.Errorf("сумма рейтингов должна сохраняться: было %.2f, стало %.2f", before, after)
+	}
+	if got[0] <= ratings[0] {
+		t.Errorf("победитель должен поднять рейтинг: %.2f -> %.2f", ratings[0], got[0])
+	}
+	if got[3] >= ratings[3] {
+		t.Errorf("последний должен потерять рейтинг: %.2f -> %.2f", ratings[3], got[3])
+	}
+	// Максимальное изменение не больше K
+	for i := range ratings {
+		if math.Abs(got[i]-ratings[i]) > eloK {
+			t.Errorf("игрок %d: изменение %.2f больше K", i, got[i]-ratings[i])
+		}
+	}
+}
+
+func TestCalculateElo_Tie(t *testing.T) {
+	got := CalculateElo([]float64{1500, 1500}, []int{1, 1})
+	if got[0] != 1500 || got[1] != 1500 {
+		t.Errorf("ничья равных игроков не должна менять рейтинг, получено %v", got)
+	}
+}
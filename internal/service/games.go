@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+var ErrGameNotFound = errors.New("game not found")
+var ErrNotLastGame = errors.New("only the last game of the chat can be undone")
+var ErrGameArchived = errors.New("game belongs to an already finished season")
+var ErrUndoExpired = errors.New("undo window has expired")
+var ErrNotEditing = errors.New("recording session is not editing a game")
+var ErrNoPlayers = errors.New("game has no players")
+
+// DefaultUndoWindow - сколько времени после записи игру можно отменить кнопкой под результатами.
+const DefaultUndoWindow = 5 * time.Minute
+
+// ListGames возвращает страницу игр чата, начиная с последних, и общее число игр.
+func (g *GameService) ListGames(ctx context.Context, chatID int64, offset, limit int) ([]storage.Game, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	return g.storage.ListGames(ctx, chatID, offset, limit)
+}
+
+// UndoLastGame отменяет последнюю игру чата: удаляет ее результаты и вычитает начисленные очки.
+func (g *GameService) UndoLastGame(ctx context.Context, chatID int64, actorTGID int64) (*storage.Game, error) {
+	game, err := g.storage.GetLastGame(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if game == nil {
+		return nil, ErrGameNotFound
+	}
+	return game, g.deleteGame(ctx, game, actorTGID)
+}
+
+// UndoGame отменяет игру по кнопке под результатами. Это возможно, только пока игра
+// последняя в чате и с момента ее записи прошло не больше окна отмены.
+func (g *GameService) UndoGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) (*storage.Game, error) {
+	game, err := g.storage.GetLastGame(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if game == nil {
+		return nil, ErrGameNotFound
+	}
+	if game.ID != gameID {
+		return nil, ErrNotLastGame
+	}
+	if time.Since(game.CreatedAt) > g.undoWindow {
+		return nil, ErrUndoExpired
+	}
+	return game, g.deleteGame(ctx, game, actorTGID)
+}
+
+// CanUndoGame проверяет, может ли пользователь userID отменить игру кнопкой под результатами:
+// это разрешено администраторам чата и тому, кто записал игру.
+func (g *GameService) CanUndoGame(ctx context.Context, chatID int64, gameID int, userID int64, isAdmin func() bool) (bool, error) {
+	game, err := g.storage.GetGame(ctx, chatID, gameID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get game %d: %w", gameID, err)
+	}
+	if game != nil && game.RecordedBy != 0 && game.RecordedBy == userID {
+		return true, nil
+	}
+	return isAdmin(), nil
+}
+
+// deleteGame удаляет игру, если ее очки еще не ушли в архив завершенного сезона.
+func (g *GameService) deleteGame(ctx context.Context, game *storage.Game, actorTGID int64) error {
+	if err := g.checkNotArchived(ctx, game); err != nil {
+		return err
+	}
+
+	if err := g.storage.DeleteGame(ctx, game.ChatID, game.ID, actorTGID); err != nil {
+		return fmt.Errorf("failed to delete game %d: %w", game.ID, err)
+	}
+	return nil
+}
+
+// checkNotArchived возвращает ErrGameArchived, если игра сыграна до конца уже завершенного сезона:
+// очки за нее уже заархивированы и обнулены, менять их нельзя.
+func (g *GameService) checkNotArchived(ctx context.Context, game *storage.Game) error {
+	seasons, err := g.storage.ListSeasons(ctx, game.ChatID)
+	if err != nil {
+		return err
+	}
+	for _, season := range seasons {
+		if season.EndedAt != nil && season.EndedAt.After(game.CreatedAt) {
+			return ErrGameArchived
+		}
+	}
+	return nil
+}
+
+// StartGameEdit открывает сессию редактирования игры, заполненную сохраненным порядком игроков.
+// Владельцем сессии становится editorTGID.
+func (g *GameService) StartGameEdit(ctx context.Context, chatID int64, gameID int, messageID int64, editorTGID int64) (*storage.Game, error) {
+	game, err := g.storage.GetGame(ctx, chatID, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if game == nil {
+		return nil, ErrGameNotFound
+	}
+	if err := g.checkNotArchived(ctx, game); err != nil {
+		return nil, err
+	}
+
+	players := EditSessionPlayers(game.Results)
+	if err := g.storage.CreateEditSession(ctx, chatID, messageID, game.ID, editorTGID, players); err != nil {
+		return nil, fmt.Errorf("failed to create edit session: %w", err)
+	}
+	return game, nil
+}
+
+// EditSessionPlayers переводит результаты игры в игроков сессии редактирования.
+// Выбывшие в сессии не занимают места.
+func EditSessionPlayers(results []storage.GameResult) []storage.SessionPlayer {
+	players := make([]storage.SessionPlayer, len(results))
+	for i, r := range results {
+		players[i] = storage.SessionPlayer{Player: r.Player, Place: r.Place, DNF: r.DNF}
+		if r.DNF {
+			players[i].Place = 0
+		}
+	}
+	return players
+}
+
+// FinishGameEdit сохраняет новый порядок игроков из сессии редактирования: очки за игру
+// пересчитываются по стратегии, с которой она была записана, а итоговые очки игроков
+// корректируются на разницу. Прежние места сохраняются как версия игры.
+func (g *GameService) FinishGameEdit(ctx context.Context, chatID int64, messageID int64, editorTGID int64) (*storage.Game, error) {
+	session, err := g.GetRecordingSession(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if session.EditGameID == 0 {
+		return nil, ErrNotEditing
+	}
+
+	players, err := g.storage.GetSessionPlayers(ctx, chatID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session players: %w", err)
+	}
+	if len(players) == 0 {
+		return nil, ErrNoPlayers
+	}
+	if err := g.checkPlayerCount(ctx, chatID, len(players)); err != nil {
+		return nil, err
+	}
+
+	game, err := g.storage.GetGame(ctx, chatID, session.EditGameID)
+	if err != nil {
+		return nil, err
+	}
+	if game == nil {
+		return nil, ErrGameNotFound
+	}
+	if err := g.checkNotArchived(ctx, game); err != nil {
+		return nil, err
+	}
+
+	strategy, err := ParseScoring(game.Scoring)
+	if err != nil {
+		return nil, err
+	}
+	results := g.CalculatePoints(strategy, players)
+	for i := range results {
+		results[i].GameID = game.ID
+	}
+
+	// Результаты, сессия и пересчитанные рейтинги сохраняются атомарно: либо всё, либо ничего
+	err = g.storage.WithTx(ctx, func(tx storage.Tx) error {
+		if err := tx.UpdateGameResults(ctx, chatID, game.ID, results, editorTGID); err != nil {
+			return fmt.Errorf("failed to update game results: %w", err)
+		}
+		if err := tx.DeleteRecordingSession(ctx, chatID, messageID); err != nil {
+			return fmt.Errorf("failed to delete edit session: %w", err)
+		}
+		if err := g.replayRatings(ctx, tx, chatID); err != nil {
+			return fmt.Errorf("failed to replay ratings: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	game.Results = results
+	return game, nil
+}
+
+// GetGameVersions возвращает игру с текущими результатами и ее предыдущие версии.
+func (g *GameService) GetGameVersions(ctx context.Context, chatID int64, gameID int) (*storage.Game, []storage.GameVersion, error) {
+	game, err := g.storage.GetGame(ctx, chatID, gameID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if game == nil {
+		return nil, nil, ErrGameNotFound
+	}
+	versions, err := g.storage.GetGameVersions(ctx, gameID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return game, versions, nil
+}
+
+// replayRatings заново рассчитывает рейтинги Эло чата по всем играм в порядке их записи.
+// Нужен, когда меняются результаты уже не последней игры.
+func (g *GameService) replayRatings(ctx context.Context, tx storage.Tx, chatID int64) error {
+	results, err := tx.LoadAllGames(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[int64]float64)
+	var history []storage.RatingChange
+	for start := 0; start < len(results); {
+		end := start
+		for end < len(results) && results[end].GameID == results[start].GameID {
+			end++
+		}
+		game := results[start:end]
+
+		ratings := make([]float64, len(game))
+		places := make([]int, len(game))
+		for i, r := range game {
+			rating, ok := current[r.Player.TGID]
+			if !ok {
+				rating = InitialRating
+			}
+			ratings[i] = rating
+			places[i] = r.Place
+		}
+		updated := CalculateElo(ratings, places)
+		for i, r := range game {
+			current[r.Player.TGID] = updated[i]
+			history = append(history, storage.RatingChange{
+				GameID: r.GameID,
+				TGID:   r.Player.TGID,
+				Before: ratings[i],
+				After:  updated[i],
+				Date:   r.Date,
+			})
+		}
+		start = end
+	}
+
+	return tx.ReplaceRatings(ctx, chatID, history, InitialRating)
+}
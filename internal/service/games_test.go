@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+func TestGameService_UndoGame(t *testing.T) {
+	t.Run("последняя игра в окне отмены", func(t *testing.T) {
+		mockStore := &mockStorage{lastGame: &storage.Game{ID: 5, ChatID: 1, CreatedAt: time.Now()}}
+		gameService := New(mockStore, Config{})
+
+		if _, err := gameService.UndoGame(context.Background(), 1, 5, 7); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if mockStore.deletedGameID != 5 {
+			t.Errorf("игра не удалена")
+		}
+	})
+
+	t.Run("не последняя игра", func(t *testing.T) {
+		mockStore := &mockStorage{lastGame: &storage.Game{ID: 6, ChatID: 1, CreatedAt: time.Now()}}
+		gameService := New(mockStore, Config{})
+
+		if _, err := gameService.UndoGame(context.Background(), 1, 5, 7); !errors.Is(err, ErrNotLastGame) {
+			t.Errorf("ожидалась ошибка ErrNotLastGame, получено: %v", err)
+		}
+	})
+
+	t.Run("окно отмены истекло", func(t *testing.T) {
+		mockStore := &mockStorage{lastGame: &storage.Game{ID: 5, ChatID: 1, CreatedAt: time.Now().Add(-time.Hour)}}
+		gameService := New(mockStore, Config{UndoWindow: time.Minute})
+
+		if _, err := gameService.UndoGame(context.Background(), 1, 5, 7); !errors.Is(err, ErrUndoExpired) {
+			t.Errorf("ожидалась ошибка ErrUndoExpired, получено: %v", err)
+		}
+		if mockStore.deletedGameID != 0 {
+			t.Errorf("игра не должна удаляться")
+		}
+
+		// Командой /undo старую игру отменить можно
+		if _, err := gameService.UndoLastGame(context.Background(), 1, 7); err != nil {
+			t.Errorf("неожиданная ошибка: %v", err)
+		}
+	})
+}
+
+func TestGameService_CanUndoGame(t *testing.T) {
+	mockStore := &mockStorage{lastGame: &storage.Game{ID: 5, ChatID: 1, RecordedBy: 7}}
+	gameService := New(mockStore, Config{})
+	admin := func() bool { return true }
+	notAdmin := func() bool { return false }
+
+	tests := []struct {
+		name    string
+		gameID  int
+		userID  int64
+		isAdmin func() bool
+		want    bool
+	}{
+		{"записавший игру", 5, 7, notAdmin, true},
+		{"администратор", 5, 3, admin, true},
+		{"посторонний", 5, 3, notAdmin, false},
+		{"записавший другую игру", 6, 7, notAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gameService.CanUndoGame(context.Background(), 1, tt.gameID, tt.userID, tt.isAdmin)
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ожидалось %v, получено %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGameService_UndoLastGame_ArchivedSeason(t *testing.T) {
+	ended := time.Now()
+	mockStore := &mockStorage{
+		lastGame: &storage.Game{ID: 5, ChatID: 1, CreatedAt: ended.Add(-time.Hour)},
+		seasons:  []storage.Season{{ID: 1, Name: "2025", EndedAt: &ended}},
+	}
+	gameService := New(mockStore, Config{})
+
+	if _, err := gameService.UndoLastGame(context.Background(), 1, 7); !errors.Is(err, ErrGameArchived) {
+		t.Errorf("ожидалась ошибка ErrGameArchived, получено: %v", err)
+	}
+}
+
+func TestGameService_UndoLastGame_NoGames(t *testing.T) {
+	gameService := New(&mockStorage{}, Config{})
+
+	if _, err := gameService.UndoLastGame(context.Background(), 1, 7); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("ожидалась ошибка ErrGameNotFound, получено: %v", err)
+	}
+}
+
+func TestGameService_FinishGameEdit(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	carol := storage.Player{TGID: 3, DisplayName: "Carol"}
+	date := time.Now().Add(-time.Hour)
+	mockStore := &mockStorage{
+		lastGame: &storage.Game{ID: 5, ChatID: 1, Scoring: "f1", CreatedAt: date, Results: []storage.GameResult{
+			{GameID: 5, Player: alice, Place: 1, Points: 25},
+			{GameID: 5, Player: bob, Place: 2, Points: 18},
+		}},
+		// Новый порядок: Bob первый, добавлена Carol
+		sessionPlayers: inOrder(bob, alice, carol),
+		games: []storage.GameResult{
+			{GameID: 5, Player: bob, Place: 1, Date: date},
+			{GameID: 5, Player: alice, Place: 2, Date: date},
+			{GameID: 5, Player: carol, Place: 3, Date: date},
+		},
+		playersExist: true,
+	}
+	gameService := New(mockStore, Config{})
+
+	if _, err := gameService.FinishGameEdit(context.Background(), 1, 100, 7); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("без сессии ожидалась ошибка ErrSessionNotFound, получено: %v", err)
+	}
+
+	if _, err := gameService.StartGameEdit(context.Background(), 1, 5, 100, 7); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	game, err := gameService.FinishGameEdit(context.Background(), 1, 100, 7)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+
+	// Очки пересчитаны по стратегии, с которой игра была записана (Формула-1)
+	want := []struct {
+		id     int64
+		points int
+	}{{2, 25}, {1, 18}, {3, 15}}
+	if len(mockStore.updatedResults) != len(want) {
+		t.Fatalf("ожидалось %d результатов, получено %d", len(want), len(mockStore.updatedResults))
+	}
+	for i, w := range want {
+		r := mockStore.updatedResults[i]
+		if r.Player.TGID != w.id || r.Points != w.points || r.Place != i+1 || r.GameID != 5 {
+			t.Errorf("результат %d: %+v", i, r)
+		}
+	}
+	if len(game.Results) != 3 {
+		t.Errorf("игра должна вернуться с новыми результатами")
+	}
+	if len(mockStore.replacedRatings) != 3 {
+		t.Errorf("рейтинги должны быть пересчитаны, получено %d изменений", len(mockStore.replacedRatings))
+	}
+}
+
+func TestGameService_FinishGameEdit_Atomic(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	mockStore := &mockStorage{
+		lastGame: &storage.Game{ID: 5, ChatID: 1, Scoring: "linear", CreatedAt: time.Now(), Results: []storage.GameResult{
+			{GameID: 5, Player: alice, Place: 1, Points: 1},
+			{GameID: 5, Player: bob, Place: 2, Points: 0},
+		}},
+		session:           &storage.RecordingSession{ChatID: 1, MessageID: 100, EditGameID: 5},
+		sessionPlayers:    inOrder(bob, alice),
+		replaceRatingsErr: errors.New("db is down"),
+	}
+	gameService := New(mockStore, Config{})
+
+	if _, err := gameService.FinishGameEdit(context.Background(), 1, 100, 7); err == nil {
+		t.Fatal("ошибка пересчета рейтингов должна вернуться")
+	}
+	if mockStore.updatedResults != nil {
+		t.Errorf("результаты не должны сохраняться без пересчета рейтингов: %+v", mockStore.updatedResults)
+	}
+	if mockStore.session == nil {
+		t.Error("сессия редактирования должна остаться, чтобы повторить сохранение")
+	}
+	if mockStore.commits != 0 {
+		t.Errorf("транзакция не должна фиксироваться, получено %d", mockStore.commits)
+	}
+}
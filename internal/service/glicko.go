@@ -0,0 +1,244 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+const (
+	glickoInitialRating     = 1500.0
+	glickoInitialDeviation  = 350.0
+	glickoInitialVolatility = 0.06
+	// glickoTau ограничивает изменение волатильности между периодами.
+	glickoTau = 0.5
+	// glickoScale - коэффициент перевода между шкалами Glicko и Glicko-2.
+	glickoScale = 173.7178
+	// glickoEpsilon - точность итеративного расчета волатильности.
+	glickoEpsilon = 0.000001
+
+	// ProvisionalDeviation - при отклонении выше этого рейтинг считается предварительным.
+	ProvisionalDeviation = 110.0
+	// DefaultRatingPeriod - длина рейтингового периода по умолчанию.
+	DefaultRatingPeriod = 7 * 24 * time.Hour
+)
+
+// GlickoRating - рейтинг игрока по системе Glicko-2.
+type GlickoRating struct {
+	Player      storage.Player
+	Rating      float64
+	Deviation   float64
+	Volatility  float64
+	Games       int
+	Provisional bool // рейтинг ещё ненадёжен: мало игр или игрок давно не играл
+}
+
+// glickoState - состояние игрока во внутренней шкале Glicko-2.
+type glickoState struct {
+	mu, phi, sigma float64
+}
+
+// glickoOutcome - результат встречи с одним соперником за период.
+type glickoOutcome struct {
+	mu, phi float64 // рейтинг соперника на начало периода
+	score   float64 // 1 - победа, 0.5 - ничья, 0 - поражение
+}
+
+func newGlickoState(rating, deviation, volatility float64) glickoState {
+	return glickoState{
+		mu:    (rating - glickoInitialRating) / glickoScale,
+		phi:   deviation / glickoScale,
+		sigma: volatility,
+	}
+}
+
+func (s glickoState) rating() float64    { return s.mu*glickoScale + glickoInitialRating }
+func (s glickoState) deviation() float64 { return s.phi * glickoScale }
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu, muj, phij float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phij)*(mu-muj)))
+}
+
+// update рассчитывает состояние игрока после рейтингового периода.
+// Если игрок в периоде не играл, растет только его отклонение.
+func (s glickoState) update(outcomes []glickoOutcome) glickoState {
+	if len(outcomes) == 0 {
+		return s.idle(1)
+	}
+
+	var vInv, deltaSum float64
+	for _, o := range outcomes {
+		g := glickoG(o.phi)
+		e := glickoE(s.mu, o.mu, o.phi)
+		vInv += g * g * e * (1 - e)
+		deltaSum += g * (o.score - e)
+	}
+	v := 1 / vInv
+	delta := v * deltaSum
+
+	sigma := s.newVolatility(delta, v)
+	phiStar := math.Sqrt(s.phi*s.phi + sigma*sigma)
+	phi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	return glickoState{
+		mu:    s.mu + phi*phi*deltaSum,
+		phi:   phi,
+		sigma: sigma,
+	}
+}
+
+// idle возвращает состояние игрока после n периодов без игр. Волатильность без игр не меняется,
+// поэтому n таких периодов дают φ' = √(φ² + nσ²) за один шаг.
+func (s glickoState) idle(n int64) glickoState {
+	return glickoState{
+		mu:    s.mu,
+		phi:   math.Sqrt(s.phi*s.phi + float64(n)*s.sigma*s.sigma),
+		sigma: s.sigma,
+	}
+}
+
+// newVolatility находит новую волатильность методом Иллинойса (шаг 5 алгоритма Glicko-2).
+func (s glickoState) newVolatility(delta, v float64) float64 {
+	a := math.Log(s.sigma * s.sigma)
+	phi2 := s.phi * s.phi
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi2-v-ex)/(2*(phi2+v+ex)*(phi2+v+ex)) - (x-a)/(glickoTau*glickoTau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi2+v {
+		B = math.Log(delta*delta - phi2 - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k++
+		}
+		B = a - k*glickoTau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// CalculateGlicko рассчитывает рейтинги Glicko-2 по результатам игр чата.
+// Игры группируются в рейтинговые периоды длиной period, начиная с первой игры и до now
+// (текущий незавершенный период тоже учитывается). Каждая игра раскладывается на попарные
+// встречи участников. Отклонение игроков, пропустивших период, растет; подряд идущие периоды
+// без игр считаются за один шаг, поэтому длинные перерывы и короткий period не замедляют расчет.
+// results должны быть отсортированы по игре, как их возвращает LoadAllGames.
+func CalculateGlicko(results []storage.GameResult, now time.Time, period time.Duration) []GlickoRating {
+	if len(results) == 0 {
+		return nil
+	}
+	if period <= 0 {
+		period = DefaultRatingPeriod
+	}
+
+	// Собираем игры: результаты одной игры идут подряд
+	type game struct {
+		date    time.Time
+		results []storage.GameResult
+	}
+	var games []game
+	for _, r := range results {
+		if len(games) == 0 || games[len(games)-1].results[0].GameID != r.GameID {
+			games = append(games, game{date: r.Date})
+		}
+		last := &games[len(games)-1]
+		last.results = append(last.results, r)
+	}
+	sort.SliceStable(games, func(i, j int) bool { return games[i].date.Before(games[j].date) })
+
+	states := make(map[int64]glickoState)
+	ratings := make(map[int64]*GlickoRating)
+	var order []int64
+
+	start := games[0].date
+	next := 0
+	for periodStart := start; !periodStart.After(now) || next < len(games); periodStart = periodStart.Add(period) {
+		periodEnd := periodStart.Add(period)
+
+		// Периоды без игр - до следующей игры или до конца текущего периода - пропускаем разом
+		if next == len(games) || !games[next].date.Before(periodEnd) {
+			var idle int64
+			if next < len(games) {
+				idle = int64(games[next].date.Sub(periodStart) / period)
+			} else {
+				idle = int64(now.Sub(periodStart)/period) + 1
+			}
+			for id, st := range states {
+				states[id] = st.idle(idle)
+			}
+			periodStart = periodStart.Add(time.Duration(idle-1) * period)
+			continue
+		}
+
+		outcomes := make(map[int64][]glickoOutcome)
+
+		for ; next < len(games) && games[next].date.Before(periodEnd); next++ {
+			g := games[next]
+			for _, r := range g.results {
+				id := r.Player.TGID
+				if _, ok := states[id]; !ok {
+					states[id] = newGlickoState(glickoInitialRating, glickoInitialDeviation, glickoInitialVolatility)
+					ratings[id] = &GlickoRating{Player: r.Player}
+					order = append(order, id)
+				}
+				ratings[id].Games++
+			}
+			for _, r := range g.results {
+				for _, opp := range g.results {
+					if opp.Player.TGID == r.Player.TGID {
+						continue
+					}
+					var score float64
+					switch {
+					case r.Place < opp.Place:
+						score = 1
+					case r.Place == opp.Place:
+						score = 0.5
+					}
+					o := states[opp.Player.TGID]
+					outcomes[r.Player.TGID] = append(outcomes[r.Player.TGID], glickoOutcome{mu: o.mu, phi: o.phi, score: score})
+				}
+			}
+		}
+
+		// Все обновления периода считаются от рейтингов на его начало
+		updated := make(map[int64]glickoState, len(states))
+		for id, st := range states {
+			updated[id] = st.update(outcomes[id])
+		}
+		states = updated
+	}
+
+	list := make([]GlickoRating, 0, len(order))
+	for _, id := range order {
+		st := states[id]
+		r := ratings[id]
+		r.Rating = st.rating()
+		r.Deviation = math.Min(st.deviation(), glickoInitialDeviation)
+		r.Volatility = st.sigma
+		r.Provisional = r.Deviation > ProvisionalDeviation
+		list = append(list, *r)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Rating > list[j].Rating })
+	return list
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+// Пример из статьи Glickman "Example of the Glicko-2 system".
+func TestGlickoState_Update_PaperExample(t *testing.T) {
+	player := newGlickoState(1500, 200, 0.06)
+	outcomes := []glickoOutcome{
+		{mu: newGlickoState(1400, 30, 0).mu, phi: newGlickoState(1400, 30, 0).phi, score: 1},
+		{mu: newGlickoState(1550, 100, 0).mu, phi: newGlickoState(1550, 100, 0).phi, score: 0},
+		{mu: newGlickoState(1700, 300, 0).mu, phi: newGlickoState(1700, 300, 0).phi, score: 0},
+	}
+
+	got := player.update(outcomes)
+
+	if math.Abs(got.rating()-1464.06) > 0.01 {
+		t.Errorf("рейтинг: ожидалось 1464.06, получено %.2f", got.rating())
+	}
+	if math.Abs(got.deviation()-151.52) > 0.01 {
+		t.Errorf("отклонение: ожидалось 151.52, получено %.2f", got.deviation())
+	}
+	if math.Abs(got.sigma-0.05999) > 0.00001 {
+		t.Errorf("волатильность: ожидалось 0.05999, получено %.5f", got.sigma)
+	}
+}
+
+func TestGlickoState_Update_Inactive(t *testing.T) {
+	player := newGlickoState(1600, 50, 0.06)
+	got := player.update(nil)
+	if got.rating() != player.rating() {
+		t.Errorf("рейтинг не должен меняться без игр")
+	}
+	if got.deviation() <= player.deviation() {
+		t.Errorf("отклонение должно расти без игр: было %.2f, стало %.2f", player.deviation(), got.deviation())
+	}
+}
+
+func TestGlickoState_Idle(t *testing.T) {
+	player := newGlickoState(1600, 50, 0.06)
+	stepByStep := player
+	for i := 0; i < 5; i++ {
+		stepByStep = stepByStep.update(nil)
+	}
+	got := player.idle(5)
+	if math.Abs(got.deviation()-stepByStep.deviation()) > 1e-9 || got.rating() != player.rating() {
+		t.Errorf("5 периодов без игр за один шаг: ожидалось %.6f, получено %.6f", stepByStep.deviation(), got.deviation())
+	}
+}
+
+func TestCalculateGlicko_IdlePeriods(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	game := func(id int, date time.Time) []storage.GameResult {
+		return []storage.GameResult{
+			{GameID: id, Player: alice, Place: 1, Date: date},
+			{GameID: id, Player: bob, Place: 2, Date: date},
+		}
+	}
+	results := append(game(1, start), game(2, start.Add(3*DefaultRatingPeriod))...)
+	now := start.Add(10 * DefaultRatingPeriod)
+
+	// Пропуск пустых периодов не меняет результат по сравнению с расчетом по одному периоду
+	got := CalculateGlicko(results, now, DefaultRatingPeriod)
+	states := map[int64]glickoState{
+		1: newGlickoState(glickoInitialRating, glickoInitialDeviation, glickoInitialVolatility),
+		2: newGlickoState(glickoInitialRating, glickoInitialDeviation, glickoInitialVolatility),
+	}
+	for p := 0; p <= 10; p++ {
+		a, b := states[1], states[2]
+		if p == 0 || p == 3 {
+			states[1] = a.update([]glickoOutcome{{mu: b.mu, phi: b.phi, score: 1}})
+			states[2] = b.update([]glickoOutcome{{mu: a.mu, phi: a.phi, score: 0}})
+		} else {
+			states[1], states[2] = a.update(nil), b.update(nil)
+		}
+	}
+	for _, r := range got {
+		want := states[r.Player.TGID]
+		if math.Abs(r.Rating-want.rating()) > 1e-9 || math.Abs(r.Deviation-math.Min(want.deviation(), glickoInitialDeviation)) > 1e-9 {
+			t.Errorf("%s: ожидалось %.4f±%.4f, получено %.4f±%.4f", r.Player.DisplayName, want.rating(), want.deviation(), r.Rating, r.Deviation)
+		}
+	}
+
+	// Годы минутных периодов считаются мгновенно
+	done := make(chan struct{})
+	go func() {
+		CalculateGlicko(results, start.AddDate(5, 0, 0), time.Minute)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("расчет с короткими периодами не должен перебирать каждый пустой период")
+	}
+}
+
+func TestCalculateGlicko(t *testing.T) {
+	start := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	carol := storage.Player{TGID: 3, DisplayName: "Carol"}
+
+	var results []storage.GameResult
+	for i := 0; i < 10; i++ {
+		date := start.Add(time.Duration(i) * 24 * time.Hour)
+		results = append(results,
+			storage.GameResult{GameID: i + 1, Player: alice, Place: 1, Date: date},
+			storage.GameResult{GameID: i + 1, Player: bob, Place: 2, Date: date},
+		)
+	}
+	// Carol сыграла одну игру в самом начале
+	results = append(results,
+		storage.GameResult{GameID: 11, Player: carol, Place: 1, Date: start},
+		storage.GameResult{GameID: 11, Player: bob, Place: 2, Date: start},
+	)
+
+	now := start.Add(10 * 24 * time.Hour)
+	ratings := CalculateGlicko(results, now, DefaultRatingPeriod)
+	if len(ratings) != 3 {
+		t.Fatalf("ожидалось 3 игрока, получено %d", len(ratings))
+	}
+	if ratings[0].Player.TGID != alice.TGID {
+		t.Errorf("Alice должна быть первой, получено %s", ratings[0].Player.DisplayName)
+	}
+	byID := make(map[int64]GlickoRating)
+	for _, r := range ratings {
+		byID[r.Player.TGID] = r
+	}
+	if byID[bob.TGID].Games != 11 || byID[carol.TGID].Games != 1 {
+		t.Errorf("неверное число игр: Bob %d, Carol %d", byID[bob.TGID].Games, byID[carol.TGID].Games)
+	}
+	if !byID[carol.TGID].Provisional {
+		t.Errorf("рейтинг Carol после одной игры должен быть предварительным")
+	}
+	if byID[carol.TGID].Deviation <= byID[alice.TGID].Deviation {
+		t.Errorf("отклонение Carol должно быть больше, чем у Alice")
+	}
+
+	// Спустя год без игр отклонение у всех растет
+	later := CalculateGlicko(results, now.Add(365*24*time.Hour), DefaultRatingPeriod)
+	for _, r := range later {
+		if r.Deviation <= byID[r.Player.TGID].Deviation {
+			t.Errorf("%s: отклонение должно вырасти после перерыва", r.Player.DisplayName)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+var ErrInvalidGameConfig = errors.New("invalid game config")
+var ErrTooFewPlayers = errors.New("too few players")
+var ErrTooManyPlayers = errors.New("too many players")
+var ErrLineupOpen = errors.New("lineup is not declared yet")
+var ErrNotInLineup = errors.New("player is not in the lineup")
+var ErrLineupIncomplete = errors.New("not every player of the lineup has a place")
+var ErrLineupLocked = errors.New("lineup is locked")
+var ErrAlreadyPlaced = errors.New("player already has a place")
+var ErrNotRecording = errors.New("recording session is editing a game")
+
+// MaxPlayersLimit - больше игроков в одной игре не бывает ни при каких настройках чата.
+const MaxPlayersLimit = 10
+
+// DefaultGameConfig - настройки игры, пока чат не выбрал свои.
+var DefaultGameConfig = storage.GameConfig{MinPlayers: 2, MaxPlayers: 6, AutoPlaceLast: true}
+
+// GetGameConfig возвращает настройки игры чата или DefaultGameConfig, если чат их не менял.
+func (g *GameService) GetGameConfig(ctx context.Context, chatID int64) (storage.GameConfig, error) {
+	cfg, err := g.storage.GetChatGameConfig(ctx, chatID)
+	if err != nil {
+		return storage.GameConfig{}, err
+	}
+	if cfg == nil {
+		return DefaultGameConfig, nil
+	}
+	return *cfg, nil
+}
+
+// SetGameConfig сохраняет настройки игры чата. В игре должно быть от 2 до MaxPlayersLimit игроков.
+func (g *GameService) SetGameConfig(ctx context.Context, chatID int64, cfg storage.GameConfig) error {
+	if cfg.MinPlayers < 2 || cfg.MaxPlayers > MaxPlayersLimit || cfg.MinPlayers > cfg.MaxPlayers {
+		return fmt.Errorf("%w: players from %d to %d", ErrInvalidGameConfig, cfg.MinPlayers, cfg.MaxPlayers)
+	}
+	return g.storage.SetChatGameConfig(ctx, chatID, cfg)
+}
+
+// checkPlayerCount проверяет, что в игре из count игроков их не меньше и не больше, чем разрешает чат.
+func (g *GameService) checkPlayerCount(ctx context.Context, chatID int64, count int) error {
+	cfg, err := g.GetGameConfig(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get game config: %w", err)
+	}
+	if count < cfg.MinPlayers {
+		return fmt.Errorf("%w: %d of %d", ErrTooFewPlayers, count, cfg.MinPlayers)
+	}
+	if count > cfg.MaxPlayers {
+		return fmt.Errorf("%w: %d of %d", ErrTooManyPlayers, count, cfg.MaxPlayers)
+	}
+	return nil
+}
+
+// GetRecordingLineup возвращает объявленный состав игры сессии. У сессий редактирования состава нет.
+func (g *GameService) GetRecordingLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	return g.storage.GetSessionLineup(ctx, chatID, messageID)
+}
+
+// ToggleLineupPlayer добавляет игрока в состав игры или убирает из него и возвращает новый состав.
+// Больше игроков, чем разрешает чат, в состав не добавить, а подтвержденный состав не изменить.
+func (g *GameService) ToggleLineupPlayer(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.Player, error) {
+	if err := g.checkLineupOpen(ctx, chatID, messageID); err != nil {
+		return nil, err
+	}
+	lineup, err := g.storage.GetSessionLineup(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if containsPlayer(lineup, playerTgID) {
+		err = g.storage.RemovePlayerFromLineup(ctx, chatID, messageID, playerTgID)
+	} else {
+		cfg, cfgErr := g.GetGameConfig(ctx, chatID)
+		if cfgErr != nil {
+			return nil, fmt.Errorf("failed to get game config: %w", cfgErr)
+		}
+		if len(lineup) >= cfg.MaxPlayers {
+			return nil, fmt.Errorf("%w: %d of %d", ErrTooManyPlayers, len(lineup)+1, cfg.MaxPlayers)
+		}
+		err = g.storage.AddPlayerToLineup(ctx, chatID, messageID, playerTgID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.storage.GetSessionLineup(ctx, chatID, messageID)
+}
+
+// ConfirmLineup закрывает набор состава, после чего места выбираются только среди его игроков.
+// Уже подтвержденный состав повторно не подтверждается.
+func (g *GameService) ConfirmLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	if err := g.checkLineupOpen(ctx, chatID, messageID); err != nil {
+		return nil, err
+	}
+	lineup, err := g.storage.GetSessionLineup(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.checkPlayerCount(ctx, chatID, len(lineup)); err != nil {
+		return nil, err
+	}
+	if err := g.storage.SetLineupOpen(ctx, chatID, messageID, false); err != nil {
+		return nil, err
+	}
+	return lineup, nil
+}
+
+// ReopenLineup возвращает сессию к набору состава. Пока никому не выбрано место, состав можно менять.
+// У сессий редактирования игры состава нет, к нему не вернуться (ErrNotRecording).
+func (g *GameService) ReopenLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	session, err := g.storage.GetRecordingSession(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+	if session.EditGameID != 0 {
+		return nil, ErrNotRecording
+	}
+	players, err := g.storage.GetSessionPlayers(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(players) > 0 {
+		return nil, ErrLineupLocked
+	}
+	if err := g.storage.SetLineupOpen(ctx, chatID, messageID, true); err != nil {
+		return nil, err
+	}
+	return g.storage.GetSessionLineup(ctx, chatID, messageID)
+}
+
+// checkLineupOpen возвращает ErrLineupLocked, если состав сессии уже подтвержден: так устаревшая
+// или подделанная кнопка не изменит состав после перехода к выбору мест.
+func (g *GameService) checkLineupOpen(ctx context.Context, chatID int64, messageID int64) error {
+	session, err := g.storage.GetRecordingSession(ctx, chatID, messageID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	if !session.LineupOpen {
+		return ErrLineupLocked
+	}
+	return nil
+}
+
+// checkPlacement проверяет, что игроку можно выбрать место: состав игры уже объявлен, игрок в нем
+// и места у него еще нет (ErrAlreadyPlaced, например после нажатия устаревшей кнопки).
+// Без состава (редактирование игры) игроков не может стать больше, чем разрешает чат.
+// Возвращает состав сессии.
+func (g *GameService) checkPlacement(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.Player, error) {
+	session, err := g.storage.GetRecordingSession(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if session != nil && session.LineupOpen {
+		return nil, ErrLineupOpen
+	}
+
+	players, err := g.storage.GetSessionPlayers(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(players, func(sp storage.SessionPlayer) bool { return sp.Player.TGID == playerTgID }) {
+		return nil, ErrAlreadyPlaced
+	}
+
+	lineup, err := g.storage.GetSessionLineup(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(lineup) > 0 {
+		if !containsPlayer(lineup, playerTgID) {
+			return nil, ErrNotInLineup
+		}
+		return lineup, nil
+	}
+
+	cfg, err := g.GetGameConfig(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get game config: %w", err)
+	}
+	if len(players) >= cfg.MaxPlayers {
+		return nil, fmt.Errorf("%w: %d of %d", ErrTooManyPlayers, len(players)+1, cfg.MaxPlayers)
+	}
+	return nil, nil
+}
+
+// placeLastRemaining ставит на следующее место последнего оставшегося игрока состава, если чат
+// так настроен, и возвращает игроков сессии.
+func (g *GameService) placeLastRemaining(ctx context.Context, chatID int64, messageID int64, lineup []storage.Player) ([]storage.SessionPlayer, error) {
+	players, err := g.storage.GetSessionPlayers(ctx, chatID, messageID)
+	if err != nil || len(lineup) == 0 {
+		return players, err
+	}
+	cfg, err := g.GetGameConfig(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get game config: %w", err)
+	}
+	remaining := unplacedPlayers(lineup, players)
+	if !cfg.AutoPlaceLast || len(remaining) != 1 {
+		return players, nil
+	}
+	if err := g.storage.AddPlayerToSession(ctx, chatID, messageID, remaining[0].TGID, false); err != nil {
+		return nil, err
+	}
+	return g.storage.GetSessionPlayers(ctx, chatID, messageID)
+}
+
+// unplacedPlayers возвращает игроков состава, которым еще не выбрано место.
+func unplacedPlayers(lineup []storage.Player, players []storage.SessionPlayer) []storage.Player {
+	var remaining []storage.Player
+	for _, p := range lineup {
+		if !slices.ContainsFunc(players, func(sp storage.SessionPlayer) bool { return sp.Player.TGID == p.TGID }) {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
+
+func containsPlayer(players []storage.Player, tgID int64) bool {
+	return slices.ContainsFunc(players, func(p storage.Player) bool { return p.TGID == tgID })
+}
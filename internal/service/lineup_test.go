@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+func TestGameService_SetGameConfig(t *testing.T) {
+	mockStore := &mockStorage{}
+	gameService := New(mockStore, Config{})
+
+	cfg, err := gameService.GetGameConfig(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if cfg != DefaultGameConfig {
+		t.Errorf("ожидались настройки по умолчанию, получено %+v", cfg)
+	}
+
+	invalid := []storage.GameConfig{
+		{MinPlayers: 1, MaxPlayers: 4},
+		{MinPlayers: 5, MaxPlayers: 4},
+		{MinPlayers: 2, MaxPlayers: MaxPlayersLimit + 1},
+	}
+	for _, cfg := range invalid {
+		if err := gameService.SetGameConfig(context.Background(), 1, cfg); !errors.Is(err, ErrInvalidGameConfig) {
+			t.Errorf("для %+v ожидалась ошибка ErrInvalidGameConfig, получено: %v", cfg, err)
+		}
+	}
+	if mockStore.gameConfig != nil {
+		t.Fatalf("неверные настройки не должны сохраняться")
+	}
+
+	want := storage.GameConfig{MinPlayers: 3, MaxPlayers: 3}
+	if err := gameService.SetGameConfig(context.Background(), 1, want); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if cfg, _ := gameService.GetGameConfig(context.Background(), 1); cfg != want {
+		t.Errorf("ожидалось %+v, получено %+v", want, cfg)
+	}
+}
+
+func TestGameService_Lineup(t *testing.T) {
+	mockStore := &mockStorage{
+		session:    &storage.RecordingSession{ChatID: 1, MessageID: 100, LineupOpen: true},
+		gameConfig: &storage.GameConfig{MinPlayers: 3, MaxPlayers: 3},
+	}
+	gameService := New(mockStore, Config{})
+	ctx := context.Background()
+
+	for _, id := range []int64{1, 2} {
+		if _, err := gameService.ToggleLineupPlayer(ctx, 1, 100, id); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+	}
+	if _, err := gameService.ConfirmLineup(ctx, 1, 100); !errors.Is(err, ErrTooFewPlayers) {
+		t.Errorf("ожидалась ошибка ErrTooFewPlayers, получено: %v", err)
+	}
+	if _, err := gameService.AddPlayerToRecording(ctx, 1, 100, 1, false); !errors.Is(err, ErrLineupOpen) {
+		t.Errorf("пока состав набирается, места выбирать нельзя, получено: %v", err)
+	}
+
+	if _, err := gameService.ToggleLineupPlayer(ctx, 1, 100, 3); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if _, err := gameService.ToggleLineupPlayer(ctx, 1, 100, 4); !errors.Is(err, ErrTooManyPlayers) {
+		t.Errorf("ожидалась ошибка ErrTooManyPlayers, получено: %v", err)
+	}
+	// Повторное нажатие убирает игрока из состава
+	lineup, err := gameService.ToggleLineupPlayer(ctx, 1, 100, 2)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if len(lineup) != 2 {
+		t.Errorf("ожидалось 2 игрока в составе, получено %d", len(lineup))
+	}
+	if _, err := gameService.ToggleLineupPlayer(ctx, 1, 100, 2); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+
+	if _, err := gameService.ConfirmLineup(ctx, 1, 100); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if mockStore.session.LineupOpen {
+		t.Errorf("после подтверждения состав должен быть закрыт")
+	}
+	if _, err := gameService.AddPlayerToRecording(ctx, 1, 100, 4, false); !errors.Is(err, ErrNotInLineup) {
+		t.Errorf("ожидалась ошибка ErrNotInLineup, получено: %v", err)
+	}
+
+	// Устаревшие кнопки набора состава не меняют подтвержденный состав
+	if _, err := gameService.ToggleLineupPlayer(ctx, 1, 100, 2); !errors.Is(err, ErrLineupLocked) {
+		t.Errorf("ожидалась ошибка ErrLineupLocked, получено: %v", err)
+	}
+	if _, err := gameService.ConfirmLineup(ctx, 1, 100); !errors.Is(err, ErrLineupLocked) {
+		t.Errorf("повторное подтверждение: ожидалась ошибка ErrLineupLocked, получено: %v", err)
+	}
+	if len(mockStore.lineup) != 3 {
+		t.Errorf("состав не должен меняться, получено %d игроков", len(mockStore.lineup))
+	}
+
+	// Пока мест нет, к составу можно вернуться
+	if _, err := gameService.ReopenLineup(ctx, 1, 100); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if _, err := gameService.ConfirmLineup(ctx, 1, 100); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if _, err := gameService.AddPlayerToRecording(ctx, 1, 100, 3, false); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if _, err := gameService.ReopenLineup(ctx, 1, 100); !errors.Is(err, ErrLineupLocked) {
+		t.Errorf("ожидалась ошибка ErrLineupLocked, получено: %v", err)
+	}
+	if _, err := gameService.FinishRecording(ctx, 1, 100); !errors.Is(err, ErrLineupIncomplete) {
+		t.Errorf("ожидалась ошибка ErrLineupIncomplete, получено: %v", err)
+	}
+}
+
+func TestGameService_ReopenLineup_EditSession(t *testing.T) {
+	mockStore := &mockStorage{session: &storage.RecordingSession{ChatID: 1, MessageID: 100, EditGameID: 7}}
+	gameService := New(mockStore, Config{})
+
+	// Устаревшая или подделанная кнопка «⬅️ Состав» не переводит редактирование игры в набор состава
+	if _, err := gameService.ReopenLineup(context.Background(), 1, 100); !errors.Is(err, ErrNotRecording) {
+		t.Errorf("ожидалась ошибка ErrNotRecording, получено: %v", err)
+	}
+	if mockStore.session.LineupOpen {
+		t.Errorf("у сессии редактирования не должно появиться состава")
+	}
+	if _, err := gameService.ReopenLineup(context.Background(), 1, 200); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("ожидалась ошибка ErrSessionNotFound, получено: %v", err)
+	}
+}
+
+func TestGameService_AddPlayerToRecording_AlreadyPlaced(t *testing.T) {
+	tests := []struct {
+		name   string
+		lineup []storage.Player
+	}{
+		{"с составом", []storage.Player{{TGID: 1}, {TGID: 2}, {TGID: 3}}},
+		{"редактирование без состава", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &mockStorage{
+				session:        &storage.RecordingSession{ChatID: 1, MessageID: 100},
+				lineup:         tt.lineup,
+				sessionPlayers: inOrder(storage.Player{TGID: 1}),
+			}
+			gameService := New(mockStore, Config{})
+
+			// Устаревшая кнопка уже расставленного игрока не доходит до базы
+			if _, err := gameService.AddPlayerToRecording(context.Background(), 1, 100, 1, false); !errors.Is(err, ErrAlreadyPlaced) {
+				t.Errorf("ожидалась ошибка ErrAlreadyPlaced, получено: %v", err)
+			}
+			if _, err := gameService.AddDNFToRecording(context.Background(), 1, 100, 1); !errors.Is(err, ErrAlreadyPlaced) {
+				t.Errorf("выбывший: ожидалась ошибка ErrAlreadyPlaced, получено: %v", err)
+			}
+			if len(mockStore.sessionPlayers) != 1 {
+				t.Errorf("игроки сессии не должны меняться, получено %d", len(mockStore.sessionPlayers))
+			}
+		})
+	}
+}
+
+func TestGameService_AutoPlaceLast(t *testing.T) {
+	tests := []struct {
+		name       string
+		auto       bool
+		dnf        bool
+		wantIDs    []int64
+		wantPlaces []int
+	}{
+		{"последний ставится сам", true, false, []int64{1, 2, 3}, []int{1, 2, 3}},
+		{"после выбывшего последний занимает следующее место", true, true, []int64{1, 2, 3}, []int{1, 2, 0}},
+		{"без автоматической расстановки", false, false, []int64{1, 2}, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &mockStorage{
+				session:        &storage.RecordingSession{ChatID: 1, MessageID: 100},
+				gameConfig:     &storage.GameConfig{MinPlayers: 2, MaxPlayers: 6, AutoPlaceLast: tt.auto},
+				lineup:         []storage.Player{{TGID: 1}, {TGID: 2}, {TGID: 3}},
+				sessionPlayers: inOrder(storage.Player{TGID: 1}),
+			}
+			gameService := New(mockStore, Config{})
+
+			var players []storage.SessionPlayer
+			var err error
+			if tt.dnf {
+				players, err = gameService.AddDNFToRecording(context.Background(), 1, 100, 3)
+			} else {
+				players, err = gameService.AddPlayerToRecording(context.Background(), 1, 100, 2, false)
+			}
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+
+			var ids []int64
+			var places []int
+			for _, p := range players {
+				ids = append(ids, p.Player.TGID)
+				places = append(places, p.Place)
+			}
+			if !slices.Equal(ids, tt.wantIDs) || !slices.Equal(places, tt.wantPlaces) {
+				t.Errorf("ожидались игроки %v на местах %v, получено %v на %v", tt.wantIDs, tt.wantPlaces, ids, places)
+			}
+		})
+	}
+}
+
+func TestGameService_RecordGame_PlayerLimits(t *testing.T) {
+	mockStore := &mockStorage{playersExist: true, gameConfig: &storage.GameConfig{MinPlayers: 3, MaxPlayers: 4}}
+	gameService := New(mockStore, Config{})
+
+	if _, err := gameService.RecordGame(context.Background(), 1, []storage.Player{{TGID: 1}, {TGID: 2}}); !errors.Is(err, ErrTooFewPlayers) {
+		t.Errorf("ожидалась ошибка ErrTooFewPlayers, получено: %v", err)
+	}
+	five := []storage.Player{{TGID: 1}, {TGID: 2}, {TGID: 3}, {TGID: 4}, {TGID: 5}}
+	if _, err := gameService.RecordGame(context.Background(), 1, five); !errors.Is(err, ErrTooManyPlayers) {
+		t.Errorf("ожидалась ошибка ErrTooManyPlayers, получено: %v", err)
+	}
+	if len(mockStore.savedResults) != 0 {
+		t.Errorf("результаты не должны сохраняться")
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+var ErrUnknownRecordPolicy = errors.New("unknown record policy")
+
+// RecordPolicy - кто, кроме начавшего запись, может нажимать кнопки ее клавиатуры.
+type RecordPolicy string
+
+const (
+	RecordByOwner        RecordPolicy = "owner"        // только тот, кто начал запись
+	RecordByParticipants RecordPolicy = "participants" // начавший, игроки состава и уже выбранные игроки
+	RecordByAdmins       RecordPolicy = "admins"       // начавший и администраторы чата
+)
+
+// ParseRecordPolicy возвращает правило по названию из конфигурации.
+func ParseRecordPolicy(name string) (RecordPolicy, error) {
+	policy := RecordPolicy(name)
+	switch policy {
+	case RecordByOwner, RecordByParticipants, RecordByAdmins:
+		return policy, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownRecordPolicy, name)
+}
+
+// CanControlRecording проверяет, может ли пользователь userID нажимать кнопки сессии записи.
+// Начавший запись может всегда, остальные - по правилу из Config.RecordPolicy.
+// isAdmin вызывается, только если правило зависит от прав в чате.
+func (g *GameService) CanControlRecording(ctx context.Context, session *storage.RecordingSession, userID int64, isAdmin func() bool) (bool, error) {
+	if userID == session.OwnerTGID {
+		return true, nil
+	}
+	switch g.recordPolicy {
+	case RecordByParticipants:
+		players, err := g.storage.GetSessionPlayers(ctx, session.ChatID, session.MessageID)
+		if err != nil {
+			return false, fmt.Errorf("failed to get session players: %w", err)
+		}
+		if slices.ContainsFunc(players, func(p storage.SessionPlayer) bool { return p.Player.TGID == userID }) {
+			return true, nil
+		}
+		lineup, err := g.storage.GetSessionLineup(ctx, session.ChatID, session.MessageID)
+		if err != nil {
+			return false, fmt.Errorf("failed to get session lineup: %w", err)
+		}
+		return containsPlayer(lineup, userID), nil
+	case RecordByAdmins:
+		return isAdmin(), nil
+	}
+	return false, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+func TestGameService_CanControlRecording(t *testing.T) {
+	session := &storage.RecordingSession{ChatID: 1, MessageID: 100, OwnerTGID: 7}
+	mockStore := &mockStorage{sessionPlayers: inOrder(storage.Player{TGID: 2}), lineup: []storage.Player{{TGID: 2}, {TGID: 4}}}
+	admin := func() bool { return true }
+	notAdmin := func() bool { return false }
+
+	tests := []struct {
+		name    string
+		policy  RecordPolicy
+		userID  int64
+		isAdmin func() bool
+		want    bool
+	}{
+		{"начавший запись при owner", RecordByOwner, 7, notAdmin, true},
+		{"участник при owner", RecordByOwner, 2, admin, false},
+		{"участник по умолчанию", "", 2, notAdmin, true},
+		{"игрок состава по умолчанию", "", 4, notAdmin, true},
+		{"посторонний по умолчанию", "", 3, admin, false},
+		{"администратор при admins", RecordByAdmins, 3, admin, true},
+		{"участник при admins", RecordByAdmins, 2, notAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gameService := New(mockStore, Config{RecordPolicy: tt.policy})
+			got, err := gameService.CanControlRecording(context.Background(), session, tt.userID, tt.isAdmin)
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ожидалось %v, получено %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRecordPolicy(t *testing.T) {
+	if policy, err := ParseRecordPolicy("admins"); err != nil || policy != RecordByAdmins {
+		t.Errorf("ожидалось правило admins, получено %q, %v", policy, err)
+	}
+	if _, err := ParseRecordPolicy("everyone"); !errors.Is(err, ErrUnknownRecordPolicy) {
+		t.Errorf("ожидалась ошибка ErrUnknownRecordPolicy, получено: %v", err)
+	}
+}
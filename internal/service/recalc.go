@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+// ScoreDiscrepancy - расхождение сохраненных очков игрока с пересчитанными по результатам игр.
+type ScoreDiscrepancy struct {
+	Player   storage.Player
+	Stored   int
+	Expected int
+}
+
+// RecalcReport - результат сверки очков чата.
+type RecalcReport struct {
+	Since         time.Time // очки считаются по играм после этого момента (начало или конец последнего сезона)
+	Games         int
+	Discrepancies []ScoreDiscrepancy
+	WrongResults  int  // результаты игр, очки в которых не совпадают со стратегией игры
+	Fixed         bool // расхождения исправлены
+}
+
+// Consistent сообщает, что расхождений не найдено.
+func (r *RecalcReport) Consistent() bool {
+	return len(r.Discrepancies) == 0 && r.WrongResults == 0
+}
+
+// RecalcScores пересчитывает очки игроков чата по сохраненным результатам игр текущего
+// сезона: очки за каждую игру заново считаются по стратегии, с которой она была записана,
+// а не по текущей стратегии чата - стратегия хранится с игрой, чтобы ее очки оставались объяснимыми.
+// Если fix, расхождения исправляются в одной транзакции: результаты игр получают
+// пересчитанные очки, а итоговые очки игроков - разницу с пересчитанными.
+func (g *GameService) RecalcScores(ctx context.Context, chatID int64, fix bool) (*RecalcReport, error) {
+	seasons, err := g.storage.ListSeasons(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	report := &RecalcReport{}
+	// При начале и завершении сезона очки обнуляются, поэтому считаем только игры после последнего из них
+	for _, s := range seasons {
+		if s.StartedAt.After(report.Since) {
+			report.Since = s.StartedAt
+		}
+		if s.EndedAt != nil && s.EndedAt.After(report.Since) {
+			report.Since = *s.EndedAt
+		}
+	}
+
+	games, err := g.storage.LoadGamesSince(ctx, chatID, report.Since)
+	if err != nil {
+		return nil, err
+	}
+	players, err := g.storage.GetAllPlayers(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[int64]int, len(players))
+	var wrong []storage.GameResult
+	for _, game := range games {
+		strategy, err := ParseScoring(game.Scoring)
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", game.ID, err)
+		}
+		places := make(map[int64]int)
+		for _, r := range game.Results {
+			if !r.DNF {
+				places[r.Player.TGID] = r.Place
+			}
+		}
+		shared := finishedPoints(strategy, places)
+		for _, r := range game.Results {
+			if r.DNF {
+				// Штраф выбывшего не пересчитывается: DNF_PENALTY мог измениться после игры
+				expected[r.Player.TGID] += r.Points
+				continue
+			}
+			points := shared[r.Player.TGID]
+			if points != r.Points {
+				r.Points = points
+				wrong = append(wrong, r)
+			}
+			expected[r.Player.TGID] += points
+		}
+	}
+	report.Games = len(games)
+	report.WrongResults = len(wrong)
+
+	for _, p := range players {
+		if p.Score != expected[p.TGID] {
+			report.Discrepancies = append(report.Discrepancies, ScoreDiscrepancy{Player: p, Stored: p.Score, Expected: expected[p.TGID]})
+		}
+	}
+
+	if !fix || report.Consistent() {
+		return report, nil
+	}
+
+	err = g.storage.WithTx(ctx, func(tx storage.Tx) error {
+		for _, r := range wrong {
+			if err := tx.SetResultPoints(ctx, r.GameID, r.Player.TGID, r.Points); err != nil {
+				return fmt.Errorf("failed to fix result of game %d: %w", r.GameID, err)
+			}
+		}
+		// Исправляем разницей, а не присваиванием, чтобы не потерять очки игры, записанной во время пересчёта
+		for _, d := range report.Discrepancies {
+			if err := tx.UpdatePlayerScore(ctx, chatID, d.Player.TGID, d.Expected-d.Stored); err != nil {
+				return fmt.Errorf("failed to fix score of %s: %w", d.Player.DisplayName, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Fixed = true
+	return report, nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+func TestGameService_RecalcScores(t *testing.T) {
+	seasonEnd := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	newStore := func() *mockStorage {
+		return &mockStorage{
+			seasons: []storage.Season{{ID: 1, Name: "2025", EndedAt: &seasonEnd}},
+			players: []storage.Player{
+				{TGID: 1, DisplayName: "Alice", Score: 5},
+				{TGID: 2, DisplayName: "Bob", Score: 2},
+			},
+			fullGames: []storage.Game{
+				// Игра прошлого сезона не учитывается
+				{ID: 1, Scoring: "linear", CreatedAt: seasonEnd.Add(-time.Hour), Results: []storage.GameResult{
+					{GameID: 1, Player: alice, Place: 1, Points: 2}, {GameID: 1, Player: bob, Place: 2, Points: 1},
+				}},
+				{ID: 2, Scoring: "linear", CreatedAt: seasonEnd.Add(time.Hour), Results: []storage.GameResult{
+					{GameID: 2, Player: alice, Place: 1, Points: 2}, {GameID: 2, Player: bob, Place: 2, Points: 1},
+				}},
+				// Очки Алисы записаны неверно: по стратегии "winner" второе место получает 0
+				{ID: 3, Scoring: "winner", CreatedAt: seasonEnd.Add(2 * time.Hour), Results: []storage.GameResult{
+					{GameID: 3, Player: bob, Place: 1, Points: 1}, {GameID: 3, Player: alice, Place: 2, Points: 1},
+				}},
+			},
+		}
+	}
+
+	t.Run("только отчет", func(t *testing.T) {
+		mockStore := newStore()
+		report, err := New(mockStore, Config{}).RecalcScores(context.Background(), 1, false)
+		if err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if report.Games != 2 || report.WrongResults != 1 || report.Fixed {
+			t.Errorf("неверный отчет: %+v", report)
+		}
+		if len(report.Discrepancies) != 1 {
+			t.Fatalf("ожидалось одно расхождение, получено %+v", report.Discrepancies)
+		}
+		if d := report.Discrepancies[0]; d.Player.TGID != 1 || d.Stored != 5 || d.Expected != 2 {
+			t.Errorf("неверное расхождение: %+v", d)
+		}
+		if mockStore.commits != 0 || len(mockStore.scores) != 0 {
+			t.Error("без fix ничего не должно меняться")
+		}
+	})
+
+	t.Run("игры до начала текущего сезона не учитываются", func(t *testing.T) {
+		mockStore := newStore()
+		mockStore.seasons = append(mockStore.seasons, storage.Season{ID: 2, Name: "2026", StartedAt: seasonEnd.Add(90 * time.Minute)})
+		report, err := New(mockStore, Config{}).RecalcScores(context.Background(), 1, false)
+		if err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if report.Games != 1 || !report.Since.Equal(seasonEnd.Add(90*time.Minute)) {
+			t.Errorf("ожидалась одна игра после начала сезона, получено %+v", report)
+		}
+	})
+
+	t.Run("исправление", func(t *testing.T) {
+		mockStore := newStore()
+		report, err := New(mockStore, Config{}).RecalcScores(context.Background(), 1, true)
+		if err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if !report.Fixed || mockStore.commits != 1 {
+			t.Errorf("исправления должны примениться в одной транзакции: %+v, commits %d", report, mockStore.commits)
+		}
+		if mockStore.scores[1] != -3 || mockStore.scores[2] != 0 {
+			t.Errorf("неверные поправки очков: %v", mockStore.scores)
+		}
+		if len(mockStore.fixedResults) != 1 || mockStore.fixedResults[0].Player.TGID != 1 || mockStore.fixedResults[0].Points != 0 {
+			t.Errorf("неверно исправлены результаты: %+v", mockStore.fixedResults)
+		}
+	})
+}
+
+func TestGameService_RecalcScores_Ties(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	// Поделившие первое место из двух делят 2 + 1 очко: лишнее очко у игрока с меньшим tgID
+	mockStore := &mockStorage{
+		players: []storage.Player{
+			{TGID: 1, DisplayName: "Alice", Score: 2},
+			{TGID: 2, DisplayName: "Bob", Score: 1},
+		},
+		fullGames: []storage.Game{
+			{ID: 1, Scoring: "linear", CreatedAt: time.Now(), Results: []storage.GameResult{
+				{GameID: 1, Player: bob, Place: 1, Points: 1}, {GameID: 1, Player: alice, Place: 1, Points: 2},
+			}},
+		},
+	}
+
+	report, err := New(mockStore, Config{}).RecalcScores(context.Background(), 1, false)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if report.WrongResults != 0 || !report.Consistent() {
+		t.Errorf("поделенные очки не должны считаться ошибкой: %+v", report)
+	}
+}
+
+func TestGameService_RecalcScores_DNF(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	// Единственный доигравший получает очки за 1-е место из одного, выбывшему остается штраф игры
+	mockStore := &mockStorage{
+		players: []storage.Player{
+			{TGID: 1, DisplayName: "Alice", Score: 1},
+			{TGID: 2, DisplayName: "Bob", Score: -3},
+		},
+		fullGames: []storage.Game{
+			{ID: 1, Scoring: "linear", CreatedAt: time.Now(), Results: []storage.GameResult{
+				{GameID: 1, Player: alice, Place: 1, Points: 1}, {GameID: 1, Player: bob, Place: 2, Points: -3, DNF: true},
+			}},
+		},
+	}
+
+	report, err := New(mockStore, Config{DNFPenalty: 1}).RecalcScores(context.Background(), 1, false)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if !report.Consistent() {
+		t.Errorf("штраф выбывшего не должен пересчитываться: %+v", report)
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownScoring = errors.New("unknown scoring strategy")
+
+// DefaultScoring - стратегия подсчёта очков, которая используется, пока чат не выбрал другую.
+const DefaultScoring = "linear"
+
+// ScoringStrategy определяет, сколько очков получает игрок за занятое место.
+type ScoringStrategy interface {
+	// Name - ключ стратегии, под которым она хранится в базе вместе с игрой.
+	Name() string
+	// Title - название стратегии для сообщений в чате.
+	Title() string
+	// Points возвращает очки за место place (начиная с 1) в игре из numPlayers игроков.
+	Points(place, numPlayers int) int
+}
+
+// SharedPoints возвращает доли очков tied игроков, поделивших место place в игре из numPlayers
+// игроков. Они занимают места place…place+tied-1, очки за эти места складываются и делятся
+// с округлением вниз, а остаток раздается по очку первым долям. Сумма долей всегда равна сумме
+// очков за занятые места, поэтому дележ не добавляет и не отнимает очков.
+func SharedPoints(strategy ScoringStrategy, place, tied, numPlayers int) []int {
+	if tied <= 1 {
+		return []int{strategy.Points(place, numPlayers)}
+	}
+	sum := 0
+	for p := place; p < place+tied; p++ {
+		sum += strategy.Points(p, numPlayers)
+	}
+	base := int(math.Floor(float64(sum) / float64(tied)))
+	shares := make([]int, tied)
+	for i := range shares {
+		shares[i] = base
+		if i < sum-base*tied {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+// finishedPoints возвращает очки доигравших игроков по их местам (tgID -> место). Доли
+// поделенного места раздаются по возрастанию tgID, поэтому результат не зависит от порядка игроков.
+func finishedPoints(strategy ScoringStrategy, places map[int64]int) map[int64]int {
+	tied := make(map[int][]int64)
+	for tgID, place := range places {
+		tied[place] = append(tied[place], tgID)
+	}
+	points := make(map[int64]int, len(places))
+	for place, ids := range tied {
+		slices.Sort(ids)
+		shares := SharedPoints(strategy, place, len(ids), len(places))
+		for i, tgID := range ids {
+			points[tgID] = shares[i]
+		}
+	}
+	return points
+}
+
+// LinearScoring - очки по убыванию: первое место получает numPlayers, последнее 1.
+type LinearScoring struct{}
+
+func (LinearScoring) Name() string  { return "linear" }
+func (LinearScoring) Title() string { return "Линейная (N, N-1, …, 1)" }
+func (LinearScoring) Points(place, numPlayers int) int {
+	return numPlayers - place + 1
+}
+
+// WinnerTakesAllScoring - победитель забирает по очку с каждого соперника, остальные ничего не получают.
+type WinnerTakesAllScoring struct{}
+
+func (WinnerTakesAllScoring) Name() string  { return "winner" }
+func (WinnerTakesAllScoring) Title() string { return "Победитель забирает всё" }
+func (WinnerTakesAllScoring) Points(place, numPlayers int) int {
+	if place == 1 {
+		return numPlayers - 1
+	}
+	return 0
+}
+
+// SvintusScoring - очки никто не получает, а проигравший (последний) получает штраф
+// по очку за каждого соперника.
+type SvintusScoring struct{}
+
+func (SvintusScoring) Name() string  { return "svintus" }
+func (SvintusScoring) Title() string { return "Свинтус (штраф проигравшему)" }
+func (SvintusScoring) Points(place, numPlayers int) int {
+	if numPlayers > 1 && place == numPlayers {
+		return -(numPlayers - 1)
+	}
+	return 0
+}
+
+// TableScoring - очки берутся из таблицы по месту, места за пределами таблицы получают 0.
+type TableScoring struct {
+	name   string
+	title  string
+	points []int
+}
+
+// F1Scoring возвращает таблицу очков как в Формуле-1.
+func F1Scoring() TableScoring {
+	return TableScoring{
+		name:   "f1",
+		title:  "Формула-1 (25, 18, 15, …)",
+		points: []int{25, 18, 15, 12, 10, 8, 6, 4, 2, 1},
+	}
+}
+
+// NewTableScoring создает стратегию с произвольной таблицей очков (например, из конфигурации).
+func NewTableScoring(points []int) TableScoring {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = strconv.Itoa(p)
+	}
+	table := strings.Join(parts, ",")
+	return TableScoring{
+		name:   "table:" + table,
+		title:  "Своя таблица (" + strings.Join(parts, ", ") + ")",
+		points: append([]int(nil), points...),
+	}
+}
+
+func (t TableScoring) Name() string  { return t.name }
+func (t TableScoring) Title() string { return t.title }
+func (t TableScoring) Points(place, numPlayers int) int {
+	if place < 1 || place > len(t.points) {
+		return 0
+	}
+	return t.points[place-1]
+}
+
+// builtinScorings возвращает встроенные стратегии в порядке показа в меню.
+func builtinScorings() []ScoringStrategy {
+	return []ScoringStrategy{LinearScoring{}, WinnerTakesAllScoring{}, F1Scoring(), SvintusScoring{}}
+}
+
+// ParseScoring восстанавливает стратегию по ключу, сохраненному в базе.
+func ParseScoring(name string) (ScoringStrategy, error) {
+	if name == "" {
+		name = DefaultScoring
+	}
+	for _, s := range builtinScorings() {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	if table, ok := strings.CutPrefix(name, "table:"); ok {
+		points, err := ParsePointsTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScoring, name)
+		}
+		return NewTableScoring(points), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownScoring, name)
+}
+
+// ParsePointsTable разбирает таблицу очков вида "10,6,3,1".
+func ParsePointsTable(s string) ([]int, error) {
+	var points []int
+	for _, part := range strings.Split(s, ",") {
+		p, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid points table %q: %w", s, err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
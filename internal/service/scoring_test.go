@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+func TestScoringStrategies_Points(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy ScoringStrategy
+		want     []int // очки за места в игре из 4 игроков
+	}{
+		{"линейная", LinearScoring{}, []int{4, 3, 2, 1}},
+		{"победитель забирает всё", WinnerTakesAllScoring{}, []int{3, 0, 0, 0}},
+		{"формула-1", F1Scoring(), []int{25, 18, 15, 12}},
+		{"свинтус", SvintusScoring{}, []int{0, 0, 0, -3}},
+		{"своя таблица", NewTableScoring([]int{5, 2}), []int{5, 2, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.strategy.Points(i+1, len(tt.want)); got != want {
+					t.Errorf("место %d: ожидалось %d, получено %d", i+1, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScoring(t *testing.T) {
+	for _, s := range builtinScorings() {
+		got, err := ParseScoring(s.Name())
+		if err != nil || got.Name() != s.Name() {
+			t.Errorf("ParseScoring(%q) = %v, %v", s.Name(), got, err)
+		}
+	}
+
+	def, err := ParseScoring("")
+	if err != nil || def.Name() != DefaultScoring {
+		t.Errorf("пустой ключ должен давать стратегию по умолчанию, получено %v, %v", def, err)
+	}
+
+	table, err := ParseScoring("table:10,6,3")
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if table.Points(2, 3) != 6 || table.Name() != "table:10,6,3" {
+		t.Errorf("таблица восстановлена неверно: %s", table.Name())
+	}
+
+	if _, err := ParseScoring("unknown"); !errors.Is(err, ErrUnknownScoring) {
+		t.Errorf("ожидалась ошибка ErrUnknownScoring, получено: %v", err)
+	}
+}
+
+func TestGameService_SetScoring(t *testing.T) {
+	mockStore := &mockStorage{}
+	gameService := New(mockStore, Config{ScoringTable: []int{3, 1}})
+
+	if err := gameService.SetScoring(context.Background(), 1, "table:3,1"); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if mockStore.scoring != "table:3,1" {
+		t.Errorf("стратегия не сохранена, получено %q", mockStore.scoring)
+	}
+
+	// Таблица, которой нет в конфигурации, недоступна для выбора
+	if err := gameService.SetScoring(context.Background(), 1, "table:100"); !errors.Is(err, ErrUnknownScoring) {
+		t.Errorf("ожидалась ошибка ErrUnknownScoring, получено: %v", err)
+	}
+}
+
+func TestGameService_CalculatePoints(t *testing.T) {
+	g := &GameService{}
+	winners := inOrder(storage.Player{TGID: 1}, storage.Player{TGID: 2}, storage.Player{TGID: 3})
+
+	results := g.CalculatePoints(SvintusScoring{}, winners)
+	want := []int{0, 0, -2}
+	for i, r := range results {
+		if r.Place != i+1 || r.Points != want[i] {
+			t.Errorf("результат %d: место %d, очки %d", i, r.Place, r.Points)
+		}
+	}
+
+	// Поделившие 2-3 места делят 3 + 2 очка: лишнее очко достается игроку с меньшим tgID
+	tied := []storage.SessionPlayer{
+		{Player: storage.Player{TGID: 1}, Place: 1},
+		{Player: storage.Player{TGID: 3}, Place: 2},
+		{Player: storage.Player{TGID: 2}, Place: 2},
+		{Player: storage.Player{TGID: 4}, Place: 4},
+	}
+	results = g.CalculatePoints(LinearScoring{}, tied)
+	want = []int{4, 2, 3, 1}
+	for i, r := range results {
+		if r.Place != tied[i].Place || r.Points != want[i] {
+			t.Errorf("ничья, результат %d: место %d, очки %d", i, r.Place, r.Points)
+		}
+	}
+
+	// Выбывшие не влияют на очки доигравших, делят место после них и получают штраф
+	g = &GameService{dnfPenalty: 2}
+	withDNF := []storage.SessionPlayer{
+		{Player: storage.Player{TGID: 1}, Place: 1},
+		{Player: storage.Player{TGID: 2}, Place: 2},
+		{Player: storage.Player{TGID: 3}, DNF: true},
+		{Player: storage.Player{TGID: 4}, DNF: true},
+	}
+	results = g.CalculatePoints(LinearScoring{}, withDNF)
+	want = []int{2, 1, -2, -2}
+	wantPlaces := []int{1, 2, 3, 3}
+	for i, r := range results {
+		if r.Place != wantPlaces[i] || r.Points != want[i] || r.DNF != withDNF[i].DNF {
+			t.Errorf("выбывшие, результат %d: место %d, очки %d, выбыл %v", i, r.Place, r.Points, r.DNF)
+		}
+	}
+}
+
+func TestSharedPoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy ScoringStrategy
+		place    int
+		tied     int
+		players  int
+		want     []int
+	}{
+		{"без дележа", LinearScoring{}, 2, 1, 4, []int{3}},
+		{"линейная, 2-3 места", LinearScoring{}, 2, 2, 4, []int{3, 2}},
+		{"все вместе", LinearScoring{}, 1, 3, 3, []int{2, 2, 2}},
+		{"победитель забирает всё, двое первых", WinnerTakesAllScoring{}, 1, 2, 2, []int{1, 0}},
+		{"свинтус, двое последних", SvintusScoring{}, 3, 2, 4, []int{-1, -2}},
+		{"Формула-1, 1-2 места", F1Scoring(), 1, 2, 5, []int{22, 21}},
+		{"таблица, за ее пределами", NewTableScoring([]int{10, 6, 3}), 3, 2, 4, []int{2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SharedPoints(tt.strategy, tt.place, tt.tied, tt.players); !slices.Equal(got, tt.want) {
+				t.Errorf("ожидалось %v очков, получено %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// Дележ места не меняет сумму очков за игру ни в одной встроенной стратегии.
+func TestSharedPoints_KeepsTotal(t *testing.T) {
+	for _, strategy := range builtinScorings() {
+		for players := 2; players <= MaxPlayersLimit; players++ {
+			for place := 1; place <= players; place++ {
+				for tied := 1; place+tied-1 <= players; tied++ {
+					want := 0
+					for p := place; p < place+tied; p++ {
+						want += strategy.Points(p, players)
+					}
+					shares := SharedPoints(strategy, place, tied, players)
+					got := 0
+					for _, s := range shares {
+						got += s
+					}
+					if len(shares) != tied || got != want {
+						t.Errorf("%s, места %d-%d из %d: доли %v, ожидалась сумма %d", strategy.Name(), place, place+tied-1, players, shares, want)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+var ErrSeasonActive = errors.New("season already in progress")
+var ErrNoActiveSeason = errors.New("no active season")
+var ErrSeasonExists = errors.New("season with this name already exists")
+var ErrSeasonNotFound = errors.New("season not found")
+
+// StartSeason начинает новый сезон в чате и обнуляет очки игроков: в таблицу сезона попадают только
+// очки, набранные в нем. Если название не указано, сезон называется текущим годом.
+func (g *GameService) StartSeason(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	active, err := g.storage.GetActiveSeason(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSeasonActive, active.Name)
+	}
+
+	if name == "" {
+		name = strconv.Itoa(time.Now().Year())
+	}
+	existing, err := g.storage.GetSeasonByName(ctx, chatID, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSeasonExists, name)
+	}
+
+	return g.storage.CreateSeason(ctx, chatID, name)
+}
+
+// EndSeason завершает текущий сезон чата: архивирует итоговую таблицу и обнуляет очки игроков.
+func (g *GameService) EndSeason(ctx context.Context, chatID int64) (*storage.Season, []storage.SeasonStanding, error) {
+	active, err := g.storage.GetActiveSeason(ctx, chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if active == nil {
+		return nil, nil, ErrNoActiveSeason
+	}
+
+	if err := g.storage.EndSeason(ctx, chatID, active.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to end season: %w", err)
+	}
+
+	standings, err := g.storage.GetSeasonStandings(ctx, active.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return active, standings, nil
+}
+
+// ListSeasons возвращает сезоны чата, начиная с последнего.
+func (g *GameService) ListSeasons(ctx context.Context, chatID int64) ([]storage.Season, error) {
+	return g.storage.ListSeasons(ctx, chatID)
+}
+
+// GetSeasonStandings возвращает таблицу сезона по названию.
+// Для завершенного сезона - сохраненный архив, для текущего - текущие очки.
+// Если сезона с таким названием нет, а название - это год, таблица собирается
+// по всем играм чата за этот год.
+func (g *GameService) GetSeasonStandings(ctx context.Context, chatID int64, name string) (*storage.Season, []storage.SeasonStanding, error) {
+	season, err := g.storage.GetSeasonByName(ctx, chatID, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if season != nil && season.EndedAt != nil {
+		standings, err := g.storage.GetSeasonStandings(ctx, season.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return season, standings, nil
+	}
+
+	if season != nil {
+		return g.currentSeasonStandings(ctx, chatID, season)
+	}
+
+	year, err := strconv.Atoi(name)
+	if err != nil || year < 2000 || year > 9999 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSeasonNotFound, name)
+	}
+	results, err := g.storage.LoadGamesByYear(ctx, chatID, year)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSeasonNotFound, name)
+	}
+	return &storage.Season{ChatID: chatID, Name: name}, standingsFromResults(results), nil
+}
+
+// currentSeasonStandings собирает таблицу текущего сезона по очкам игроков. Игры считаются
+// так же, как в архиве при завершении сезона: по сезону, в котором игра записана.
+func (g *GameService) currentSeasonStandings(ctx context.Context, chatID int64, season *storage.Season) (*storage.Season, []storage.SeasonStanding, error) {
+	players, err := g.storage.GetAllPlayers(ctx, chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	games, err := g.storage.GetSeasonGameCounts(ctx, season.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	standings := make([]storage.SeasonStanding, 0, len(players))
+	for _, p := range players {
+		standings = append(standings, storage.SeasonStanding{Player: p, Score: p.Score, Games: games[p.TGID]})
+	}
+	rankStandings(standings)
+	return season, standings, nil
+}
+
+// standingsFromResults суммирует очки и игры по результатам.
+func standingsFromResults(results []storage.GameResult) []storage.SeasonStanding {
+	index := make(map[int64]int)
+	var standings []storage.SeasonStanding
+	for _, r := range results {
+		i, ok := index[r.Player.TGID]
+		if !ok {
+			i = len(standings)
+			index[r.Player.TGID] = i
+			standings = append(standings, storage.SeasonStanding{Player: r.Player})
+		}
+		standings[i].Score += r.Points
+		standings[i].Games++
+	}
+	for i := range standings {
+		standings[i].Player.Score = standings[i].Score
+	}
+	rankStandings(standings)
+	return standings
+}
+
+// rankStandings сортирует таблицу по очкам и расставляет места (при равенстве очков место общее).
+func rankStandings(standings []storage.SeasonStanding) {
+	sort.SliceStable(standings, func(i, j int) bool { return standings[i].Score > standings[j].Score })
+	for i := range standings {
+		if i > 0 && standings[i].Score == standings[i-1].Score {
+			standings[i].Place = standings[i-1].Place
+		} else {
+			standings[i].Place = i + 1
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+func TestGameService_StartSeason(t *testing.T) {
+	mockStore := &mockStorage{}
+	gameService := New(mockStore, Config{})
+
+	season, err := gameService.StartSeason(context.Background(), 1, "")
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if want := time.Now().Format("2006"); season.Name != want {
+		t.Errorf("название по умолчанию: ожидалось %q, получено %q", want, season.Name)
+	}
+
+	if _, err := gameService.StartSeason(context.Background(), 1, "весна"); !errors.Is(err, ErrSeasonActive) {
+		t.Errorf("ожидалась ошибка ErrSeasonActive, получено: %v", err)
+	}
+
+	if _, _, err := gameService.EndSeason(context.Background(), 1); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if mockStore.endedSeasonID != season.ID {
+		t.Errorf("завершен не тот сезон: %d", mockStore.endedSeasonID)
+	}
+
+	if _, err := gameService.StartSeason(context.Background(), 1, season.Name); !errors.Is(err, ErrSeasonExists) {
+		t.Errorf("ожидалась ошибка ErrSeasonExists, получено: %v", err)
+	}
+	if _, _, err := gameService.EndSeason(context.Background(), 1); !errors.Is(err, ErrNoActiveSeason) {
+		t.Errorf("ожидалась ошибка ErrNoActiveSeason, получено: %v", err)
+	}
+}
+
+func TestGameService_GetSeasonStandings_ByYear(t *testing.T) {
+	date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	carol := storage.Player{TGID: 3, DisplayName: "Carol"}
+	mockStore := &mockStorage{games: []storage.GameResult{
+		{GameID: 1, Player: alice, Place: 1, Points: 3, Date: date},
+		{GameID: 1, Player: bob, Place: 2, Points: 2, Date: date},
+		{GameID: 1, Player: carol, Place: 3, Points: 1, Date: date},
+		{GameID: 2, Player: bob, Place: 1, Points: 2, Date: date},
+		{GameID: 2, Player: carol, Place: 2, Points: 1, Date: date},
+		{GameID: 3, Player: carol, Place: 1, Points: 2, Date: date.AddDate(1, 0, 0)},
+	}}
+	gameService := New(mockStore, Config{})
+
+	_, standings, err := gameService.GetSeasonStandings(context.Background(), 1, "2025")
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+
+	want := []storage.SeasonStanding{
+		{Player: bob, Place: 1, Score: 4, Games: 2},
+		{Player: alice, Place: 2, Score: 3, Games: 1},
+		{Player: carol, Place: 3, Score: 2, Games: 2},
+	}
+	if len(standings) != len(want) {
+		t.Fatalf("ожидалось %d строк, получено %d", len(want), len(standings))
+	}
+	for i, w := range want {
+		got := standings[i]
+		if got.Player.TGID != w.Player.TGID || got.Place != w.Place || got.Score != w.Score || got.Games != w.Games {
+			t.Errorf("строка %d: ожидалось %+v, получено %+v", i, w, got)
+		}
+	}
+
+	if _, _, err := gameService.GetSeasonStandings(context.Background(), 1, "2019"); !errors.Is(err, ErrSeasonNotFound) {
+		t.Errorf("ожидалась ошибка ErrSeasonNotFound, получено: %v", err)
+	}
+	if _, _, err := gameService.GetSeasonStandings(context.Background(), 1, "весна"); !errors.Is(err, ErrSeasonNotFound) {
+		t.Errorf("ожидалась ошибка ErrSeasonNotFound, получено: %v", err)
+	}
+}
+
+func TestGameService_GetSeasonStandings_Current(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice", Score: 3}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob", Score: 5}
+	mockStore := &mockStorage{
+		players: []storage.Player{alice, bob},
+		seasons: []storage.Season{{ID: 4, Name: "весна", StartedAt: time.Now().Add(-time.Hour)}},
+		// Игры считаются по сезону, в котором записаны, а не по дате
+		seasonGames: map[int64]int{1: 2, 2: 1},
+		games: []storage.GameResult{
+			{GameID: 1, Player: alice, Place: 1, Points: 1, Date: time.Now()},
+		},
+	}
+	gameService := New(mockStore, Config{})
+
+	_, standings, err := gameService.GetSeasonStandings(context.Background(), 1, "весна")
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if len(standings) != 2 || standings[0].Player.TGID != 2 || standings[0].Games != 1 || standings[1].Games != 2 {
+		t.Errorf("неверная таблица текущего сезона: %+v", standings)
+	}
+}
+
+func TestRankStandings_SharedPlaces(t *testing.T) {
+	standings := []storage.SeasonStanding{{Score: 1}, {Score: 5}, {Score: 5}, {Score: 3}}
+	rankStandings(standings)
+	wantPlaces := []int{1, 1, 3, 4}
+	for i, st := range standings {
+		if st.Place != wantPlaces[i] {
+			t.Errorf("строка %d: ожидалось место %d, получено %d", i, wantPlaces[i], st.Place)
+		}
+	}
+}
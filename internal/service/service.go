@@ -4,7 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"sort"
+	"time"
 
 	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
 )
@@ -14,206 +15,576 @@ var ErrSessionNotFound = errors.New("recording session not found")
 
 // StorageInterface определяет методы, которые должен реализовывать слой хранения.
 type StorageInterface interface {
-	PlayerExists(ctx context.Context, tgID int64) (bool, error)
-	AddPlayer(ctx context.Context, tgID int64, username, displayName string) error
-	CheckPlayersExist(ctx context.Context, tgIDs []int64) (bool, error)
+	PlayerExists(ctx context.Context, chatID int64, tgID int64) (bool, error)
+	AddPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error
+	CheckPlayersExist(ctx context.Context, chatID int64, tgIDs []int64) (bool, error)
 	SaveGameResults(ctx context.Context, results []storage.GameResult) error
-	UpdatePlayerScore(ctx context.Context, tgID int64, pointsToAdd int) error
-	GetAllPlayers(ctx context.Context) ([]storage.Player, error)
-	GetPlayerByTGID(ctx context.Context, tgID int64) (*storage.Player, error)
-	CreateGame(ctx context.Context) (int, error)
+	UpdatePlayerScore(ctx context.Context, chatID int64, tgID int64, pointsToAdd int) error
+	GetAllPlayers(ctx context.Context, chatID int64) ([]storage.Player, error)
+	GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error)
+	CreateGame(ctx context.Context, chatID int64, scoring string, recordedBy int64) (int, error)
+	GetChatScoring(ctx context.Context, chatID int64) (string, error)
+	SetChatScoring(ctx context.Context, chatID int64, scoring string) error
+	GetChatGameConfig(ctx context.Context, chatID int64) (*storage.GameConfig, error)
+	SetChatGameConfig(ctx context.Context, chatID int64, cfg storage.GameConfig) error
+
+	// Rating
+	SaveRatingChanges(ctx context.Context, chatID int64, changes []storage.RatingChange) error
+	GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]storage.RatingChange, error)
+	LoadAllGames(ctx context.Context, chatID int64) ([]storage.GameResult, error)
+	LoadGamesByYear(ctx context.Context, chatID int64, year int) ([]storage.GameResult, error)
+
+	// Seasons
+	CreateSeason(ctx context.Context, chatID int64, name string) (*storage.Season, error)
+	GetActiveSeason(ctx context.Context, chatID int64) (*storage.Season, error)
+	GetSeasonByName(ctx context.Context, chatID int64, name string) (*storage.Season, error)
+	ListSeasons(ctx context.Context, chatID int64) ([]storage.Season, error)
+	EndSeason(ctx context.Context, chatID int64, seasonID int) error
+	GetSeasonStandings(ctx context.Context, seasonID int) ([]storage.SeasonStanding, error)
+	GetSeasonGameCounts(ctx context.Context, seasonID int) (map[int64]int, error)
+
+	// Games
+	GetGame(ctx context.Context, chatID int64, gameID int) (*storage.Game, error)
+	GetLastGame(ctx context.Context, chatID int64) (*storage.Game, error)
+	ListGames(ctx context.Context, chatID int64, offset, limit int) ([]storage.Game, int, error)
+	LoadGamesSince(ctx context.Context, chatID int64, since time.Time) ([]storage.Game, error)
+	DeleteGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) error
+	UpdateGameResults(ctx context.Context, chatID int64, gameID int, results []storage.GameResult, editorTGID int64) error
+	GetGameVersions(ctx context.Context, gameID int) ([]storage.GameVersion, error)
+	ReplaceRatings(ctx context.Context, chatID int64, history []storage.RatingChange, initial float64) error
 
 	// Session management
-	CreateRecordingSession(ctx context.Context, chatID int64, messageID int64) error
-	GetRecordingSession(ctx context.Context, chatID int64) (*storage.RecordingSession, error)
-	AddPlayerToSession(ctx context.Context, chatID int64, playerTgID int64) error
-	GetSessionPlayers(ctx context.Context, chatID int64) ([]storage.Player, error)
-	DeleteRecordingSession(ctx context.Context, chatID int64) error
+	CreateRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error
+	GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*storage.RecordingSession, error)
+	AddPlayerToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) error
+	AddDNFToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error
+	RemovePlayerFromSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error
+	SwapSessionPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) error
+	GetLastSelectedPlayer(ctx context.Context, chatID int64, messageID int64) (int64, error)
+	CreateEditSession(ctx context.Context, chatID int64, messageID int64, gameID int, ownerTGID int64, players []storage.SessionPlayer) error
+	GetSessionPlayers(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error)
+	AddPlayerToLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error
+	RemovePlayerFromLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error
+	GetSessionLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error)
+	SetLineupOpen(ctx context.Context, chatID int64, messageID int64, open bool) error
+	DeleteRecordingSession(ctx context.Context, chatID int64, messageID int64) error
+	DeleteExpiredSessions(ctx context.Context, before time.Time) ([]storage.RecordingSession, error)
+
+	// WithTx выполняет fn в одной транзакции: при ошибке все изменения fn откатываются.
+	WithTx(ctx context.Context, fn func(tx storage.Tx) error) error
 }
 
 type GameServiceInterface interface {
-	RegisterPlayer(tgID int64, username, displayName string) error
-	RecordGame(winners []storage.Player) error
-	GetLeaderboard() ([]storage.Player, error)
-	GetAllPlayers() ([]storage.Player, error)
-	GetPlayerByTGID(tgID int64) (*storage.Player, error)
-	GetPlayerScore(tgID int64) (int, error)
+	RegisterPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error
+	RecordGame(ctx context.Context, chatID int64, winners []storage.Player) (*storage.Game, error)
+	GetLeaderboard(ctx context.Context, chatID int64, order LeaderboardOrder) ([]storage.Player, error)
+	GetAllPlayers(ctx context.Context, chatID int64) ([]storage.Player, error)
+	GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error)
+	GetPlayerScore(ctx context.Context, chatID int64, tgID int64) (int, error)
+	GetPlayerStats(ctx context.Context, chatID int64, tgID int64) (*PlayerStats, error)
+	GetHeadToHead(ctx context.Context, chatID int64, a, b int64) (*HeadToHead, error)
+
+	// Scoring
+	AvailableScorings() []ScoringStrategy
+	GetScoring(ctx context.Context, chatID int64) (ScoringStrategy, error)
+	SetScoring(ctx context.Context, chatID int64, name string) error
+	GetGameConfig(ctx context.Context, chatID int64) (storage.GameConfig, error)
+	SetGameConfig(ctx context.Context, chatID int64, cfg storage.GameConfig) error
+
+	// Rating
+	GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]storage.RatingChange, error)
+	GetGlickoRatings(ctx context.Context, chatID int64) ([]GlickoRating, error)
+
+	// Seasons
+	StartSeason(ctx context.Context, chatID int64, name string) (*storage.Season, error)
+	EndSeason(ctx context.Context, chatID int64) (*storage.Season, []storage.SeasonStanding, error)
+	ListSeasons(ctx context.Context, chatID int64) ([]storage.Season, error)
+	GetSeasonStandings(ctx context.Context, chatID int64, name string) (*storage.Season, []storage.SeasonStanding, error)
+
+	// Games
+	ListGames(ctx context.Context, chatID int64, offset, limit int) ([]storage.Game, int, error)
+	UndoLastGame(ctx context.Context, chatID int64, actorTGID int64) (*storage.Game, error)
+	UndoGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) (*storage.Game, error)
+	CanUndoGame(ctx context.Context, chatID int64, gameID int, userID int64, isAdmin func() bool) (bool, error)
+	StartGameEdit(ctx context.Context, chatID int64, gameID int, messageID int64, editorTGID int64) (*storage.Game, error)
+	FinishGameEdit(ctx context.Context, chatID int64, messageID int64, editorTGID int64) (*storage.Game, error)
+	GetGameVersions(ctx context.Context, chatID int64, gameID int) (*storage.Game, []storage.GameVersion, error)
+	RecalcScores(ctx context.Context, chatID int64, fix bool) (*RecalcReport, error)
 
 	// Session management
-	StartRecordingSession(chatID int64, messageID int64) error
-	GetRecordingSession(chatID int64) (*storage.RecordingSession, error)
-	AddPlayerToRecording(chatID int64, playerTgID int64) ([]storage.Player, error)
-	FinishRecording(chatID int64) ([]storage.Player, error)
-	CancelRecording(chatID int64) error
+	StartRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error
+	GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*storage.RecordingSession, error)
+	CanControlRecording(ctx context.Context, session *storage.RecordingSession, userID int64, isAdmin func() bool) (bool, error)
+	GetRecordingLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error)
+	ToggleLineupPlayer(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.Player, error)
+	ConfirmLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error)
+	ReopenLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error)
+	AddPlayerToRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) ([]storage.SessionPlayer, error)
+	AddDNFToRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.SessionPlayer, error)
+	RemovePlayerFromRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.SessionPlayer, error)
+	RemoveLastPlayerFromRecording(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error)
+	SwapRecordingPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) ([]storage.SessionPlayer, error)
+	GetRecordingPlayers(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error)
+	FinishRecording(ctx context.Context, chatID int64, messageID int64) (*storage.Game, error)
+	CancelRecording(ctx context.Context, chatID int64, messageID int64) error
+	ExpireRecordingSessions(ctx context.Context) ([]storage.RecordingSession, error)
+}
+
+// LeaderboardOrder - порядок сортировки таблицы лидеров.
+type LeaderboardOrder int
+
+const (
+	ByPoints LeaderboardOrder = iota // по сумме очков
+	ByRating                         // по рейтингу Эло
+)
+
+// Config - настройки сервиса.
+type Config struct {
+	// ScoringTable - таблица очков для стратегии "своя таблица". Если пусто, стратегия недоступна.
+	ScoringTable []int
+	// RatingPeriod - длина рейтингового периода Glicko-2. По умолчанию неделя.
+	RatingPeriod time.Duration
+	// UndoWindow - сколько времени игру можно отменить кнопкой под результатами. По умолчанию 5 минут.
+	UndoWindow time.Duration
+	// SessionTTL - через сколько после последнего действия истекает сессия записи. По умолчанию час.
+	SessionTTL time.Duration
+	// RecordPolicy - кто может нажимать кнопки сессии записи. По умолчанию RecordByParticipants.
+	RecordPolicy RecordPolicy
+	// DNFPenalty - сколько очков списывается с выбывшего игрока. По умолчанию 0: выбывший просто не получает очков.
+	DNFPenalty int
 }
 
 type GameService struct {
-	storage StorageInterface
-	ctx     context.Context
+	storage      StorageInterface
+	stats        *StatsService
+	scorings     []ScoringStrategy
+	ratingPeriod time.Duration
+	undoWindow   time.Duration
+	sessionTTL   time.Duration
+	recordPolicy RecordPolicy
+	dnfPenalty   int
 }
 
-func New(storage StorageInterface) GameServiceInterface {
+func New(storage StorageInterface, cfg Config) GameServiceInterface {
+	scorings := builtinScorings()
+	if len(cfg.ScoringTable) > 0 {
+		scorings = append(scorings, NewTableScoring(cfg.ScoringTable))
+	}
+	ratingPeriod := cfg.RatingPeriod
+	if ratingPeriod <= 0 {
+		ratingPeriod = DefaultRatingPeriod
+	}
+	undoWindow := cfg.UndoWindow
+	if undoWindow <= 0 {
+		undoWindow = DefaultUndoWindow
+	}
+	sessionTTL := cfg.SessionTTL
+	if sessionTTL <= 0 {
+		sessionTTL = DefaultSessionTTL
+	}
+	recordPolicy := cfg.RecordPolicy
+	if recordPolicy == "" {
+		recordPolicy = RecordByParticipants
+	}
 	return &GameService{
-		storage: storage,
-		ctx:     context.Background(),
+		storage:      storage,
+		stats:        NewStatsService(storage),
+		scorings:     scorings,
+		ratingPeriod: ratingPeriod,
+		undoWindow:   undoWindow,
+		sessionTTL:   sessionTTL,
+		recordPolicy: recordPolicy,
+		dnfPenalty:   cfg.DNFPenalty,
 	}
 }
 
-// RegisterPlayer - регаем игрока через /join
-func (g *GameService) RegisterPlayer(tgID int64, username, displayName string) error {
-	exists, err := g.storage.PlayerExists(g.ctx, tgID)
+// RegisterPlayer - регаем игрока в чате через /join
+func (g *GameService) RegisterPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error {
+	exists, err := g.storage.PlayerExists(ctx, chatID, tgID)
 	if err != nil {
 		return err
 	}
 	if exists {
 		return nil
 	}
-	return g.storage.AddPlayer(g.ctx, tgID, username, displayName)
+	return g.storage.AddPlayer(ctx, chatID, tgID, username, displayName)
 }
 
-// CalculatePoints рассчитывает очки для списка победителей.
-func (g *GameService) CalculatePoints(winners []storage.Player) []storage.GameResult {
+// CalculatePoints рассчитывает очки для игроков с их местами по выбранной стратегии.
+// Игроки с одинаковым местом делят очки, см. SharedPoints. Очки считаются только
+// среди доигравших, а выбывшие делят место после них и получают штраф DNFPenalty.
+func (g *GameService) CalculatePoints(strategy ScoringStrategy, winners []storage.SessionPlayer) []storage.GameResult {
+	places := make(map[int64]int)
+	for _, w := range winners {
+		if !w.DNF {
+			places[w.Player.TGID] = w.Place
+		}
+	}
+	points := finishedPoints(strategy, places)
+	finished := len(places)
+
 	var results []storage.GameResult
-	numPlayers := len(winners)
-	for i, player := range winners {
-		place := i + 1
-		points := numPlayers - place + 1
+	for _, w := range winners {
+		if w.DNF {
+			results = append(results, storage.GameResult{
+				Player: w.Player,
+				Place:  finished + 1,
+				Points: -g.dnfPenalty,
+				DNF:    true,
+			})
+			continue
+		}
 		results = append(results, storage.GameResult{
-			Player: player,
-			Place:  place,
-			Points: points,
+			Player: w.Player,
+			Place:  w.Place,
+			Points: points[w.Player.TGID],
 		})
 	}
 	return results
 }
 
-// RecordGame - Сохранение результатов игры
-func (g *GameService) RecordGame(winners []storage.Player) error {
+// RecordGame - Сохранение результатов игры в чате. Места идут по порядку winners, без дележа.
+func (g *GameService) RecordGame(ctx context.Context, chatID int64, winners []storage.Player) (*storage.Game, error) {
+	placed := make([]storage.SessionPlayer, len(winners))
+	for i, p := range winners {
+		placed[i] = storage.SessionPlayer{Player: p, Place: i + 1}
+	}
+	return g.recordGame(ctx, chatID, placed, 0, 0)
+}
+
+// recordGame сохраняет игру, результаты, очки и рейтинги игроков в одной транзакции.
+// Число игроков должно укладываться в настройки игры чата.
+// Если sessionMessageID не 0, в той же транзакции удаляется сессия записи этого сообщения.
+// recordedBy - кто записал игру (0 - неизвестно).
+func (g *GameService) recordGame(ctx context.Context, chatID int64, winners []storage.SessionPlayer, sessionMessageID int64, recordedBy int64) (*storage.Game, error) {
+	if err := g.checkPlayerCount(ctx, chatID, len(winners)); err != nil {
+		return nil, err
+	}
+
 	var playerIDs []int64
-	for _, p := range winners {
-		playerIDs = append(playerIDs, p.TGID)
+	for _, w := range winners {
+		playerIDs = append(playerIDs, w.Player.TGID)
 	}
 
-	allExist, err := g.storage.CheckPlayersExist(g.ctx, playerIDs)
+	allExist, err := g.storage.CheckPlayersExist(ctx, chatID, playerIDs)
 	if err != nil {
-		return fmt.Errorf("failed to check players: %w", err)
+		return nil, fmt.Errorf("failed to check players: %w", err)
 	}
 	if !allExist {
-		return ErrPlayerNotFound
+		return nil, ErrPlayerNotFound
 	}
 
-	gameID, err := g.storage.CreateGame(g.ctx)
+	strategy, err := g.GetScoring(ctx, chatID)
 	if err != nil {
-		return fmt.Errorf("failed to create game: %w", err)
+		return nil, fmt.Errorf("failed to get scoring: %w", err)
 	}
 
-	results := g.CalculatePoints(winners)
-	for i := range results {
-		results[i].GameID = gameID
+	var gameID int
+	var results []storage.GameResult
+	err = g.storage.WithTx(ctx, func(tx storage.Tx) error {
+		gameID, err = tx.CreateGame(ctx, chatID, strategy.Name(), recordedBy)
+		if err != nil {
+			return fmt.Errorf("failed to create game: %w", err)
+		}
+
+		results = g.CalculatePoints(strategy, winners)
+		for i := range results {
+			results[i].GameID = gameID
+		}
+
+		if err := tx.SaveGameResults(ctx, results); err != nil {
+			return fmt.Errorf("failed to save game results: %w", err)
+		}
+
+		for _, r := range results {
+			if err := tx.UpdatePlayerScore(ctx, chatID, r.Player.TGID, r.Points); err != nil {
+				return fmt.Errorf("failed to update total score for %s: %w", r.Player.DisplayName, err)
+			}
+		}
+
+		if err := g.updateRatings(ctx, tx, chatID, gameID, results); err != nil {
+			return fmt.Errorf("failed to update ratings: %w", err)
+		}
+
+		if sessionMessageID != 0 {
+			if err := tx.DeleteRecordingSession(ctx, chatID, sessionMessageID); err != nil {
+				return fmt.Errorf("failed to delete recording session: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := g.storage.SaveGameResults(g.ctx, results); err != nil {
-		return fmt.Errorf("failed to save game results: %w", err)
+	return &storage.Game{
+		ID:         gameID,
+		ChatID:     chatID,
+		Scoring:    strategy.Name(),
+		RecordedBy: recordedBy,
+		CreatedAt:  time.Now(),
+		Results:    results,
+	}, nil
+}
+
+// updateRatings пересчитывает рейтинги Эло участников игры и заполняет изменения в results.
+func (g *GameService) updateRatings(ctx context.Context, tx storage.Tx, chatID int64, gameID int, results []storage.GameResult) error {
+	players, err := tx.GetAllPlayers(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	current := make(map[int64]float64, len(players))
+	for _, p := range players {
+		current[p.TGID] = p.Rating
 	}
 
-	for _, r := range results {
-		err := g.storage.UpdatePlayerScore(g.ctx, r.Player.TGID, r.Points)
-		if err != nil {
-			log.Printf("failed to update total score for %s: %v", r.Player.DisplayName, err)
+	ratings := make([]float64, len(results))
+	places := make([]int, len(results))
+	for i, r := range results {
+		rating, ok := current[r.Player.TGID]
+		if !ok {
+			return fmt.Errorf("%w: %d", ErrPlayerNotFound, r.Player.TGID)
 		}
+		ratings[i] = rating
+		places[i] = r.Place
 	}
 
-	return nil
+	updated := CalculateElo(ratings, places)
+	changes := make([]storage.RatingChange, len(results))
+	for i := range results {
+		results[i].RatingBefore = ratings[i]
+		results[i].RatingAfter = updated[i]
+		changes[i] = storage.RatingChange{
+			GameID: gameID,
+			TGID:   results[i].Player.TGID,
+			Before: ratings[i],
+			After:  updated[i],
+		}
+	}
+	return tx.SaveRatingChanges(ctx, chatID, changes)
 }
 
-// GetLeaderboard - получение текущего рейтинга всех игроков
-func (g *GameService) GetLeaderboard() ([]storage.Player, error) {
-	players, err := g.storage.GetAllPlayers(g.ctx)
+// GetLeaderboard - получение текущего рейтинга всех игроков чата
+func (g *GameService) GetLeaderboard(ctx context.Context, chatID int64, order LeaderboardOrder) ([]storage.Player, error) {
+	players, err := g.storage.GetAllPlayers(ctx, chatID)
 	if err != nil {
 		return nil, err
 	}
-	// Сортировка по очкам
-	for i := 0; i < len(players); i++ {
-		for j := i + 1; j < len(players); j++ {
-			if players[j].Score > players[i].Score {
-				players[i], players[j] = players[j], players[i]
-			}
+	// Сортировка по очкам или по рейтингу Эло
+	sort.SliceStable(players, func(i, j int) bool {
+		if order == ByRating {
+			return players[i].Rating > players[j].Rating
 		}
-	}
+		return players[i].Score > players[j].Score
+	})
 	return players, nil
 }
 
-// GetAllPlayers возвращает всех игроков из хранилища.
-func (g *GameService) GetAllPlayers() ([]storage.Player, error) {
-	return g.storage.GetAllPlayers(g.ctx)
+// GetAllPlayers возвращает всех игроков чата из хранилища.
+func (g *GameService) GetAllPlayers(ctx context.Context, chatID int64) ([]storage.Player, error) {
+	return g.storage.GetAllPlayers(ctx, chatID)
 }
 
-// GetPlayerByTGID возвращает игрока по его TGID.
-func (g *GameService) GetPlayerByTGID(tgID int64) (*storage.Player, error) {
-	return g.storage.GetPlayerByTGID(g.ctx, tgID)
+// GetPlayerByTGID возвращает игрока чата по его TGID.
+func (g *GameService) GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error) {
+	return g.storage.GetPlayerByTGID(ctx, chatID, tgID)
 }
 
 // GetPlayerScore - для record
-func (g *GameService) GetPlayerScore(tgID int64) (int, error) {
-	player, err := g.storage.GetPlayerByTGID(g.ctx, tgID)
+func (g *GameService) GetPlayerScore(ctx context.Context, chatID int64, tgID int64) (int, error) {
+	player, err := g.storage.GetPlayerByTGID(ctx, chatID, tgID)
 	if err != nil {
 		return 0, err
 	}
 	return player.Score, nil
 }
 
+// GetPlayerStats возвращает статистику игрока чата.
+func (g *GameService) GetPlayerStats(ctx context.Context, chatID int64, tgID int64) (*PlayerStats, error) {
+	return g.stats.PlayerStats(ctx, chatID, tgID)
+}
+
+// GetHeadToHead сравнивает двух игроков чата по общим играм.
+func (g *GameService) GetHeadToHead(ctx context.Context, chatID int64, a, b int64) (*HeadToHead, error) {
+	return g.stats.HeadToHead(ctx, chatID, a, b)
+}
+
+// --- Scoring ---
+
+// AvailableScorings возвращает стратегии подсчёта очков, из которых может выбрать чат.
+func (g *GameService) AvailableScorings() []ScoringStrategy {
+	return g.scorings
+}
+
+// GetScoring возвращает текущую стратегию подсчёта очков чата.
+func (g *GameService) GetScoring(ctx context.Context, chatID int64) (ScoringStrategy, error) {
+	name, err := g.storage.GetChatScoring(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScoring(name)
+}
+
+// SetScoring выбирает стратегию подсчёта очков для чата.
+func (g *GameService) SetScoring(ctx context.Context, chatID int64, name string) error {
+	for _, s := range g.scorings {
+		if s.Name() == name {
+			return g.storage.SetChatScoring(ctx, chatID, name)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownScoring, name)
+}
+
+// --- Rating ---
+
+// GetRatingHistory возвращает последние изменения рейтинга Эло игрока в чате.
+func (g *GameService) GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]storage.RatingChange, error) {
+	return g.storage.GetRatingHistory(ctx, chatID, tgID, limit)
+}
+
+// GetGlickoRatings рассчитывает рейтинги Glicko-2 игроков чата по всем сохраненным играм.
+func (g *GameService) GetGlickoRatings(ctx context.Context, chatID int64) ([]GlickoRating, error) {
+	results, err := g.storage.LoadAllGames(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return CalculateGlicko(results, time.Now(), g.ratingPeriod), nil
+}
+
 // --- Session Management ---
 
-// StartRecordingSession начинает новую сессию записи.
-func (g *GameService) StartRecordingSession(chatID int64, messageID int64) error {
-	return g.storage.CreateRecordingSession(g.ctx, chatID, messageID)
+// DefaultSessionTTL - через сколько после последнего действия по умолчанию истекает брошенная сессия записи.
+const DefaultSessionTTL = time.Hour
+
+// StartRecordingSession начинает новую сессию записи в сообщении messageID от имени ownerTGID.
+func (g *GameService) StartRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error {
+	return g.storage.CreateRecordingSession(ctx, chatID, messageID, ownerTGID)
 }
 
-// GetRecordingSession возвращает активную сессию.
-func (g *GameService) GetRecordingSession(chatID int64) (*storage.RecordingSession, error) {
-	session, err := g.storage.GetRecordingSession(g.ctx, chatID)
+// GetRecordingSession возвращает активную сессию сообщения messageID. Истекшая сессия считается
+// отсутствующей, даже если ее еще не удалил ExpireRecordingSessions.
+func (g *GameService) GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*storage.RecordingSession, error) {
+	session, err := g.storage.GetRecordingSession(ctx, chatID, messageID)
 	if err != nil {
 		return nil, err
 	}
-	if session == nil {
+	if session == nil || time.Since(session.UpdatedAt) > g.sessionTTL {
 		return nil, ErrSessionNotFound
 	}
 	return session, nil
 }
 
 // AddPlayerToRecording добавляет игрока в сессию и возвращает обновленный список игроков.
-func (g *GameService) AddPlayerToRecording(chatID int64, playerTgID int64) ([]storage.Player, error) {
-	err := g.storage.AddPlayerToSession(g.ctx, chatID, playerTgID)
+// Если tied, игрок делит место с последним выбранным. Когда из состава остается один игрок,
+// он может встать на следующее место сам, см. GameConfig.AutoPlaceLast.
+func (g *GameService) AddPlayerToRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) ([]storage.SessionPlayer, error) {
+	lineup, err := g.checkPlacement(ctx, chatID, messageID, playerTgID)
+	if err != nil {
+		return nil, err
+	}
+	err = g.storage.AddPlayerToSession(ctx, chatID, messageID, playerTgID, tied)
+	if err != nil {
+		return nil, err
+	}
+	return g.placeLastRemaining(ctx, chatID, messageID, lineup)
+}
+
+// AddDNFToRecording отмечает игрока выбывшим и возвращает обновленный список игроков.
+// Выбывший не занимает места среди доигравших.
+func (g *GameService) AddDNFToRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.SessionPlayer, error) {
+	lineup, err := g.checkPlacement(ctx, chatID, messageID, playerTgID)
+	if err != nil {
+		return nil, err
+	}
+	err = g.storage.AddDNFToSession(ctx, chatID, messageID, playerTgID)
+	if err != nil {
+		return nil, err
+	}
+	return g.placeLastRemaining(ctx, chatID, messageID, lineup)
+}
+
+// RemovePlayerFromRecording убирает игрока из сессии и возвращает обновленный список игроков.
+func (g *GameService) RemovePlayerFromRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.SessionPlayer, error) {
+	err := g.storage.RemovePlayerFromSession(ctx, chatID, messageID, playerTgID)
 	if err != nil {
 		return nil, err
 	}
-	return g.storage.GetSessionPlayers(g.ctx, chatID)
+	return g.storage.GetSessionPlayers(ctx, chatID, messageID)
+}
+
+// RemoveLastPlayerFromRecording отменяет последний выбор в сессии: убирает игрока, выбранного
+// последним (в том числе выбывшего), независимо от его места, и возвращает обновленный список игроков.
+func (g *GameService) RemoveLastPlayerFromRecording(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error) {
+	tgID, err := g.storage.GetLastSelectedPlayer(ctx, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if tgID == 0 {
+		return g.storage.GetSessionPlayers(ctx, chatID, messageID)
+	}
+	return g.RemovePlayerFromRecording(ctx, chatID, messageID, tgID)
+}
+
+// SwapRecordingPlayers меняет местами двух игроков сессии и возвращает обновленный список игроков.
+func (g *GameService) SwapRecordingPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) ([]storage.SessionPlayer, error) {
+	err := g.storage.SwapSessionPlayers(ctx, chatID, messageID, firstTgID, secondTgID)
+	if err != nil {
+		return nil, err
+	}
+	return g.storage.GetSessionPlayers(ctx, chatID, messageID)
+}
+
+// GetRecordingPlayers возвращает игроков сессии в порядке мест.
+func (g *GameService) GetRecordingPlayers(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error) {
+	return g.storage.GetSessionPlayers(ctx, chatID, messageID)
 }
 
 // FinishRecording завершает сессию: сохраняет результаты и удаляет сессию.
-func (g *GameService) FinishRecording(chatID int64) ([]storage.Player, error) {
-	players, err := g.storage.GetSessionPlayers(g.ctx, chatID)
+// Если в сессии нет игроков, возвращает nil. Места должны быть выбраны всему составу игры.
+func (g *GameService) FinishRecording(ctx context.Context, chatID int64, messageID int64) (*storage.Game, error) {
+	players, err := g.storage.GetSessionPlayers(ctx, chatID, messageID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session players: %w", err)
 	}
 
 	if len(players) == 0 {
-		return players, nil // Ничего не делаем, если игроков нет
+		return nil, nil // Ничего не делаем, если игроков нет
 	}
 
-	if err := g.RecordGame(players); err != nil {
-		return nil, fmt.Errorf("failed to record game: %w", err)
+	lineup, err := g.storage.GetSessionLineup(ctx, chatID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session lineup: %w", err)
+	}
+	if remaining := unplacedPlayers(lineup, players); len(remaining) > 0 {
+		return nil, fmt.Errorf("%w: %d left", ErrLineupIncomplete, len(remaining))
 	}
 
-	if err := g.storage.DeleteRecordingSession(g.ctx, chatID); err != nil {
-		// Логируем, но не возвращаем ошибку, т.к. игра уже записана
-		log.Printf("failed to delete recording session for chat %d: %v", chatID, err)
+	// Записавшим игру считается тот, кто начал сессию
+	var recordedBy int64
+	session, err := g.storage.GetRecordingSession(ctx, chatID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recording session: %w", err)
+	}
+	if session != nil {
+		recordedBy = session.OwnerTGID
 	}
 
-	return players, nil
+	// Игра записывается и сессия удаляется атомарно: либо всё, либо ничего
+	game, err := g.recordGame(ctx, chatID, players, messageID, recordedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record game: %w", err)
+	}
+
+	return game, nil
 }
 
 // CancelRecording отменяет и удаляет сессию записи.
-func (g *GameService) CancelRecording(chatID int64) error {
-	return g.storage.DeleteRecordingSession(g.ctx, chatID)
-}
\ No newline at end of file
+func (g *GameService) CancelRecording(ctx context.Context, chatID int64, messageID int64) error {
+	return g.storage.DeleteRecordingSession(ctx, chatID, messageID)
+}
+
+// ExpireRecordingSessions удаляет во всех чатах сессии записи, в которых ничего не происходило
+// дольше SessionTTL, и возвращает их, чтобы закрыть их сообщения.
+func (g *GameService) ExpireRecordingSessions(ctx context.Context) ([]storage.RecordingSession, error) {
+	return g.storage.DeleteExpiredSessions(ctx, time.Now().Add(-g.sessionTTL))
+}
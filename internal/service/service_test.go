@@ -3,75 +3,350 @@ package service
 import (
 	"context"
 	"errors"
+	"maps"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
 )
 
 // mockStorage - это мок-реализация StorageInterface для тестов.
 type mockStorage struct {
-	playersExist    bool
-	playerExistsErr error
-	saveResultsErr  error
+	playersExist      bool
+	playerExistsErr   error
+	saveResultsErr    error
+	scoring           string
+	players           []storage.Player
+	ratingChanges     []storage.RatingChange
+	games             []storage.GameResult
+	activeSeason      *storage.Season
+	seasons           []storage.Season
+	endedSeasonID     int
+	lastGame          *storage.Game
+	deletedGameID     int
+	session           *storage.RecordingSession
+	expiredBefore     time.Time
+	sessionPlayers    []storage.SessionPlayer
+	updatedResults    []storage.GameResult
+	replacedRatings   []storage.RatingChange
+	savedResults      []storage.GameResult
+	scores            map[int64]int
+	updateScoreErr    error
+	commits           int
+	fullGames         []storage.Game
+	fixedResults      []storage.GameResult
+	gameConfig        *storage.GameConfig
+	lineup            []storage.Player
+	recordedBy        int64
+	replaceRatingsErr error
+	selected          []int64 // порядок выбора игроков сессии
+	seasonGames       map[int64]int
 }
 
-func (m *mockStorage) PlayerExists(ctx context.Context, tgID int64) (bool, error) {
+func (m *mockStorage) PlayerExists(ctx context.Context, chatID int64, tgID int64) (bool, error) {
 	return false, nil
 }
-func (m *mockStorage) AddPlayer(ctx context.Context, tgID int64, username, displayName string) error {
+func (m *mockStorage) AddPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error {
 	return nil
 }
-func (m *mockStorage) CheckPlayersExist(ctx context.Context, tgIDs []int64) (bool, error) {
+func (m *mockStorage) CheckPlayersExist(ctx context.Context, chatID int64, tgIDs []int64) (bool, error) {
 	return m.playersExist, m.playerExistsErr
 }
 func (m *mockStorage) SaveGameResults(ctx context.Context, results []storage.GameResult) error {
-	return m.saveResultsErr
+	if m.saveResultsErr != nil {
+		return m.saveResultsErr
+	}
+	m.savedResults = append(m.savedResults, results...)
+	return nil
+}
+func (m *mockStorage) UpdatePlayerScore(ctx context.Context, chatID int64, tgID int64, pointsToAdd int) error {
+	if m.updateScoreErr != nil {
+		return m.updateScoreErr
+	}
+	if m.scores == nil {
+		m.scores = make(map[int64]int)
+	}
+	m.scores[tgID] += pointsToAdd
+	return nil
+}
+func (m *mockStorage) GetAllPlayers(ctx context.Context, chatID int64) ([]storage.Player, error) {
+	return m.players, nil
+}
+func (m *mockStorage) GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error) {
+	for _, p := range m.players {
+		if p.TGID == tgID {
+			return &p, nil
+		}
+	}
+	return nil, errors.New("player not found")
+}
+func (m *mockStorage) CreateGame(ctx context.Context, chatID int64, scoring string, recordedBy int64) (int, error) {
+	m.recordedBy = recordedBy
+	return 1, nil
+}
+func (m *mockStorage) GetChatScoring(ctx context.Context, chatID int64) (string, error) {
+	return m.scoring, nil
+}
+func (m *mockStorage) SetChatScoring(ctx context.Context, chatID int64, scoring string) error {
+	m.scoring = scoring
+	return nil
+}
+func (m *mockStorage) GetChatGameConfig(ctx context.Context, chatID int64) (*storage.GameConfig, error) {
+	return m.gameConfig, nil
 }
-func (m *mockStorage) UpdatePlayerScore(ctx context.Context, tgID int64, pointsToAdd int) error {
+func (m *mockStorage) SetChatGameConfig(ctx context.Context, chatID int64, cfg storage.GameConfig) error {
+	m.gameConfig = &cfg
 	return nil
 }
-func (m *mockStorage) GetAllPlayers(ctx context.Context) ([]storage.Player, error) {
+func (m *mockStorage) SaveRatingChanges(ctx context.Context, chatID int64, changes []storage.RatingChange) error {
+	m.ratingChanges = append(m.ratingChanges, changes...)
+	return nil
+}
+func (m *mockStorage) GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]storage.RatingChange, error) {
 	return nil, nil
 }
-func (m *mockStorage) GetPlayerByTGID(ctx context.Context, tgID int64) (*storage.Player, error) {
+func (m *mockStorage) LoadAllGames(ctx context.Context, chatID int64) ([]storage.GameResult, error) {
+	return m.games, nil
+}
+func (m *mockStorage) LoadGamesByYear(ctx context.Context, chatID int64, year int) ([]storage.GameResult, error) {
+	var results []storage.GameResult
+	for _, r := range m.games {
+		if r.Date.Year() == year {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+func (m *mockStorage) CreateSeason(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	season := storage.Season{ID: len(m.seasons) + 1, ChatID: chatID, Name: name}
+	m.seasons = append(m.seasons, season)
+	m.activeSeason = &season
+	return &season, nil
+}
+func (m *mockStorage) GetActiveSeason(ctx context.Context, chatID int64) (*storage.Season, error) {
+	return m.activeSeason, nil
+}
+func (m *mockStorage) GetSeasonByName(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	for _, season := range m.seasons {
+		if season.Name == name {
+			return &season, nil
+		}
+	}
 	return nil, nil
 }
-func (m *mockStorage) CreateGame(ctx context.Context) (int, error) {
-	return 1, nil
+func (m *mockStorage) ListSeasons(ctx context.Context, chatID int64) ([]storage.Season, error) {
+	return m.seasons, nil
 }
-func (m *mockStorage) CreateRecordingSession(ctx context.Context, chatID int64, messageID int64) error {
+func (m *mockStorage) EndSeason(ctx context.Context, chatID int64, seasonID int) error {
+	m.endedSeasonID = seasonID
+	m.activeSeason = nil
 	return nil
 }
-func (m *mockStorage) GetRecordingSession(ctx context.Context, chatID int64) (*storage.RecordingSession, error) {
+func (m *mockStorage) GetSeasonStandings(ctx context.Context, seasonID int) ([]storage.SeasonStanding, error) {
 	return nil, nil
 }
-func (m *mockStorage) AddPlayerToSession(ctx context.Context, chatID int64, playerTgID int64) error {
+func (m *mockStorage) GetSeasonGameCounts(ctx context.Context, seasonID int) (map[int64]int, error) {
+	return m.seasonGames, nil
+}
+func (m *mockStorage) GetGame(ctx context.Context, chatID int64, gameID int) (*storage.Game, error) {
+	if m.lastGame != nil && m.lastGame.ID == gameID {
+		return m.lastGame, nil
+	}
+	return nil, nil
+}
+func (m *mockStorage) GetLastGame(ctx context.Context, chatID int64) (*storage.Game, error) {
+	return m.lastGame, nil
+}
+func (m *mockStorage) ListGames(ctx context.Context, chatID int64, offset, limit int) ([]storage.Game, int, error) {
+	return nil, 0, nil
+}
+func (m *mockStorage) LoadGamesSince(ctx context.Context, chatID int64, since time.Time) ([]storage.Game, error) {
+	var games []storage.Game
+	for _, g := range m.fullGames {
+		if g.CreatedAt.After(since) {
+			games = append(games, g)
+		}
+	}
+	return games, nil
+}
+func (m *mockStorage) SetResultPoints(ctx context.Context, gameID int, tgID int64, points int) error {
+	m.fixedResults = append(m.fixedResults, storage.GameResult{GameID: gameID, Player: storage.Player{TGID: tgID}, Points: points})
+	return nil
+}
+func (m *mockStorage) DeleteGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) error {
+	m.deletedGameID = gameID
 	return nil
 }
-func (m *mockStorage) GetSessionPlayers(ctx context.Context, chatID int64) ([]storage.Player, error) {
+func (m *mockStorage) UpdateGameResults(ctx context.Context, chatID int64, gameID int, results []storage.GameResult, editorTGID int64) error {
+	m.updatedResults = results
+	return nil
+}
+func (m *mockStorage) GetGameVersions(ctx context.Context, gameID int) ([]storage.GameVersion, error) {
 	return nil, nil
 }
-func (m *mockStorage) DeleteRecordingSession(ctx context.Context, chatID int64) error {
+func (m *mockStorage) ReplaceRatings(ctx context.Context, chatID int64, history []storage.RatingChange, initial float64) error {
+	if m.replaceRatingsErr != nil {
+		return m.replaceRatingsErr
+	}
+	m.replacedRatings = history
+	return nil
+}
+func (m *mockStorage) CreateRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error {
+	return nil
+}
+func (m *mockStorage) GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*storage.RecordingSession, error) {
+	if m.session == nil || m.session.MessageID != messageID {
+		return nil, nil
+	}
+	return m.session, nil
+}
+func (m *mockStorage) AddPlayerToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) error {
+	n := countPlaced(m.sessionPlayers)
+	place := n + 1
+	if tied && n > 0 {
+		place = m.sessionPlayers[n-1].Place
+	}
+	m.sessionPlayers = slices.Insert(m.sessionPlayers, n, storage.SessionPlayer{Player: storage.Player{TGID: playerTgID}, Place: place})
+	m.selected = append(m.selected, playerTgID)
+	return nil
+}
+func (m *mockStorage) AddDNFToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	m.sessionPlayers = append(m.sessionPlayers, storage.SessionPlayer{Player: storage.Player{TGID: playerTgID}, DNF: true})
+	m.selected = append(m.selected, playerTgID)
+	return nil
+}
+func (m *mockStorage) GetLastSelectedPlayer(ctx context.Context, chatID int64, messageID int64) (int64, error) {
+	if len(m.selected) > 0 {
+		return m.selected[len(m.selected)-1], nil
+	}
+	// Игроки, заданные в тесте напрямую, считаются выбранными по порядку
+	if len(m.sessionPlayers) > 0 {
+		return m.sessionPlayers[len(m.sessionPlayers)-1].Player.TGID, nil
+	}
+	return 0, nil
+}
+func (m *mockStorage) GetSessionPlayers(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error) {
+	return m.sessionPlayers, nil
+}
+func (m *mockStorage) RemovePlayerFromSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	m.sessionPlayers = slices.DeleteFunc(m.sessionPlayers, func(p storage.SessionPlayer) bool { return p.Player.TGID == playerTgID })
+	m.selected = slices.DeleteFunc(m.selected, func(id int64) bool { return id == playerTgID })
+	return nil
+}
+func (m *mockStorage) SwapSessionPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) error {
+	i := slices.IndexFunc(m.sessionPlayers, func(p storage.SessionPlayer) bool { return p.Player.TGID == firstTgID })
+	j := slices.IndexFunc(m.sessionPlayers, func(p storage.SessionPlayer) bool { return p.Player.TGID == secondTgID })
+	if i >= 0 && j >= 0 {
+		m.sessionPlayers[i].Player, m.sessionPlayers[j].Player = m.sessionPlayers[j].Player, m.sessionPlayers[i].Player
+	}
+	return nil
+}
+func (m *mockStorage) CreateEditSession(ctx context.Context, chatID int64, messageID int64, gameID int, ownerTGID int64, players []storage.SessionPlayer) error {
+	now := time.Now()
+	m.session = &storage.RecordingSession{ChatID: chatID, MessageID: messageID, EditGameID: gameID, OwnerTGID: ownerTGID, CreatedAt: now, UpdatedAt: now}
+	return nil
+}
+func (m *mockStorage) AddPlayerToLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	m.lineup = append(m.lineup, storage.Player{TGID: playerTgID})
+	return nil
+}
+func (m *mockStorage) RemovePlayerFromLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	m.lineup = slices.DeleteFunc(m.lineup, func(p storage.Player) bool { return p.TGID == playerTgID })
+	return nil
+}
+func (m *mockStorage) GetSessionLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	return m.lineup, nil
+}
+func (m *mockStorage) SetLineupOpen(ctx context.Context, chatID int64, messageID int64, open bool) error {
+	if m.session != nil {
+		m.session.LineupOpen = open
+	}
+	return nil
+}
+func (m *mockStorage) DeleteRecordingSession(ctx context.Context, chatID int64, messageID int64) error {
+	m.session = nil
+	m.sessionPlayers = nil
+	m.selected = nil
+	m.lineup = nil
+	return nil
+}
+func (m *mockStorage) DeleteExpiredSessions(ctx context.Context, before time.Time) ([]storage.RecordingSession, error) {
+	m.expiredBefore = before
+	if m.session == nil || !m.session.UpdatedAt.Before(before) {
+		return nil, nil
+	}
+	expired := *m.session
+	m.session = nil
+	m.sessionPlayers = nil
+	return []storage.RecordingSession{expired}, nil
+}
+
+// countPlaced возвращает число доигравших игроков сессии.
+func countPlaced(players []storage.SessionPlayer) int {
+	count := 0
+	for _, p := range players {
+		if !p.DNF {
+			count++
+		}
+	}
+	return count
+}
+
+// inOrder возвращает игроков сессии на местах по порядку, без дележа.
+func inOrder(players ...storage.Player) []storage.SessionPlayer {
+	placed := make([]storage.SessionPlayer, len(players))
+	for i, p := range players {
+		placed[i] = storage.SessionPlayer{Player: p, Place: i + 1}
+	}
+	return placed
+}
+
+// WithTx имитирует транзакцию: fn работает с копией хранилища, которая
+// заменяет исходное, только если fn завершилась без ошибки.
+func (m *mockStorage) WithTx(ctx context.Context, fn func(tx storage.Tx) error) error {
+	tx := *m
+	tx.savedResults = slices.Clone(m.savedResults)
+	tx.ratingChanges = slices.Clone(m.ratingChanges)
+	tx.sessionPlayers = slices.Clone(m.sessionPlayers)
+	tx.selected = slices.Clone(m.selected)
+	tx.scores = maps.Clone(m.scores)
+	tx.fixedResults = slices.Clone(m.fixedResults)
+	if err := fn(&tx); err != nil {
+		return err
+	}
+	tx.commits++
+	*m = tx
 	return nil
 }
 
 func TestGameService_RecordGame_Success(t *testing.T) {
 	// Arrange
+	players := []storage.Player{
+		{TGID: 1, DisplayName: "Player1", Rating: InitialRating},
+		{TGID: 2, DisplayName: "Player2", Rating: InitialRating},
+	}
 	mockStore := &mockStorage{
 		playersExist: true,
+		players:      players,
 	}
-	gameService := New(mockStore)
-	players := []storage.Player{
-		{TGID: 1, DisplayName: "Player1"},
-		{TGID: 2, DisplayName: "Player2"},
-	}
+	gameService := New(mockStore, Config{})
 
 	// Act
-	err := gameService.RecordGame(players)
+	game, err := gameService.RecordGame(context.Background(), 100, players)
 
 	// Assert
 	if err != nil {
-		t.Errorf("Ожидалась ошибка nil, получено: %v", err)
+		t.Fatalf("Ожидалась ошибка nil, получено: %v", err)
+	}
+	if len(game.Results) != 2 || game.Results[0].Points != 2 || game.Results[1].Points != 1 {
+		t.Errorf("Неверные результаты игры: %+v", game.Results)
+	}
+	if len(mockStore.ratingChanges) != 2 {
+		t.Fatalf("Ожидалось 2 изменения рейтинга, получено %d", len(mockStore.ratingChanges))
+	}
+	if game.Results[0].RatingAfter <= InitialRating || game.Results[1].RatingAfter >= InitialRating {
+		t.Errorf("Победитель должен получить рейтинг, проигравший - потерять: %+v", game.Results)
 	}
 }
 
@@ -80,17 +355,166 @@ func TestGameService_RecordGame_PlayerNotFound(t *testing.T) {
 	mockStore := &mockStorage{
 		playersExist: false,
 	}
-	gameService := New(mockStore)
+	gameService := New(mockStore, Config{})
 	players := []storage.Player{
 		{TGID: 1, DisplayName: "Player1"},
 		{TGID: 99, DisplayName: "NonExistentPlayer"},
 	}
 
 	// Act
-	err := gameService.RecordGame(players)
+	_, err := gameService.RecordGame(context.Background(), 100, players)
 
 	// Assert
 	if !errors.Is(err, ErrPlayerNotFound) {
 		t.Errorf("Ожидалась ошибка ErrPlayerNotFound, получено: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestGameService_RecordGame_Atomic(t *testing.T) {
+	players := []storage.Player{
+		{TGID: 1, DisplayName: "Player1", Rating: InitialRating},
+		{TGID: 2, DisplayName: "Player2", Rating: InitialRating},
+	}
+
+	t.Run("все изменения фиксируются вместе", func(t *testing.T) {
+		mockStore := &mockStorage{
+			playersExist:   true,
+			players:        players,
+			session:        &storage.RecordingSession{ChatID: 100, MessageID: 1, OwnerTGID: 7},
+			sessionPlayers: inOrder(players...),
+		}
+		gameService := New(mockStore, Config{})
+
+		if _, err := gameService.FinishRecording(context.Background(), 100, 1); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if mockStore.recordedBy != 7 {
+			t.Errorf("записавшим игру должен быть владелец сессии, получено %d", mockStore.recordedBy)
+		}
+		if mockStore.commits != 1 {
+			t.Errorf("ожидалась одна транзакция, получено %d", mockStore.commits)
+		}
+		if len(mockStore.savedResults) != 2 || mockStore.scores[1] != 2 || mockStore.scores[2] != 1 {
+			t.Errorf("результаты или очки не сохранены: %+v, %v", mockStore.savedResults, mockStore.scores)
+		}
+		if len(mockStore.ratingChanges) != 2 {
+			t.Errorf("ожидалось 2 изменения рейтинга, получено %d", len(mockStore.ratingChanges))
+		}
+		if mockStore.sessionPlayers != nil {
+			t.Error("сессия записи должна быть удалена")
+		}
+	})
+
+	t.Run("ошибка обновления очков откатывает всю запись", func(t *testing.T) {
+		mockStore := &mockStorage{
+			playersExist:   true,
+			players:        players,
+			sessionPlayers: inOrder(players...),
+			updateScoreErr: errors.New("connection reset"),
+		}
+		gameService := New(mockStore, Config{})
+
+		if _, err := gameService.FinishRecording(context.Background(), 100, 1); err == nil {
+			t.Fatal("ожидалась ошибка")
+		}
+		if mockStore.commits != 0 || len(mockStore.savedResults) != 0 || len(mockStore.ratingChanges) != 0 {
+			t.Errorf("после ошибки ничего не должно сохраниться: %+v", mockStore)
+		}
+		if len(mockStore.sessionPlayers) != 2 {
+			t.Error("сессия записи должна остаться, чтобы можно было повторить")
+		}
+	})
+}
+
+func TestGameService_RecordingSessionExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("активная сессия возвращается", func(t *testing.T) {
+		mockStore := &mockStorage{session: &storage.RecordingSession{ChatID: 100, MessageID: 7, UpdatedAt: time.Now().Add(-50 * time.Minute)}}
+		gameService := New(mockStore, Config{})
+
+		session, err := gameService.GetRecordingSession(ctx, 100, 7)
+		if err != nil || session.MessageID != 7 {
+			t.Errorf("ожидалась сессия сообщения 7, получено %+v, %v", session, err)
+		}
+	})
+
+	t.Run("истекшая сессия не возвращается", func(t *testing.T) {
+		mockStore := &mockStorage{session: &storage.RecordingSession{ChatID: 100, MessageID: 7, UpdatedAt: time.Now().Add(-11 * time.Minute)}}
+		gameService := New(mockStore, Config{SessionTTL: 10 * time.Minute})
+
+		if _, err := gameService.GetRecordingSession(ctx, 100, 7); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("ожидалась ошибка ErrSessionNotFound, получено: %v", err)
+		}
+	})
+
+	t.Run("истекшие сессии удаляются", func(t *testing.T) {
+		mockStore := &mockStorage{
+			session:        &storage.RecordingSession{ChatID: 100, MessageID: 7, UpdatedAt: time.Now().Add(-2 * time.Hour)},
+			sessionPlayers: inOrder(storage.Player{TGID: 1}),
+		}
+		gameService := New(mockStore, Config{})
+
+		expired, err := gameService.ExpireRecordingSessions(ctx)
+		if err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if len(expired) != 1 || expired[0].MessageID != 7 {
+			t.Errorf("ожидалась истекшая сессия сообщения 7, получено %+v", expired)
+		}
+		if mockStore.session != nil || mockStore.sessionPlayers != nil {
+			t.Error("истекшая сессия должна быть удалена вместе с игроками")
+		}
+		if age := time.Since(mockStore.expiredBefore); age < DefaultSessionTTL || age > DefaultSessionTTL+time.Minute {
+			t.Errorf("сессии должны истекать через DefaultSessionTTL, граница %v назад", age)
+		}
+	})
+}
+
+func TestGameService_RemoveLastPlayerFromRecording(t *testing.T) {
+	ctx := context.Background()
+	mockStore := &mockStorage{sessionPlayers: inOrder(storage.Player{TGID: 1}, storage.Player{TGID: 2}, storage.Player{TGID: 3})}
+	gameService := New(mockStore, Config{})
+
+	players, err := gameService.RemoveLastPlayerFromRecording(ctx, 100, 7)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if len(players) != 2 || players[1].Player.TGID != 2 {
+		t.Errorf("должен убираться последний выбранный игрок, осталось %+v", players)
+	}
+
+	// Убирается последний выбранный, а не игрок на последнем месте: сначала выбывший,
+	// потом игрок, которого обмен поднял на первое место
+	mockStore.sessionPlayers = nil
+	for _, id := range []int64{1, 2, 3} {
+		if _, err := gameService.AddPlayerToRecording(ctx, 100, 7, id, false); err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+	}
+	if _, err := gameService.SwapRecordingPlayers(ctx, 100, 7, 1, 3); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if _, err := gameService.AddDNFToRecording(ctx, 100, 7, 4); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	for _, want := range [][]int64{{3, 2, 1}, {2, 1}} {
+		players, err = gameService.RemoveLastPlayerFromRecording(ctx, 100, 7)
+		if err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		var ids []int64
+		for _, p := range players {
+			ids = append(ids, p.Player.TGID)
+		}
+		if !slices.Equal(ids, want) {
+			t.Errorf("ожидались игроки %v, получено %v", want, ids)
+		}
+	}
+
+	// В пустой сессии убирать нечего
+	mockStore.sessionPlayers = nil
+	if players, err := gameService.RemoveLastPlayerFromRecording(ctx, 100, 7); err != nil || len(players) != 0 {
+		t.Errorf("ожидался пустой список, получено %+v, %v", players, err)
+	}
+}
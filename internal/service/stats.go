@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+const (
+	// statsRecentGames - сколько последних игр показывается в профиле.
+	statsRecentGames = 10
+	// statsTopOpponents - сколько любимых соперников показывается в профиле.
+	statsTopOpponents = 3
+)
+
+// StatsStorage - данные, которые нужны сервису статистики.
+type StatsStorage interface {
+	GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error)
+	LoadAllGames(ctx context.Context, chatID int64) ([]storage.GameResult, error)
+}
+
+// PlayerStats - статистика игрока в чате.
+type PlayerStats struct {
+	Player        storage.Player
+	Games         int
+	Wins          int
+	Podiums       int     // сколько раз игрок был в первой тройке
+	DNFs          int     // сколько раз игрок выбыл, не доиграв
+	AveragePlace  float64 // среднее место в играх, которые игрок доиграл
+	WinRate       float64 // доля побед, от 0 до 1
+	PointsPerGame float64
+	BestStreak    int // самая длинная серия побед подряд
+	WorstStreak   int // самая длинная серия игр без побед
+	Opponents     []OpponentStats
+	Recent        []PlayerGame // последние игры, начиная с последней
+}
+
+// OpponentStats - статистика встреч с одним соперником.
+type OpponentStats struct {
+	Player storage.Player
+	Games  int
+	Wins   int // сколько раз игрок занял место выше соперника
+}
+
+// PlayerGame - результат игрока в одной игре.
+type PlayerGame struct {
+	GameID  int
+	Date    time.Time
+	Place   int
+	Players int
+	Points  int
+	DNF     bool
+}
+
+// StatsService считает статистику игроков по результатам игр.
+type StatsService struct {
+	storage StatsStorage
+}
+
+func NewStatsService(storage StatsStorage) *StatsService {
+	return &StatsService{
+		storage: storage,
+	}
+}
+
+// PlayerStats возвращает статистику игрока чата.
+func (s *StatsService) PlayerStats(ctx context.Context, chatID int64, tgID int64) (*PlayerStats, error) {
+	player, err := s.storage.GetPlayerByTGID(ctx, chatID, tgID)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.storage.LoadAllGames(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	stats := CalculatePlayerStats(tgID, results)
+	stats.Player = *player
+	return stats, nil
+}
+
+// CalculatePlayerStats считает статистику игрока tgID по результатам игр.
+// results должны быть сгруппированы по игре в порядке записи, как их возвращает LoadAllGames.
+func CalculatePlayerStats(tgID int64, results []storage.GameResult) *PlayerStats {
+	stats := &PlayerStats{}
+	opponents := make(map[int64]*OpponentStats)
+	var games []PlayerGame
+	var placeSum, pointsSum, winStreak, dryStreak int
+
+	for start := 0; start < len(results); {
+		end := start
+		for end < len(results) && results[end].GameID == results[start].GameID {
+			end++
+		}
+		game := results[start:end]
+		start = end
+
+		var own *storage.GameResult
+		for i := range game {
+			if game[i].Player.TGID == tgID {
+				own = &game[i]
+				break
+			}
+		}
+		if own == nil {
+			continue
+		}
+
+		games = append(games, PlayerGame{
+			GameID:  own.GameID,
+			Date:    own.Date,
+			Place:   own.Place,
+			Players: len(game),
+			Points:  own.Points,
+			DNF:     own.DNF,
+		})
+		pointsSum += own.Points
+		if own.DNF {
+			stats.DNFs++
+		} else {
+			placeSum += own.Place
+			if own.Place <= 3 {
+				stats.Podiums++
+			}
+		}
+		if own.Place == 1 && !own.DNF {
+			stats.Wins++
+			winStreak++
+			dryStreak = 0
+		} else {
+			dryStreak++
+			winStreak = 0
+		}
+		stats.BestStreak = max(stats.BestStreak, winStreak)
+		stats.WorstStreak = max(stats.WorstStreak, dryStreak)
+
+		for _, r := range game {
+			if r.Player.TGID == tgID {
+				continue
+			}
+			o, ok := opponents[r.Player.TGID]
+			if !ok {
+				o = &OpponentStats{Player: r.Player}
+				opponents[r.Player.TGID] = o
+			}
+			o.Games++
+			if own.Place < r.Place {
+				o.Wins++
+			}
+		}
+	}
+
+	stats.Games = len(games)
+	if stats.Games == 0 {
+		return stats
+	}
+	if finished := stats.Games - stats.DNFs; finished > 0 {
+		stats.AveragePlace = float64(placeSum) / float64(finished)
+	}
+	stats.WinRate = float64(stats.Wins) / float64(stats.Games)
+	stats.PointsPerGame = float64(pointsSum) / float64(stats.Games)
+
+	for _, o := range opponents {
+		stats.Opponents = append(stats.Opponents, *o)
+	}
+	sort.Slice(stats.Opponents, func(i, j int) bool {
+		a, b := stats.Opponents[i], stats.Opponents[j]
+		if a.Games != b.Games {
+			return a.Games > b.Games
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.Player.TGID < b.Player.TGID
+	})
+	if len(stats.Opponents) > statsTopOpponents {
+		stats.Opponents = stats.Opponents[:statsTopOpponents]
+	}
+
+	for i := len(games) - 1; i >= 0 && len(stats.Recent) < statsRecentGames; i-- {
+		stats.Recent = append(stats.Recent, games[i])
+	}
+	return stats
+}
+
+// HeadToHead - сравнение двух игроков по играм, в которых они встречались.
+type HeadToHead struct {
+	PlayerA, PlayerB storage.Player
+	Games            int
+	WinsA, WinsB     int     // сколько раз игрок оказался выше соперника
+	Draws            int     // игры, где игроки разделили место
+	AvgPlaceDiff     float64 // среднее (место B - место A): больше нуля - A в среднем выше
+	PointsA, PointsB int     // сколько очков игрок набрал больше соперника в играх, где был выше
+	StreakLeader     int64   // TGID игрока, который выигрывает последние встречи подряд (0 - нет серии)
+	Streak           int
+}
+
+// HeadToHead сравнивает игроков a и b чата по всем играм, в которых участвовали оба.
+func (s *StatsService) HeadToHead(ctx context.Context, chatID int64, a, b int64) (*HeadToHead, error) {
+	playerA, err := s.storage.GetPlayerByTGID(ctx, chatID, a)
+	if err != nil {
+		return nil, err
+	}
+	playerB, err := s.storage.GetPlayerByTGID(ctx, chatID, b)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.storage.LoadAllGames(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	h2h := CalculateHeadToHead(a, b, results)
+	h2h.PlayerA, h2h.PlayerB = *playerA, *playerB
+	return h2h, nil
+}
+
+// CalculateHeadToHead сравнивает игроков a и b по результатам игр.
+// results должны быть сгруппированы по игре в порядке записи, как их возвращает LoadAllGames.
+func CalculateHeadToHead(a, b int64, results []storage.GameResult) *HeadToHead {
+	h2h := &HeadToHead{}
+	var placeDiff int
+
+	for start := 0; start < len(results); {
+		end := start
+		for end < len(results) && results[end].GameID == results[start].GameID {
+			end++
+		}
+		var ra, rb *storage.GameResult
+		for i := start; i < end; i++ {
+			switch results[i].Player.TGID {
+			case a:
+				ra = &results[i]
+			case b:
+				rb = &results[i]
+			}
+		}
+		start = end
+		if ra == nil || rb == nil {
+			continue
+		}
+
+		h2h.Games++
+		placeDiff += rb.Place - ra.Place
+
+		var winner int64
+		switch {
+		case ra.Place < rb.Place:
+			h2h.WinsA++
+			h2h.PointsA += ra.Points - rb.Points
+			winner = a
+		case rb.Place < ra.Place:
+			h2h.WinsB++
+			h2h.PointsB += rb.Points - ra.Points
+			winner = b
+		default:
+			h2h.Draws++
+		}
+		if winner != 0 && winner == h2h.StreakLeader {
+			h2h.Streak++
+		} else {
+			h2h.StreakLeader = winner
+			h2h.Streak = 0
+			if winner != 0 {
+				h2h.Streak = 1
+			}
+		}
+	}
+
+	if h2h.Games > 0 {
+		h2h.AvgPlaceDiff = float64(placeDiff) / float64(h2h.Games)
+	}
+	return h2h
+}
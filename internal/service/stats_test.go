@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+func TestStatsService_PlayerStats(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	carol := storage.Player{TGID: 3, DisplayName: "Carol"}
+	date := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	result := func(gameID int, p storage.Player, place, points int) storage.GameResult {
+		return storage.GameResult{GameID: gameID, Player: p, Place: place, Points: points, Date: date.AddDate(0, 0, gameID)}
+	}
+
+	mockStore := &mockStorage{
+		players: []storage.Player{alice, bob, carol},
+		games: []storage.GameResult{
+			result(1, alice, 1, 3), result(1, bob, 2, 2), result(1, carol, 3, 1),
+			result(2, alice, 1, 2), result(2, bob, 2, 1),
+			result(3, bob, 1, 2), result(3, alice, 2, 1),
+			result(4, bob, 1, 2), result(4, carol, 2, 1),
+			result(5, carol, 1, 3), result(5, bob, 2, 2), result(5, alice, 3, 1),
+		},
+	}
+	statsService := NewStatsService(mockStore)
+
+	stats, err := statsService.PlayerStats(context.Background(), 1, alice.TGID)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+
+	if stats.Player.DisplayName != "Alice" {
+		t.Errorf("ожидался игрок Alice, получен %q", stats.Player.DisplayName)
+	}
+	if stats.Games != 4 || stats.Wins != 2 || stats.Podiums != 4 {
+		t.Errorf("игры/победы/тройка: ожидалось 4/2/4, получено %d/%d/%d", stats.Games, stats.Wins, stats.Podiums)
+	}
+	if stats.AveragePlace != 1.75 {
+		t.Errorf("ожидалось среднее место 1.75, получено %.2f", stats.AveragePlace)
+	}
+	if stats.WinRate != 0.5 {
+		t.Errorf("ожидалась доля побед 0.5, получено %.2f", stats.WinRate)
+	}
+	if stats.PointsPerGame != 1.75 {
+		t.Errorf("ожидалось 1.75 очка за игру, получено %.2f", stats.PointsPerGame)
+	}
+	if stats.BestStreak != 2 || stats.WorstStreak != 2 {
+		t.Errorf("серии: ожидалось 2/2, получено %d/%d", stats.BestStreak, stats.WorstStreak)
+	}
+
+	if len(stats.Opponents) != 2 {
+		t.Fatalf("ожидалось 2 соперника, получено %d", len(stats.Opponents))
+	}
+	if o := stats.Opponents[0]; o.Player.TGID != bob.TGID || o.Games != 4 || o.Wins != 2 {
+		t.Errorf("первый соперник: ожидался Bob (4 игры, выше в 2), получено %+v", o)
+	}
+	if o := stats.Opponents[1]; o.Player.TGID != carol.TGID || o.Games != 2 || o.Wins != 1 {
+		t.Errorf("второй соперник: ожидалась Carol (2 игры, выше в 1), получено %+v", o)
+	}
+
+	if len(stats.Recent) != 4 {
+		t.Fatalf("ожидалось 4 последние игры, получено %d", len(stats.Recent))
+	}
+	if g := stats.Recent[0]; g.GameID != 5 || g.Place != 3 || g.Players != 3 || g.Points != 1 {
+		t.Errorf("последняя игра: ожидалась #5, 3 из 3, +1, получено %+v", g)
+	}
+}
+
+func TestCalculatePlayerStats_DNF(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	results := []storage.GameResult{
+		{GameID: 1, Player: alice, Place: 1, Points: 2}, {GameID: 1, Player: bob, Place: 2, Points: 1},
+		// Выбывшая Alice делит место после всех доигравших
+		{GameID: 2, Player: bob, Place: 1, Points: 1}, {GameID: 2, Player: alice, Place: 2, Points: -1, DNF: true},
+	}
+
+	stats := CalculatePlayerStats(alice.TGID, results)
+	if stats.Games != 2 || stats.DNFs != 1 || stats.Wins != 1 {
+		t.Errorf("игры/выбывания/победы: ожидалось 2/1/1, получено %d/%d/%d", stats.Games, stats.DNFs, stats.Wins)
+	}
+	if stats.AveragePlace != 1 || stats.Podiums != 1 {
+		t.Errorf("выбывание не должно учитываться в среднем месте и тройке, получено %.2f/%d", stats.AveragePlace, stats.Podiums)
+	}
+	if stats.PointsPerGame != 0.5 {
+		t.Errorf("штраф должен учитываться в очках за игру, получено %.2f", stats.PointsPerGame)
+	}
+	if !stats.Recent[0].DNF {
+		t.Errorf("последняя игра должна быть отмечена выбыванием: %+v", stats.Recent[0])
+	}
+}
+
+func TestStatsService_NoGames(t *testing.T) {
+	mockStore := &mockStorage{players: []storage.Player{{TGID: 1, DisplayName: "Alice"}}}
+
+	stats, err := NewStatsService(mockStore).PlayerStats(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if stats.Games != 0 || stats.WinRate != 0 || len(stats.Recent) != 0 {
+		t.Errorf("ожидалась пустая статистика, получено %+v", stats)
+	}
+}
+
+func TestStatsService_UnknownPlayer(t *testing.T) {
+	if _, err := NewStatsService(&mockStorage{}).PlayerStats(context.Background(), 1, 42); err == nil {
+		t.Error("ожидалась ошибка для игрока не из чата")
+	}
+}
+
+func TestCalculateHeadToHead(t *testing.T) {
+	alice := storage.Player{TGID: 1}
+	bob := storage.Player{TGID: 2}
+	carol := storage.Player{TGID: 3}
+	results := []storage.GameResult{
+		{GameID: 1, Player: bob, Place: 1, Points: 3}, {GameID: 1, Player: carol, Place: 2, Points: 2}, {GameID: 1, Player: alice, Place: 3, Points: 1},
+		{GameID: 2, Player: alice, Place: 1, Points: 2}, {GameID: 2, Player: carol, Place: 2, Points: 1},
+		{GameID: 3, Player: alice, Place: 1, Points: 3}, {GameID: 3, Player: carol, Place: 2, Points: 2}, {GameID: 3, Player: bob, Place: 3, Points: 1},
+		{GameID: 4, Player: alice, Place: 1, Points: 2}, {GameID: 4, Player: bob, Place: 2, Points: 1},
+	}
+
+	h2h := CalculateHeadToHead(alice.TGID, bob.TGID, results)
+
+	if h2h.Games != 3 || h2h.WinsA != 2 || h2h.WinsB != 1 || h2h.Draws != 0 {
+		t.Errorf("игры/победы: ожидалось 3, 2:1, получено %d, %d:%d", h2h.Games, h2h.WinsA, h2h.WinsB)
+	}
+	if want := (-2.0 + 2 + 1) / 3; h2h.AvgPlaceDiff != want {
+		t.Errorf("ожидалась средняя разница мест %.3f, получено %.3f", want, h2h.AvgPlaceDiff)
+	}
+	if h2h.PointsA != 3 || h2h.PointsB != 2 {
+		t.Errorf("отобранные очки: ожидалось 3:2, получено %d:%d", h2h.PointsA, h2h.PointsB)
+	}
+	if h2h.StreakLeader != alice.TGID || h2h.Streak != 2 {
+		t.Errorf("серия: ожидалась Alice x2, получено %d x%d", h2h.StreakLeader, h2h.Streak)
+	}
+}
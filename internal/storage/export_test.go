@@ -0,0 +1,12 @@
+package storage
+
+import "context"
+
+// Truncate очищает все таблицы хранилища, кроме schema_migrations. Только для тестов.
+func (s *Storage) Truncate(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx,
+		`TRUNCATE players, chat_players, chat_settings, games, game_results, rating_history,
+		 seasons, season_standings, game_audit, game_result_versions, recording_sessions, session_players
+		 RESTART IDENTITY CASCADE`)
+	return err
+}
@@ -0,0 +1,1348 @@
+// Package memory - хранилище в памяти процесса с той же семантикой, что и Postgres-хранилище.
+// Подходит для локального запуска без базы и для тестов; данные теряются при остановке.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+)
+
+// initialRating - рейтинг Эло нового игрока чата, как DEFAULT колонки chat_players.rating.
+const initialRating = 1500
+
+// ErrConstraint возвращается там, где Postgres нарушил бы ограничение схемы:
+// повторный ключ или ссылку на несуществующую запись.
+var ErrConstraint = errors.New("constraint violation")
+
+// Store - хранилище в памяти. Безопасно для одновременного использования.
+// Каждый изменяющий вызов применяется целиком или не применяется вовсе, как транзакция.
+type Store struct {
+	mu   *sync.RWMutex
+	data *data
+	// inTx - хранилище передано в функцию WithTx, блокировка уже взята.
+	inTx bool
+}
+
+// New создает пустое хранилище.
+func New() *Store {
+	return &Store{mu: &sync.RWMutex{}, data: newData()}
+}
+
+// data - "таблицы" хранилища. Строки хранятся по значению, чтобы копия для транзакции
+// получалась простым копированием карт и срезов.
+type data struct {
+	players        map[int64]playerRow
+	members        map[memberKey]memberRow
+	settings       map[int64]string
+	gameConfigs    map[int64]storage.GameConfig
+	games          map[int]gameRow
+	results        []resultRow
+	ratingHistory  []ratingRow
+	seasons        map[int]storage.Season
+	standings      []standingRow
+	audit          []auditRow
+	versions       []versionRow
+	sessions       map[sessionKey]sessionRow
+	sessionPlayers []sessionPlayerRow
+	sessionLineup  []lineupRow
+
+	nextGameID   int
+	nextSeasonID int
+	joinSeq      int64
+}
+
+type playerRow struct {
+	username    string
+	displayName string
+}
+
+type memberKey struct {
+	chatID int64
+	tgID   int64
+}
+
+type memberRow struct {
+	score  int
+	rating float64
+	joined int64 // порядок вступления в чат, аналог joined_at
+}
+
+type gameRow struct {
+	chatID     int64
+	scoring    string
+	seasonID   int // 0 - игра вне сезона
+	recordedBy int64
+	createdAt  time.Time
+}
+
+type resultRow struct {
+	gameID int
+	tgID   int64
+	place  int
+	points int
+	dnf    bool
+}
+
+type ratingRow struct {
+	gameID    int
+	chatID    int64
+	tgID      int64
+	before    float64
+	after     float64
+	createdAt time.Time
+}
+
+type standingRow struct {
+	seasonID int
+	tgID     int64
+	place    int
+	score    int
+	games    int
+}
+
+type auditRow struct {
+	chatID    int64
+	gameID    int
+	action    string
+	actorTGID int64
+	details   string
+	createdAt time.Time
+}
+
+type versionRow struct {
+	gameID   int
+	version  int
+	tgID     int64
+	place    int
+	points   int
+	dnf      bool
+	editedBy int64
+	editedAt time.Time
+}
+
+// sessionKey - сессия записи определяется чатом и сообщением с ее клавиатурой.
+type sessionKey struct {
+	chatID    int64
+	messageID int64
+}
+
+type sessionRow struct {
+	editGameID int
+	ownerTGID  int64
+	lineupOpen bool
+	createdAt  time.Time
+	updatedAt  time.Time
+}
+
+type sessionPlayerRow struct {
+	session sessionKey
+	tgID    int64
+	place   int
+	dnf     bool
+}
+
+type lineupRow struct {
+	session sessionKey
+	tgID    int64
+}
+
+func newData() *data {
+	return &data{
+		players:     make(map[int64]playerRow),
+		members:     make(map[memberKey]memberRow),
+		settings:    make(map[int64]string),
+		gameConfigs: make(map[int64]storage.GameConfig),
+		games:       make(map[int]gameRow),
+		seasons:     make(map[int]storage.Season),
+		sessions:    make(map[sessionKey]sessionRow),
+	}
+}
+
+// clone возвращает независимую копию данных.
+func (d *data) clone() *data {
+	c := *d
+	c.players = maps.Clone(d.players)
+	c.members = maps.Clone(d.members)
+	c.settings = maps.Clone(d.settings)
+	c.gameConfigs = maps.Clone(d.gameConfigs)
+	c.games = maps.Clone(d.games)
+	c.results = slices.Clone(d.results)
+	c.ratingHistory = slices.Clone(d.ratingHistory)
+	c.seasons = maps.Clone(d.seasons)
+	c.standings = slices.Clone(d.standings)
+	c.audit = slices.Clone(d.audit)
+	c.versions = slices.Clone(d.versions)
+	c.sessions = maps.Clone(d.sessions)
+	c.sessionPlayers = slices.Clone(d.sessionPlayers)
+	c.sessionLineup = slices.Clone(d.sessionLineup)
+	return &c
+}
+
+// view вызывает fn с текущими данными под блокировкой на чтение.
+func (s *Store) view(ctx context.Context, fn func(d *data) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.inTx {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+	return fn(s.data)
+}
+
+// update вызывает fn с копией данных и сохраняет ее, только если fn не вернула ошибку.
+func (s *Store) update(ctx context.Context, fn func(d *data) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.inTx {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	c := s.data.clone()
+	if err := fn(c); err != nil {
+		return err
+	}
+	*s.data = *c
+	return nil
+}
+
+// WithTx выполняет fn в одной транзакции: изменения сохраняются, только если fn
+// не вернула ошибку. Пока выполняется fn, остальные вызовы хранилища ждут, поэтому
+// внутри fn можно обращаться только к tx.
+func (s *Store) WithTx(ctx context.Context, fn func(tx storage.Tx) error) error {
+	return s.update(ctx, func(d *data) error {
+		return fn(&Store{mu: s.mu, data: d, inTx: true})
+	})
+}
+
+// Ping всегда успешен, пока не отменен ctx.
+func (s *Store) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close ничего не делает: хранилищу в памяти нечего освобождать.
+func (s *Store) Close() {}
+
+// player возвращает игрока чата или false, если он не состоит в чате.
+func (d *data) player(chatID, tgID int64) (storage.Player, bool) {
+	m, ok := d.members[memberKey{chatID, tgID}]
+	if !ok {
+		return storage.Player{}, false
+	}
+	p := d.players[tgID]
+	return storage.Player{TGID: tgID, Username: p.username, DisplayName: p.displayName, Score: m.score, Rating: m.rating}, true
+}
+
+// playerInfo возвращает игрока без очков и рейтинга, как в строках результатов игр.
+func (d *data) playerInfo(tgID int64) storage.Player {
+	p := d.players[tgID]
+	return storage.Player{TGID: tgID, Username: p.username, DisplayName: p.displayName}
+}
+
+// PlayerExists - проверяем состоит ли игрок в чате
+func (s *Store) PlayerExists(ctx context.Context, chatID int64, tgID int64) (bool, error) {
+	var exists bool
+	err := s.view(ctx, func(d *data) error {
+		_, exists = d.members[memberKey{chatID, tgID}]
+		return nil
+	})
+	return exists, err
+}
+
+// AddPlayer - добавляем и обновляем игрока, записываем его в чат
+func (s *Store) AddPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error {
+	return s.update(ctx, func(d *data) error {
+		d.players[tgID] = playerRow{username: username, displayName: displayName}
+		key := memberKey{chatID, tgID}
+		if _, ok := d.members[key]; !ok {
+			d.joinSeq++
+			d.members[key] = memberRow{rating: initialRating, joined: d.joinSeq}
+		}
+		return nil
+	})
+}
+
+// GetAllPlayers - Получение всех игроков чата в порядке вступления
+func (s *Store) GetAllPlayers(ctx context.Context, chatID int64) ([]storage.Player, error) {
+	var players []storage.Player
+	err := s.view(ctx, func(d *data) error {
+		var keys []memberKey
+		for key := range d.members {
+			if key.chatID == chatID {
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := d.members[keys[i]], d.members[keys[j]]
+			if a.joined != b.joined {
+				return a.joined < b.joined
+			}
+			return keys[i].tgID < keys[j].tgID
+		})
+		for _, key := range keys {
+			p, _ := d.player(chatID, key.tgID)
+			players = append(players, p)
+		}
+		return nil
+	})
+	return players, err
+}
+
+// GetPlayerByTGID - смотрим игрока чата по tgID. Если его нет, возвращает storage.ErrNotFound.
+func (s *Store) GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error) {
+	var player storage.Player
+	err := s.view(ctx, func(d *data) error {
+		p, ok := d.player(chatID, tgID)
+		if !ok {
+			return storage.ErrNotFound
+		}
+		player = p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &player, nil
+}
+
+// CheckPlayersExist проверяет, что все игроки с переданными tgID состоят в чате.
+func (s *Store) CheckPlayersExist(ctx context.Context, chatID int64, tgIDs []int64) (bool, error) {
+	if len(tgIDs) == 0 {
+		return true, nil // Нет игроков для проверки
+	}
+
+	var count int
+	err := s.view(ctx, func(d *data) error {
+		// Как COUNT(*) ... ANY($2): повторяющиеся ID считаются один раз
+		seen := make(map[int64]bool)
+		for _, tgID := range tgIDs {
+			if _, ok := d.members[memberKey{chatID, tgID}]; ok && !seen[tgID] {
+				seen[tgID] = true
+				count++
+			}
+		}
+		return nil
+	})
+	return count == len(tgIDs), err
+}
+
+// UpdatePlayerScore - добавляем очки игроку в чате
+func (s *Store) UpdatePlayerScore(ctx context.Context, chatID int64, tgID int64, pointsToAdd int) error {
+	return s.update(ctx, func(d *data) error {
+		d.addScore(chatID, tgID, pointsToAdd)
+		return nil
+	})
+}
+
+// addScore добавляет очки игроку чата, если он состоит в чате.
+func (d *data) addScore(chatID, tgID int64, points int) {
+	key := memberKey{chatID, tgID}
+	if m, ok := d.members[key]; ok {
+		m.score += points
+		d.members[key] = m
+	}
+}
+
+// setRating меняет рейтинг игрока чата, если он состоит в чате.
+func (d *data) setRating(chatID, tgID int64, rating float64) {
+	key := memberKey{chatID, tgID}
+	if m, ok := d.members[key]; ok {
+		m.rating = rating
+		d.members[key] = m
+	}
+}
+
+// GetChatScoring возвращает ключ стратегии подсчёта очков чата.
+// Если чат ничего не выбирал, возвращается пустая строка.
+func (s *Store) GetChatScoring(ctx context.Context, chatID int64) (string, error) {
+	var scoring string
+	err := s.view(ctx, func(d *data) error {
+		scoring = d.settings[chatID]
+		return nil
+	})
+	return scoring, err
+}
+
+// SetChatScoring сохраняет стратегию подсчёта очков чата.
+func (s *Store) SetChatScoring(ctx context.Context, chatID int64, scoring string) error {
+	return s.update(ctx, func(d *data) error {
+		d.settings[chatID] = scoring
+		return nil
+	})
+}
+
+// GetChatGameConfig возвращает настройки игры чата или nil, если чат их не менял.
+func (s *Store) GetChatGameConfig(ctx context.Context, chatID int64) (*storage.GameConfig, error) {
+	var cfg *storage.GameConfig
+	err := s.view(ctx, func(d *data) error {
+		if c, ok := d.gameConfigs[chatID]; ok {
+			cfg = &c
+		}
+		return nil
+	})
+	return cfg, err
+}
+
+// SetChatGameConfig сохраняет настройки игры чата.
+func (s *Store) SetChatGameConfig(ctx context.Context, chatID int64, cfg storage.GameConfig) error {
+	return s.update(ctx, func(d *data) error {
+		d.gameConfigs[chatID] = cfg
+		return nil
+	})
+}
+
+// CreateGame создает новую игру в чате и возвращает ее ID.
+// Игра привязывается к текущему сезону чата, если он есть. recordedBy - кто ее записал.
+func (s *Store) CreateGame(ctx context.Context, chatID int64, scoring string, recordedBy int64) (int, error) {
+	var gameID int
+	err := s.update(ctx, func(d *data) error {
+		d.nextGameID++
+		gameID = d.nextGameID
+		game := gameRow{chatID: chatID, scoring: scoring, recordedBy: recordedBy, createdAt: time.Now()}
+		if season, ok := d.activeSeason(chatID); ok {
+			game.seasonID = season.ID
+		}
+		d.games[gameID] = game
+		return nil
+	})
+	return gameID, err
+}
+
+// SaveGameResults - Сохранение результатов игры
+func (s *Store) SaveGameResults(ctx context.Context, results []storage.GameResult) error {
+	return s.update(ctx, func(d *data) error {
+		for _, r := range results {
+			if err := d.insertResult(r.GameID, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertResult добавляет строку результата r игры gameID, проверяя ссылки на игру и игрока.
+func (d *data) insertResult(gameID int, r storage.GameResult) error {
+	if _, ok := d.games[gameID]; !ok {
+		return fmt.Errorf("%w: game %d does not exist", ErrConstraint, gameID)
+	}
+	tgID := r.Player.TGID
+	if _, ok := d.players[tgID]; !ok {
+		return fmt.Errorf("%w: player %d does not exist", ErrConstraint, tgID)
+	}
+	d.results = append(d.results, resultRow{gameID: gameID, tgID: tgID, place: r.Place, points: r.Points, dnf: r.DNF})
+	return nil
+}
+
+// SetResultPoints исправляет очки игрока в результатах игры.
+func (s *Store) SetResultPoints(ctx context.Context, gameID int, tgID int64, points int) error {
+	return s.update(ctx, func(d *data) error {
+		for i, r := range d.results {
+			if r.gameID == gameID && r.tgID == tgID {
+				d.results[i].points = points
+			}
+		}
+		return nil
+	})
+}
+
+// LoadGamesByYear - Получение результатов игр чата за год
+func (s *Store) LoadGamesByYear(ctx context.Context, chatID int64, year int) ([]storage.GameResult, error) {
+	var results []storage.GameResult
+	err := s.view(ctx, func(d *data) error {
+		results = d.chatResults(func(g gameRow) bool {
+			return g.chatID == chatID && g.createdAt.Year() == year
+		})
+		return nil
+	})
+	return results, err
+}
+
+// LoadAllGames - Получение результатов всех игр чата в порядке их записи
+func (s *Store) LoadAllGames(ctx context.Context, chatID int64) ([]storage.GameResult, error) {
+	var results []storage.GameResult
+	err := s.view(ctx, func(d *data) error {
+		results = d.chatResults(func(g gameRow) bool { return g.chatID == chatID })
+		return nil
+	})
+	return results, err
+}
+
+// chatResults возвращает результаты игр, подходящих под match, по порядку игр и мест.
+func (d *data) chatResults(match func(g gameRow) bool) []storage.GameResult {
+	var results []storage.GameResult
+	for _, r := range d.results {
+		g := d.games[r.gameID]
+		if !match(g) {
+			continue
+		}
+		results = append(results, storage.GameResult{
+			GameID: r.gameID,
+			Player: d.playerInfo(r.tgID),
+			Place:  r.place,
+			Points: r.points,
+			DNF:    r.dnf,
+			Date:   g.createdAt,
+		})
+	}
+	sortResults(results)
+	return results
+}
+
+// sortResults упорядочивает результаты по игре и месту, сохраняя порядок записи при равенстве.
+func sortResults(results []storage.GameResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].GameID != results[j].GameID {
+			return results[i].GameID < results[j].GameID
+		}
+		return results[i].Place < results[j].Place
+	})
+}
+
+// gameResults возвращает результаты игры по местам вместе с изменением рейтинга Эло.
+func (d *data) gameResults(gameID int) []storage.GameResult {
+	g := d.games[gameID]
+	var results []storage.GameResult
+	for _, r := range d.results {
+		if r.gameID != gameID {
+			continue
+		}
+		res := storage.GameResult{
+			GameID: gameID,
+			Player: d.playerInfo(r.tgID),
+			Place:  r.place,
+			Points: r.points,
+			DNF:    r.dnf,
+			Date:   g.createdAt,
+		}
+		for _, rh := range d.ratingHistory {
+			if rh.gameID == gameID && rh.tgID == r.tgID {
+				res.RatingBefore, res.RatingAfter = rh.before, rh.after
+			}
+		}
+		results = append(results, res)
+	}
+	sortResults(results)
+	return results
+}
+
+// game собирает игру вместе с результатами.
+func (d *data) game(gameID int) storage.Game {
+	g := d.games[gameID]
+	return storage.Game{
+		ID:         gameID,
+		ChatID:     g.chatID,
+		Scoring:    g.scoring,
+		RecordedBy: g.recordedBy,
+		CreatedAt:  g.createdAt,
+		Results:    d.gameResults(gameID),
+	}
+}
+
+// chatGameIDs возвращает ID игр чата по возрастанию.
+func (d *data) chatGameIDs(chatID int64) []int {
+	var ids []int
+	for id, g := range d.games {
+		if g.chatID == chatID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// GetGame возвращает игру чата вместе с результатами или nil, если такой игры нет.
+func (s *Store) GetGame(ctx context.Context, chatID int64, gameID int) (*storage.Game, error) {
+	var game *storage.Game
+	err := s.view(ctx, func(d *data) error {
+		if g, ok := d.games[gameID]; ok && g.chatID == chatID {
+			found := d.game(gameID)
+			game = &found
+		}
+		return nil
+	})
+	return game, err
+}
+
+// GetLastGame возвращает последнюю записанную игру чата или nil, если игр не было.
+func (s *Store) GetLastGame(ctx context.Context, chatID int64) (*storage.Game, error) {
+	var game *storage.Game
+	err := s.view(ctx, func(d *data) error {
+		if ids := d.chatGameIDs(chatID); len(ids) > 0 {
+			last := d.game(ids[len(ids)-1])
+			game = &last
+		}
+		return nil
+	})
+	return game, err
+}
+
+// ListGames возвращает страницу игр чата (сначала новые) и общее число игр.
+func (s *Store) ListGames(ctx context.Context, chatID int64, offset, limit int) ([]storage.Game, int, error) {
+	var games []storage.Game
+	var total int
+	err := s.view(ctx, func(d *data) error {
+		ids := d.chatGameIDs(chatID)
+		total = len(ids)
+		slices.Reverse(ids)
+		for i := offset; i < len(ids) && i < offset+limit; i++ {
+			games = append(games, d.game(ids[i]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return games, total, nil
+}
+
+// LoadGamesSince возвращает игры чата, записанные после since, вместе с результатами, в порядке записи.
+func (s *Store) LoadGamesSince(ctx context.Context, chatID int64, since time.Time) ([]storage.Game, error) {
+	var games []storage.Game
+	err := s.view(ctx, func(d *data) error {
+		for _, id := range d.chatGameIDs(chatID) {
+			if d.games[id].createdAt.After(since) {
+				games = append(games, d.game(id))
+			}
+		}
+		return nil
+	})
+	return games, err
+}
+
+// auditResult - результат игрока в записи журнала, как в Postgres-хранилище.
+type auditResult struct {
+	TGID   int64 `json:"tg_id"`
+	Place  int   `json:"place"`
+	Points int   `json:"points"`
+	DNF    bool  `json:"dnf,omitempty"`
+}
+
+// DeleteGame удаляет игру: вычитает начисленные очки, возвращает рейтинги Эло участников
+// к значениям до игры, удаляет результаты и пишет запись в журнал.
+// Если игры в чате нет, возвращает storage.ErrNotFound.
+func (s *Store) DeleteGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) error {
+	return s.update(ctx, func(d *data) error {
+		g, ok := d.games[gameID]
+		if !ok || g.chatID != chatID {
+			return storage.ErrNotFound
+		}
+
+		var deleted []auditResult
+		for _, r := range d.gameResults(gameID) {
+			d.addScore(chatID, r.Player.TGID, -r.Points)
+			deleted = append(deleted, auditResult{TGID: r.Player.TGID, Place: r.Place, Points: r.Points})
+		}
+		for _, rh := range d.ratingHistory {
+			if rh.gameID == gameID {
+				d.setRating(rh.chatID, rh.tgID, rh.before)
+			}
+		}
+
+		details, err := json.Marshal(map[string]any{"results": deleted})
+		if err != nil {
+			return err
+		}
+		d.audit = append(d.audit, auditRow{
+			chatID: chatID, gameID: gameID, action: "undo", actorTGID: actorTGID,
+			details: string(details), createdAt: time.Now(),
+		})
+
+		// Результаты, история рейтинга и версии удаляются вместе с игрой, как ON DELETE CASCADE
+		delete(d.games, gameID)
+		d.results = slices.DeleteFunc(d.results, func(r resultRow) bool { return r.gameID == gameID })
+		d.ratingHistory = slices.DeleteFunc(d.ratingHistory, func(r ratingRow) bool { return r.gameID == gameID })
+		d.versions = slices.DeleteFunc(d.versions, func(v versionRow) bool { return v.gameID == gameID })
+		return nil
+	})
+}
+
+// UpdateGameResults заменяет результаты игры новыми: сохраняет прежние места как очередную
+// версию, корректирует очки игроков на разницу и пишет запись в журнал.
+func (s *Store) UpdateGameResults(ctx context.Context, chatID int64, gameID int, results []storage.GameResult, editorTGID int64) error {
+	return s.update(ctx, func(d *data) error {
+		version := 1
+		for _, v := range d.versions {
+			if v.gameID == gameID && v.version >= version {
+				version = v.version + 1
+			}
+		}
+
+		// Прежние результаты уходят в историю версий, их очки списываются
+		now := time.Now()
+		for _, r := range d.results {
+			if r.gameID != gameID {
+				continue
+			}
+			d.versions = append(d.versions, versionRow{
+				gameID: gameID, version: version, tgID: r.tgID, place: r.place, points: r.points, dnf: r.dnf,
+				editedBy: editorTGID, editedAt: now,
+			})
+			d.addScore(chatID, r.tgID, -r.points)
+		}
+		d.results = slices.DeleteFunc(d.results, func(r resultRow) bool { return r.gameID == gameID })
+
+		var edited []auditResult
+		for _, r := range results {
+			if err := d.insertResult(gameID, r); err != nil {
+				return err
+			}
+			d.addScore(chatID, r.Player.TGID, r.Points)
+			edited = append(edited, auditResult{TGID: r.Player.TGID, Place: r.Place, Points: r.Points, DNF: r.DNF})
+		}
+
+		details, err := json.Marshal(map[string]any{"version": version, "results": edited})
+		if err != nil {
+			return err
+		}
+		d.audit = append(d.audit, auditRow{
+			chatID: chatID, gameID: gameID, action: "edit", actorTGID: editorTGID,
+			details: string(details), createdAt: now,
+		})
+		return nil
+	})
+}
+
+// GetGameVersions возвращает предыдущие версии результатов игры, начиная с исходной.
+func (s *Store) GetGameVersions(ctx context.Context, gameID int) ([]storage.GameVersion, error) {
+	var versions []storage.GameVersion
+	err := s.view(ctx, func(d *data) error {
+		var rows []versionRow
+		for _, v := range d.versions {
+			if v.gameID == gameID {
+				rows = append(rows, v)
+			}
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			if rows[i].version != rows[j].version {
+				return rows[i].version < rows[j].version
+			}
+			if rows[i].place != rows[j].place {
+				return rows[i].place < rows[j].place
+			}
+			return rows[i].tgID < rows[j].tgID
+		})
+
+		for _, row := range rows {
+			if len(versions) == 0 || versions[len(versions)-1].Version != row.version {
+				versions = append(versions, storage.GameVersion{
+					Version:  row.version,
+					EditedBy: storage.Player{TGID: row.editedBy, DisplayName: d.players[row.editedBy].displayName},
+					EditedAt: row.editedAt,
+				})
+			}
+			last := &versions[len(versions)-1]
+			last.Results = append(last.Results, storage.GameResult{
+				GameID: gameID,
+				Player: d.playerInfo(row.tgID),
+				Place:  row.place,
+				Points: row.points,
+				DNF:    row.dnf,
+			})
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// SaveRatingChanges сохраняет новые рейтинги игроков чата и записывает их в историю.
+func (s *Store) SaveRatingChanges(ctx context.Context, chatID int64, changes []storage.RatingChange) error {
+	return s.update(ctx, func(d *data) error {
+		now := time.Now()
+		for _, c := range changes {
+			if err := d.insertRating(chatID, c, now); err != nil {
+				return err
+			}
+			d.setRating(chatID, c.TGID, c.After)
+		}
+		return nil
+	})
+}
+
+// insertRating добавляет строку истории рейтинга, проверяя ссылки на игру и игрока.
+func (d *data) insertRating(chatID int64, c storage.RatingChange, createdAt time.Time) error {
+	if _, ok := d.games[c.GameID]; !ok {
+		return fmt.Errorf("%w: game %d does not exist", ErrConstraint, c.GameID)
+	}
+	if _, ok := d.players[c.TGID]; !ok {
+		return fmt.Errorf("%w: player %d does not exist", ErrConstraint, c.TGID)
+	}
+	d.ratingHistory = append(d.ratingHistory, ratingRow{
+		gameID: c.GameID, chatID: chatID, tgID: c.TGID, before: c.Before, after: c.After, createdAt: createdAt,
+	})
+	return nil
+}
+
+// GetRatingHistory возвращает последние изменения рейтинга игрока в чате, начиная с самых новых.
+func (s *Store) GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]storage.RatingChange, error) {
+	var changes []storage.RatingChange
+	err := s.view(ctx, func(d *data) error {
+		for _, rh := range d.ratingHistory {
+			if rh.chatID == chatID && rh.tgID == tgID {
+				changes = append(changes, storage.RatingChange{
+					GameID: rh.gameID, TGID: rh.tgID, Before: rh.before, After: rh.after, Date: rh.createdAt,
+				})
+			}
+		}
+		sort.SliceStable(changes, func(i, j int) bool { return changes[i].GameID > changes[j].GameID })
+		if limit >= 0 && len(changes) > limit {
+			changes = changes[:limit]
+		}
+		return nil
+	})
+	return changes, err
+}
+
+// ReplaceRatings перезаписывает историю и текущие рейтинги Эло чата, например после
+// пересчета всех игр. Игроки без игр получают начальный рейтинг initial.
+func (s *Store) ReplaceRatings(ctx context.Context, chatID int64, history []storage.RatingChange, initial float64) error {
+	return s.update(ctx, func(d *data) error {
+		d.ratingHistory = slices.DeleteFunc(d.ratingHistory, func(r ratingRow) bool { return r.chatID == chatID })
+		for key := range d.members {
+			if key.chatID == chatID {
+				d.setRating(chatID, key.tgID, initial)
+			}
+		}
+
+		for _, c := range history {
+			if err := d.insertRating(chatID, c, c.Date); err != nil {
+				return err
+			}
+			// История идет по порядку игр, поэтому последняя запись игрока - его текущий рейтинг
+			d.setRating(chatID, c.TGID, c.After)
+		}
+		return nil
+	})
+}
+
+// activeSeason возвращает незавершенный сезон чата.
+func (d *data) activeSeason(chatID int64) (storage.Season, bool) {
+	for _, season := range d.seasons {
+		if season.ChatID == chatID && season.EndedAt == nil {
+			return season, true
+		}
+	}
+	return storage.Season{}, false
+}
+
+// resetScores обнуляет очки игроков чата.
+func (d *data) resetScores(chatID int64) {
+	for key, m := range d.members {
+		if key.chatID == chatID {
+			m.score = 0
+			d.members[key] = m
+		}
+	}
+}
+
+// CreateSeason начинает новый сезон в чате и обнуляет очки игроков. Как и в Postgres,
+// название сезона в чате уникально, а незавершенный сезон может быть только один.
+func (s *Store) CreateSeason(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	var season storage.Season
+	err := s.update(ctx, func(d *data) error {
+		for _, other := range d.seasons {
+			if other.ChatID == chatID && other.Name == name {
+				return fmt.Errorf("%w: season %q already exists", ErrConstraint, name)
+			}
+		}
+		if _, ok := d.activeSeason(chatID); ok {
+			return fmt.Errorf("%w: chat %d already has an active season", ErrConstraint, chatID)
+		}
+
+		d.nextSeasonID++
+		season = storage.Season{ID: d.nextSeasonID, ChatID: chatID, Name: name, StartedAt: time.Now()}
+		d.seasons[season.ID] = season
+		d.resetScores(chatID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetActiveSeason возвращает незавершенный сезон чата или nil, если его нет.
+func (s *Store) GetActiveSeason(ctx context.Context, chatID int64) (*storage.Season, error) {
+	var season *storage.Season
+	err := s.view(ctx, func(d *data) error {
+		if active, ok := d.activeSeason(chatID); ok {
+			season = &active
+		}
+		return nil
+	})
+	return season, err
+}
+
+// GetSeasonByName возвращает сезон чата по названию или nil, если его нет.
+func (s *Store) GetSeasonByName(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	var season *storage.Season
+	err := s.view(ctx, func(d *data) error {
+		for _, other := range d.seasons {
+			if other.ChatID == chatID && other.Name == name {
+				season = &other
+				break
+			}
+		}
+		return nil
+	})
+	return season, err
+}
+
+// ListSeasons возвращает все сезоны чата, начиная с последнего.
+func (s *Store) ListSeasons(ctx context.Context, chatID int64) ([]storage.Season, error) {
+	var seasons []storage.Season
+	err := s.view(ctx, func(d *data) error {
+		for _, season := range d.seasons {
+			if season.ChatID == chatID {
+				seasons = append(seasons, season)
+			}
+		}
+		sort.Slice(seasons, func(i, j int) bool {
+			if !seasons[i].StartedAt.Equal(seasons[j].StartedAt) {
+				return seasons[i].StartedAt.After(seasons[j].StartedAt)
+			}
+			return seasons[i].ID > seasons[j].ID
+		})
+		return nil
+	})
+	return seasons, err
+}
+
+// EndSeason завершает сезон: сохраняет итоговую таблицу по текущим очкам игроков чата
+// и обнуляет их очки.
+func (s *Store) EndSeason(ctx context.Context, chatID int64, seasonID int) error {
+	return s.update(ctx, func(d *data) error {
+		season, ok := d.seasons[seasonID]
+		if !ok {
+			return fmt.Errorf("%w: season %d does not exist", ErrConstraint, seasonID)
+		}
+		for _, st := range d.standings {
+			if st.seasonID == seasonID {
+				return fmt.Errorf("%w: standings of season %d already saved", ErrConstraint, seasonID)
+			}
+		}
+
+		games := d.seasonGameCounts(seasonID)
+		var rows []standingRow
+		for key, m := range d.members {
+			if key.chatID != chatID {
+				continue
+			}
+			rows = append(rows, standingRow{seasonID: seasonID, tgID: key.tgID, score: m.score, games: games[key.tgID]})
+		}
+		// Места как RANK() OVER (ORDER BY score DESC): равные очки - равные места
+		for i := range rows {
+			rows[i].place = 1
+			for _, other := range rows {
+				if other.score > rows[i].score {
+					rows[i].place++
+				}
+			}
+		}
+		d.standings = append(d.standings, rows...)
+
+		d.resetScores(chatID)
+
+		if season.ChatID == chatID {
+			now := time.Now()
+			season.EndedAt = &now
+			d.seasons[seasonID] = season
+		}
+		return nil
+	})
+}
+
+// GetSeasonStandings возвращает сохраненную итоговую таблицу сезона.
+func (s *Store) GetSeasonStandings(ctx context.Context, seasonID int) ([]storage.SeasonStanding, error) {
+	var standings []storage.SeasonStanding
+	err := s.view(ctx, func(d *data) error {
+		for _, row := range d.standings {
+			if row.seasonID != seasonID {
+				continue
+			}
+			player := d.playerInfo(row.tgID)
+			player.Score = row.score
+			standings = append(standings, storage.SeasonStanding{
+				Player: player, Place: row.place, Score: row.score, Games: row.games,
+			})
+		}
+		sort.SliceStable(standings, func(i, j int) bool {
+			if standings[i].Place != standings[j].Place {
+				return standings[i].Place < standings[j].Place
+			}
+			return standings[i].Player.DisplayName < standings[j].Player.DisplayName
+		})
+		return nil
+	})
+	return standings, err
+}
+
+// GetSeasonGameCounts возвращает, сколько игр сезона сыграл каждый игрок. Игры относятся
+// к сезону, в котором были записаны; игры, из которых игрок выбыл, тоже считаются.
+func (s *Store) GetSeasonGameCounts(ctx context.Context, seasonID int) (map[int64]int, error) {
+	var counts map[int64]int
+	err := s.view(ctx, func(d *data) error {
+		counts = d.seasonGameCounts(seasonID)
+		return nil
+	})
+	return counts, err
+}
+
+// seasonGameCounts считает результаты игр сезона по игрокам.
+func (d *data) seasonGameCounts(seasonID int) map[int64]int {
+	counts := make(map[int64]int)
+	for _, r := range d.results {
+		if d.games[r.gameID].seasonID == seasonID {
+			counts[r.tgID]++
+		}
+	}
+	return counts
+}
+
+// deleteSession удаляет сессию вместе с ее игроками и составом.
+func (d *data) deleteSession(key sessionKey) {
+	delete(d.sessions, key)
+	d.sessionPlayers = slices.DeleteFunc(d.sessionPlayers, func(sp sessionPlayerRow) bool { return sp.session == key })
+	d.sessionLineup = slices.DeleteFunc(d.sessionLineup, func(l lineupRow) bool { return l.session == key })
+}
+
+// insertSessionPlayer добавляет игрока в сессию, проверяя ссылки и повторы, как ключи таблицы session_players.
+func (d *data) insertSessionPlayer(key sessionKey, tgID int64, place int, dnf bool) error {
+	if _, ok := d.sessions[key]; !ok {
+		return fmt.Errorf("%w: chat %d has no recording session for message %d", ErrConstraint, key.chatID, key.messageID)
+	}
+	if _, ok := d.players[tgID]; !ok {
+		return fmt.Errorf("%w: player %d does not exist", ErrConstraint, tgID)
+	}
+	for _, sp := range d.sessionPlayers {
+		if sp.session == key && sp.tgID == tgID {
+			return fmt.Errorf("%w: player %d is already in the session", ErrConstraint, tgID)
+		}
+	}
+	d.sessionPlayers = append(d.sessionPlayers, sessionPlayerRow{session: key, tgID: tgID, place: place, dnf: dnf})
+	return nil
+}
+
+// insertSession создает сессию, проверяя первичный ключ таблицы recording_sessions.
+func (d *data) insertSession(key sessionKey, editGameID int, ownerTGID int64, lineupOpen bool) error {
+	if _, ok := d.sessions[key]; ok {
+		return fmt.Errorf("%w: recording session for message %d already exists", ErrConstraint, key.messageID)
+	}
+	now := time.Now()
+	d.sessions[key] = sessionRow{editGameID: editGameID, ownerTGID: ownerTGID, lineupOpen: lineupOpen, createdAt: now, updatedAt: now}
+	return nil
+}
+
+// CreateRecordingSession создает новую сессию записи для сообщения messageID. Запись начинается
+// с набора состава игры. Другие сессии чата не затрагиваются: в чате можно записывать несколько игр одновременно.
+func (s *Store) CreateRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error {
+	return s.update(ctx, func(d *data) error {
+		return d.insertSession(sessionKey{chatID, messageID}, 0, ownerTGID, true)
+	})
+}
+
+// CreateEditSession создает сессию редактирования игры gameID, заполненную текущими местами игроков.
+func (s *Store) CreateEditSession(ctx context.Context, chatID int64, messageID int64, gameID int, ownerTGID int64, players []storage.SessionPlayer) error {
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		if err := d.insertSession(key, gameID, ownerTGID, false); err != nil {
+			return err
+		}
+		for _, p := range players {
+			if err := d.insertSessionPlayer(key, p.Player.TGID, p.Place, p.DNF); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRecordingSession возвращает сессию записи сообщения messageID в чате или nil, если ее нет.
+func (s *Store) GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*storage.RecordingSession, error) {
+	var session *storage.RecordingSession
+	err := s.view(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		if row, ok := d.sessions[key]; ok {
+			session = row.session(key)
+		}
+		return nil
+	})
+	return session, err
+}
+
+// session переводит строку сессии в модель.
+func (row sessionRow) session(key sessionKey) *storage.RecordingSession {
+	return &storage.RecordingSession{
+		ChatID:     key.chatID,
+		MessageID:  key.messageID,
+		EditGameID: row.editGameID,
+		OwnerTGID:  row.ownerTGID,
+		LineupOpen: row.lineupOpen,
+		CreatedAt:  row.createdAt,
+		UpdatedAt:  row.updatedAt,
+	}
+}
+
+// touchSession отмечает действие в сессии записи, чтобы она не истекла.
+func (d *data) touchSession(key sessionKey) {
+	if row, ok := d.sessions[key]; ok {
+		row.updatedAt = time.Now()
+		d.sessions[key] = row
+	}
+}
+
+// AddPlayerToSession добавляет игрока в сессию записи и продлевает ее. Если tied, игрок делит
+// место с последним выбранным, иначе встает на следующее место с учетом всех, кто выше.
+func (s *Store) AddPlayerToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) error {
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		// Выбывшие мест не занимают и не учитываются
+		count, lastPlace := 0, 1
+		for _, sp := range d.sessionPlayers {
+			if sp.session == key && !sp.dnf {
+				count++
+				lastPlace = max(lastPlace, sp.place)
+			}
+		}
+		nextPlace := count + 1
+		if tied {
+			nextPlace = lastPlace
+		}
+		if err := d.insertSessionPlayer(key, playerTgID, nextPlace, false); err != nil {
+			return err
+		}
+		d.touchSession(key)
+		return nil
+	})
+}
+
+// AddDNFToSession добавляет в сессию записи выбывшего игрока и продлевает ее.
+// Выбывший не занимает места, доигравшие не сдвигаются.
+func (s *Store) AddDNFToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		if err := d.insertSessionPlayer(key, playerTgID, 0, true); err != nil {
+			return err
+		}
+		d.touchSession(key)
+		return nil
+	})
+}
+
+// RemovePlayerFromSession убирает игрока из сессии, игроки ниже него поднимаются на место вверх
+// (после выбывшего места не сдвигаются). Сессия продлевается.
+func (s *Store) RemovePlayerFromSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		i := slices.IndexFunc(d.sessionPlayers, func(sp sessionPlayerRow) bool {
+			return sp.session == key && sp.tgID == playerTgID
+		})
+		if i < 0 {
+			return nil // Игрока уже нет в сессии
+		}
+		removed := d.sessionPlayers[i]
+		d.sessionPlayers = slices.Delete(d.sessionPlayers, i, i+1)
+
+		for j, sp := range d.sessionPlayers {
+			if sp.session == key && !removed.dnf && sp.place > removed.place {
+				d.sessionPlayers[j].place--
+			}
+		}
+		d.touchSession(key)
+		return nil
+	})
+}
+
+// GetLastSelectedPlayer возвращает Telegram ID игрока, выбранного в сессии последним (в том числе
+// выбывшего), или 0, если в сессии никого нет. Строки сессий хранятся в порядке выбора.
+func (s *Store) GetLastSelectedPlayer(ctx context.Context, chatID int64, messageID int64) (int64, error) {
+	var tgID int64
+	err := s.view(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		for _, sp := range slices.Backward(d.sessionPlayers) {
+			if sp.session == key {
+				tgID = sp.tgID
+				break
+			}
+		}
+		return nil
+	})
+	return tgID, err
+}
+
+// SwapSessionPlayers меняет местами двух игроков сессии. Если кого-то из них нет среди
+// доигравших, ничего не делает.
+func (s *Store) SwapSessionPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) error {
+	if firstTgID == secondTgID {
+		return nil
+	}
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		i := slices.IndexFunc(d.sessionPlayers, func(sp sessionPlayerRow) bool {
+			return sp.session == key && sp.tgID == firstTgID && !sp.dnf
+		})
+		j := slices.IndexFunc(d.sessionPlayers, func(sp sessionPlayerRow) bool {
+			return sp.session == key && sp.tgID == secondTgID && !sp.dnf
+		})
+		if i < 0 || j < 0 {
+			return nil // Кого-то из игроков уже нет в сессии или он выбыл
+		}
+		d.sessionPlayers[i].place, d.sessionPlayers[j].place = d.sessionPlayers[j].place, d.sessionPlayers[i].place
+		d.touchSession(key)
+		return nil
+	})
+}
+
+// GetSessionPlayers возвращает всех игроков в сессии с их местами, выбывшие идут последними.
+// Игроки, делящие место, идут в порядке Telegram ID.
+func (s *Store) GetSessionPlayers(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error) {
+	var players []storage.SessionPlayer
+	err := s.view(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		var rows []sessionPlayerRow
+		for _, sp := range d.sessionPlayers {
+			if sp.session == key {
+				rows = append(rows, sp)
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].dnf != rows[j].dnf {
+				return !rows[i].dnf
+			}
+			if rows[i].place != rows[j].place {
+				return rows[i].place < rows[j].place
+			}
+			return rows[i].tgID < rows[j].tgID
+		})
+
+		for _, sp := range rows {
+			// Как JOIN chat_players: игроки, вышедшие из чата, не возвращаются
+			if p, ok := d.player(chatID, sp.tgID); ok {
+				players = append(players, storage.SessionPlayer{Player: p, Place: sp.place, DNF: sp.dnf})
+			}
+		}
+		return nil
+	})
+	return players, err
+}
+
+// AddPlayerToLineup добавляет игрока в состав игры сессии и продлевает ее.
+// Если игрок уже в составе, ничего не меняется.
+func (s *Store) AddPlayerToLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		if _, ok := d.sessions[key]; !ok {
+			return fmt.Errorf("%w: chat %d has no recording session for message %d", ErrConstraint, chatID, messageID)
+		}
+		if _, ok := d.players[playerTgID]; !ok {
+			return fmt.Errorf("%w: player %d does not exist", ErrConstraint, playerTgID)
+		}
+		if !slices.Contains(d.sessionLineup, lineupRow{key, playerTgID}) {
+			d.sessionLineup = append(d.sessionLineup, lineupRow{key, playerTgID})
+		}
+		d.touchSession(key)
+		return nil
+	})
+}
+
+// RemovePlayerFromLineup убирает игрока из состава игры сессии и продлевает ее.
+func (s *Store) RemovePlayerFromLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		d.sessionLineup = slices.DeleteFunc(d.sessionLineup, func(l lineupRow) bool { return l == lineupRow{key, playerTgID} })
+		d.touchSession(key)
+		return nil
+	})
+}
+
+// GetSessionLineup возвращает состав игры сессии в том же порядке, что и GetAllPlayers.
+func (s *Store) GetSessionLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	var players []storage.Player
+	err := s.view(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		var ids []int64
+		for _, l := range d.sessionLineup {
+			// Как JOIN chat_players: игроки, вышедшие из чата, не возвращаются
+			if _, ok := d.members[memberKey{chatID, l.tgID}]; l.session == key && ok {
+				ids = append(ids, l.tgID)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := d.members[memberKey{chatID, ids[i]}], d.members[memberKey{chatID, ids[j]}]
+			if a.joined != b.joined {
+				return a.joined < b.joined
+			}
+			return ids[i] < ids[j]
+		})
+		for _, id := range ids {
+			p, _ := d.player(chatID, id)
+			players = append(players, p)
+		}
+		return nil
+	})
+	return players, err
+}
+
+// SetLineupOpen открывает или закрывает набор состава игры сессии и продлевает ее.
+func (s *Store) SetLineupOpen(ctx context.Context, chatID int64, messageID int64, open bool) error {
+	return s.update(ctx, func(d *data) error {
+		key := sessionKey{chatID, messageID}
+		if row, ok := d.sessions[key]; ok {
+			row.lineupOpen = open
+			row.updatedAt = time.Now()
+			d.sessions[key] = row
+		}
+		return nil
+	})
+}
+
+// DeleteRecordingSession удаляет сессию записи и всех связанных с ней игроков.
+func (s *Store) DeleteRecordingSession(ctx context.Context, chatID int64, messageID int64) error {
+	return s.update(ctx, func(d *data) error {
+		d.deleteSession(sessionKey{chatID, messageID})
+		return nil
+	})
+}
+
+// DeleteExpiredSessions удаляет сессии записи всех чатов, в которых ничего не происходило
+// с момента before, и возвращает удаленные сессии.
+func (s *Store) DeleteExpiredSessions(ctx context.Context, before time.Time) ([]storage.RecordingSession, error) {
+	var sessions []storage.RecordingSession
+	err := s.update(ctx, func(d *data) error {
+		for key, row := range d.sessions {
+			if row.updatedAt.Before(before) {
+				sessions = append(sessions, *row.session(key))
+				d.deleteSession(key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// ListChats возвращает все чаты, в которых есть игроки.
+func (s *Store) ListChats(ctx context.Context) ([]int64, error) {
+	var chats []int64
+	err := s.view(ctx, func(d *data) error {
+		for key := range d.members {
+			if !slices.Contains(chats, key.chatID) {
+				chats = append(chats, key.chatID)
+			}
+		}
+		slices.Sort(chats)
+		return nil
+	})
+	return chats, err
+}
@@ -0,0 +1,60 @@
+package memory_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage/memory"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ service.StorageInterface = (*memory.Store)(nil)
+
+func TestContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.StorageInterface {
+		return memory.New()
+	})
+}
+
+func TestStore_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+	require.NoError(t, s.AddPlayer(ctx, 1, 10, "alice", "Alice"))
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				assert.NoError(t, s.UpdatePlayerScore(ctx, 1, 10, 1))
+				return
+			}
+			assert.NoError(t, s.WithTx(ctx, func(tx storage.Tx) error {
+				return tx.UpdatePlayerScore(ctx, 1, 10, 1)
+			}))
+			_, err := s.GetAllPlayers(ctx, 1)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	player, err := s.GetPlayerByTGID(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 50, player.Score)
+}
+
+func TestStore_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := memory.New()
+	assert.ErrorIs(t, s.AddPlayer(ctx, 1, 10, "alice", "Alice"), context.Canceled)
+	_, err := s.GetAllPlayers(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+}
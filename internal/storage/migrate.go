@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sashakosti/Go_Bot_Svintus/migrations"
+)
+
+// migrationLockKey - ключ advisory-блокировки, чтобы миграции не применялись одновременно
+// несколькими экземплярами бота.
+const migrationLockKey int64 = 0x5376696e747573 // "Svintus"
+
+var ErrDirtySchema = errors.New("schema is dirty")
+var ErrIncompatibleSchema = errors.New("incompatible database schema")
+
+// Migration - одна миграция схемы.
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// LoadMigrations читает миграции вида NNN_name.up.sql и сортирует их по версии.
+func LoadMigrations(files fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Migration
+	seen := make(map[int64]string)
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must look like NNN_name.up.sql", name)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", name, err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version %d", other, name, version)
+		}
+		seen[version] = name
+
+		sql, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Migration{Version: version, Name: name, SQL: string(sql)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Migrate применяет встроенные миграции, которые еще не применены. Версия схемы хранится
+// в таблице schema_migrations в том же формате, что у golang-migrate, поэтому базы,
+// обновлявшиеся отдельным контейнером migrate, продолжают с последней примененной версии.
+// Каждая миграция выполняется в своей транзакции. На время работы берется advisory-блокировка.
+func (s *Storage) Migrate(ctx context.Context) error {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	// Advisory-блокировка принадлежит соединению, поэтому все делаем через одно соединение
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			log.Printf("failed to release migration lock: %v", err)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(ctx, conn.Conn())
+	if err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		if m.Version <= current {
+			continue
+		}
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.SQL); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "DELETE FROM schema_migrations"); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)", m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.Name, err)
+		}
+		log.Printf("Applied migration %s", m.Name)
+	}
+	return nil
+}
+
+// schemaVersion возвращает версию схемы из schema_migrations (0 - миграции не применялись).
+func schemaVersion(ctx context.Context, conn *pgx.Conn) (int64, error) {
+	var version int64
+	var dirty bool
+	err := conn.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w: migration %d failed halfway, fix it manually and reset the dirty flag", ErrDirtySchema, version)
+	}
+	return version, nil
+}
+
+// requiredColumns - таблицы и колонки, без которых код хранилища не работает.
+var requiredColumns = map[string][]string{
+	"players":              {"tg_id", "username", "display_name"},
+	"chat_players":         {"chat_id", "player_tg_id", "score", "rating"},
+	"chat_settings":        {"chat_id", "scoring", "min_players", "max_players", "auto_place_last"},
+	"games":                {"id", "chat_id", "scoring", "season_id", "recorded_by", "created_at"},
+	"game_results":         {"game_id", "user_id", "place", "points", "status"},
+	"rating_history":       {"game_id", "chat_id", "player_tg_id", "rating_before", "rating_after"},
+	"seasons":              {"id", "chat_id", "name", "started_at", "ended_at"},
+	"season_standings":     {"season_id", "player_tg_id", "place", "score", "games"},
+	"game_audit":           {"chat_id", "game_id", "action", "actor_tg_id", "details"},
+	"game_result_versions": {"game_id", "version", "player_tg_id", "place", "points", "status", "edited_by", "edited_at"},
+	"recording_sessions":   {"chat_id", "message_id", "edit_game_id", "owner_tg_id", "lineup_open", "created_at", "updated_at"},
+	"session_players":      {"session_chat_id", "session_message_id", "player_tg_id", "place", "status", "seq"},
+	"session_lineup":       {"session_chat_id", "session_message_id", "player_tg_id"},
+}
+
+// CheckSchema проверяет, что схема базы совместима с кодом: версия схемы не новее
+// встроенных миграций и все нужные таблицы и колонки на месте.
+func (s *Storage) CheckSchema(ctx context.Context) error {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+	latest := list[len(list)-1].Version
+
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	current, err := schemaVersion(ctx, conn.Conn())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrIncompatibleSchema, err)
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this build knows migrations up to %d", ErrIncompatibleSchema, current, latest)
+	}
+
+	rows, err := conn.Query(ctx,
+		`SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = current_schema()`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return err
+		}
+		existing[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return CheckColumns(existing)
+}
+
+// CheckColumns проверяет, что среди существующих колонок (ключи вида "таблица.колонка")
+// есть все, без которых не работает код хранилища.
+func CheckColumns(existing map[string]bool) error {
+	var missing []string
+	for table, columns := range requiredColumns {
+		for _, column := range columns {
+			if !existing[table+"."+column] {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: missing columns %s", ErrIncompatibleSchema, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/sashakosti/Go_Bot_Svintus/migrations"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("встроенные миграции не читаются: %v", err)
+	}
+	if len(list) == 0 || list[0].Version != 1 {
+		t.Fatalf("ожидались миграции начиная с версии 1, получено %d", len(list))
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i].Version <= list[i-1].Version {
+			t.Errorf("миграции не отсортированы: %s после %s", list[i].Name, list[i-1].Name)
+		}
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"одинаковые версии": {
+			"001_a.up.sql": {Data: []byte("SELECT 1")},
+			"1_b.up.sql":   {Data: []byte("SELECT 1")},
+		},
+		"без версии": {
+			"init.up.sql": {Data: []byte("SELECT 1")},
+		},
+		"версия не число": {
+			"abc_init.up.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadMigrations(files); err == nil {
+				t.Error("ожидалась ошибка")
+			}
+		})
+	}
+}
@@ -2,20 +2,59 @@ package storage
 
 import "time"
 
+// Статусы результата игрока в колонке status.
+const (
+	StatusFinished = "finished"
+	StatusDNF      = "dnf"
+)
+
+// ResultStatus возвращает значение колонки status для результата.
+func ResultStatus(dnf bool) string {
+	if dnf {
+		return StatusDNF
+	}
+	return StatusFinished
+}
+
 // Игрок
 type Player struct {
 	TGID        int64
 	Username    string
 	DisplayName string
 	Score       int
+	Rating      float64 // рейтинг Эло в чате
 }
 
 // Результат одной игры
 type GameResult struct {
 	GameID int
 	Player Player
-	Place  int // место выхода из игры
-	Points int // очки за игру
+	Place  int  // место выхода из игры; выбывшие делят место после всех доигравших
+	Points int  // очки за игру или штраф выбывшего
+	DNF    bool // игрок выбыл, не доиграв
+	Date   time.Time
+
+	// Изменение рейтинга Эло за игру
+	RatingBefore float64
+	RatingAfter  float64
+}
+
+// Game - записанная игра вместе с результатами.
+type Game struct {
+	ID         int
+	ChatID     int64
+	Scoring    string // ключ стратегии подсчёта очков
+	RecordedBy int64  // кто записал игру, 0 - неизвестно
+	CreatedAt  time.Time
+	Results    []GameResult
+}
+
+// RatingChange - изменение рейтинга игрока по итогам одной игры.
+type RatingChange struct {
+	GameID int
+	TGID   int64
+	Before float64
+	After  float64
 	Date   time.Time
 }
 
@@ -23,10 +62,53 @@ type GameResult struct {
 type RecordingSession struct {
 	ChatID    int64
 	MessageID int64
+	// EditGameID - ID редактируемой игры, 0 для записи новой игры.
+	EditGameID int
+	// OwnerTGID - кто начал запись или редактирование.
+	OwnerTGID int64
+	// LineupOpen - состав игры еще набирается, места выбирать рано.
+	LineupOpen bool
+	CreatedAt  time.Time
+	// UpdatedAt - время последнего действия в сессии (создание, добавление или удаление игрока).
+	UpdatedAt time.Time
+}
+
+// GameConfig - настройки игры чата.
+type GameConfig struct {
+	MinPlayers int
+	MaxPlayers int
+	// AutoPlaceLast - последний оставшийся из объявленного состава встает на место сам.
+	AutoPlaceLast bool
 }
 
 // SessionPlayer представляет игрока, добавленного в сессию записи.
 type SessionPlayer struct {
+	Player Player
+	Place  int  // 0 у выбывших: они не занимают место среди доигравших
+	DNF    bool // игрок выбыл, не доиграв
+}
+
+// Season - сезон чата. У незавершенного сезона EndedAt == nil.
+type Season struct {
+	ID        int
+	ChatID    int64
+	Name      string
+	StartedAt time.Time
+	EndedAt   *time.Time
+}
+
+// SeasonStanding - строка итоговой таблицы сезона.
+type SeasonStanding struct {
 	Player Player
 	Place  int
+	Score  int
+	Games  int // игры сезона с участием игрока, включая те, из которых он выбыл (как в /stats)
+}
+
+// GameVersion - предыдущая версия результатов игры, сохраненная при ее редактировании.
+type GameVersion struct {
+	Version  int
+	EditedBy Player // кто заменил эту версию
+	EditedAt time.Time
+	Results  []GameResult
 }
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+	"github.com/sashakosti/Go_Bot_Svintus/migrations"
+)
+
+// loadMigrations возвращает встроенные миграции SQLite.
+func loadMigrations() ([]storage.Migration, error) {
+	files, err := fs.Sub(migrations.SQLiteFS, "sqlite")
+	if err != nil {
+		return nil, err
+	}
+	return storage.LoadMigrations(files)
+}
+
+// Migrate применяет встроенные миграции SQLite, которые еще не применены. Версия схемы
+// хранится в schema_migrations в том же формате, что у Postgres-хранилища. Каждая миграция
+// выполняется в своей транзакции; транзакции SQLite берут блокировку записи сразу, поэтому
+// несколько процессов не применят одну миграцию дважды.
+func (s *Store) Migrate(ctx context.Context) error {
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		applied, err := s.applyMigration(ctx, m)
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.Name, err)
+		}
+		if applied {
+			log.Printf("Applied migration %s", m.Name)
+		}
+	}
+	return nil
+}
+
+// applyMigration применяет миграцию m, если версия схемы меньше ее версии.
+func (s *Store) applyMigration(ctx context.Context, m storage.Migration) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(ctx, tx)
+	if err != nil || m.Version <= current {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES (?, false)", m.Version); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// schemaVersion возвращает версию схемы из schema_migrations (0 - миграции не применялись).
+func schemaVersion(ctx context.Context, q querier) (int64, error) {
+	var version int64
+	var dirty bool
+	err := q.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w: migration %d failed halfway, fix it manually and reset the dirty flag", storage.ErrDirtySchema, version)
+	}
+	return version, nil
+}
+
+// CheckSchema проверяет, что схема базы совместима с кодом: версия схемы не новее
+// встроенных миграций и все нужные таблицы и колонки на месте.
+func (s *Store) CheckSchema(ctx context.Context) error {
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	latest := list[len(list)-1].Version
+
+	current, err := schemaVersion(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("%w: %w", storage.ErrIncompatibleSchema, err)
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this build knows migrations up to %d", storage.ErrIncompatibleSchema, current, latest)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.name, c.name FROM sqlite_schema m JOIN pragma_table_info(m.name) c WHERE m.type = 'table'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return err
+		}
+		existing[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return storage.CheckColumns(existing)
+}
@@ -0,0 +1,1444 @@
+// Package sqlite - хранилище в файле SQLite для небольших установок на одном сервере.
+// Драйвер написан на чистом Go (modernc.org/sqlite), поэтому бинарник собирается без CGO.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+	_ "modernc.org/sqlite"
+)
+
+// pragmas - настройки каждого соединения: внешние ключи (каскадное удаление, как в Postgres),
+// ожидание блокировки вместо ошибки SQLITE_BUSY и WAL, чтобы чтение не ждало записи.
+const pragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+// Store - хранилище в файле SQLite с той же семантикой, что и Postgres-хранилище.
+type Store struct {
+	db *sql.DB
+	// tx - открытая транзакция WithTx; nil - запросы идут через пул соединений.
+	tx *sql.Tx
+	// timeout ограничивает время каждого вызова к базе.
+	timeout time.Duration
+}
+
+// querier - общие методы пула соединений и транзакции.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// IsDSN сообщает, указывает ли dsn на SQLite: sqlite:bot.db, sqlite://data/bot.db или sqlite:///var/lib/bot/bot.db.
+func IsDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "sqlite:")
+}
+
+// Open открывает (и при необходимости создает) файл базы из dsn вида sqlite:path.
+// queryTimeout ограничивает время каждого вызова к базе (0 - storage.DefaultQueryTimeout).
+func Open(ctx context.Context, dsn string, queryTimeout time.Duration) (*Store, error) {
+	path, ok := strings.CutPrefix(dsn, "sqlite:")
+	if !ok {
+		return nil, fmt.Errorf("not a sqlite dsn: %q", dsn)
+	}
+	path = strings.TrimPrefix(path, "//")
+	if path == "" {
+		return nil, errors.New("sqlite dsn has no file path")
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+sep+pragmas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite db: %w", err)
+	}
+	if queryTimeout <= 0 {
+		queryTimeout = storage.DefaultQueryTimeout
+	}
+	s := &Store{db: db, timeout: queryTimeout}
+	if err := s.Ping(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open sqlite db: %w", err)
+	}
+	return s, nil
+}
+
+// Close закрывает базу.
+func (s *Store) Close() {
+	s.db.Close()
+}
+
+// q возвращает то, через что выполняются запросы: транзакцию WithTx или пул соединений.
+func (s *Store) q() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// withTimeout ограничивает контекст вызова таймаутом запроса.
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// WithTx выполняет fn в одной транзакции: изменения фиксируются, только если fn
+// не вернула ошибку, иначе откатываются все сразу. Вложенные транзакции методов
+// хранилища внутри fn становятся точками сохранения.
+func (s *Store) WithTx(ctx context.Context, fn func(tx storage.Tx) error) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Store{db: s.db, tx: tx, timeout: s.timeout}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// inTx выполняет fn в транзакции, а внутри WithTx - в точке сохранения.
+func (s *Store) inTx(ctx context.Context, fn func(q querier) error) error {
+	if s.tx != nil {
+		if _, err := s.tx.ExecContext(ctx, "SAVEPOINT nested"); err != nil {
+			return err
+		}
+		if err := fn(s.tx); err != nil {
+			if _, rbErr := s.tx.ExecContext(ctx, "ROLLBACK TO nested"); rbErr != nil {
+				return errors.Join(err, rbErr)
+			}
+			_, relErr := s.tx.ExecContext(ctx, "RELEASE nested")
+			return errors.Join(err, relErr)
+		}
+		_, err := s.tx.ExecContext(ctx, "RELEASE nested")
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// micros переводит время в формат колонок времени - микросекунды Unix.
+func micros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// fromMicros переводит значение колонки времени обратно в time.Time.
+func fromMicros(us int64) time.Time {
+	return time.UnixMicro(us)
+}
+
+// Ping - проверка подключения к DB
+func (s *Store) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// PlayerExists - проверяем состоит ли игрок в чате
+func (s *Store) PlayerExists(ctx context.Context, chatID int64, tgID int64) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.q().QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM chat_players WHERE chat_id = ? AND player_tg_id = ?)",
+		chatID, tgID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// AddPlayer - добавляем и обновляем игрока, записываем его в чат
+func (s *Store) AddPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO players (tg_id, username, display_name) VALUES (?, ?, ?)
+			 ON CONFLICT (tg_id) DO UPDATE SET username = excluded.username, display_name = excluded.display_name`,
+			tgID, username, displayName)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx,
+			"INSERT INTO chat_players (chat_id, player_tg_id, score, joined_at) VALUES (?, ?, 0, ?) ON CONFLICT DO NOTHING",
+			chatID, tgID, micros(time.Now()))
+		return err
+	})
+}
+
+// scanPlayers читает строки вида (tg_id, username, display_name, score, rating).
+func scanPlayers(rows *sql.Rows) ([]storage.Player, error) {
+	defer rows.Close()
+
+	var players []storage.Player
+	for rows.Next() {
+		var p storage.Player
+		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// GetAllPlayers - Получение всех игроков чата
+func (s *Store) GetAllPlayers(ctx context.Context, chatID int64) ([]storage.Player, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating
+		 FROM chat_players cp
+		 JOIN players p ON cp.player_tg_id = p.tg_id
+		 WHERE cp.chat_id = ?
+		 ORDER BY cp.joined_at, p.tg_id`,
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanPlayers(rows)
+}
+
+// GetPlayerByTGID - смотрим игрока чата по tgID. Если его нет, возвращает storage.ErrNotFound.
+func (s *Store) GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var p storage.Player
+	err := s.q().QueryRowContext(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating
+		 FROM chat_players cp
+		 JOIN players p ON cp.player_tg_id = p.tg_id
+		 WHERE cp.chat_id = ? AND cp.player_tg_id = ?`,
+		chatID, tgID,
+	).Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CheckPlayersExist проверяет, что все игроки с переданными tgID состоят в чате.
+func (s *Store) CheckPlayersExist(ctx context.Context, chatID int64, tgIDs []int64) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if len(tgIDs) == 0 {
+		return true, nil // Нет игроков для проверки
+	}
+
+	args := []any{chatID}
+	for _, id := range tgIDs {
+		args = append(args, id)
+	}
+	var count int
+	err := s.q().QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM chat_players WHERE chat_id = ? AND player_tg_id IN ("+placeholders(len(tgIDs))+")",
+		args...,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count == len(tgIDs), nil
+}
+
+// placeholders возвращает n параметров запроса через запятую: "?, ?, ?".
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// UpdatePlayerScore - добавляем очки игроку в чате
+func (s *Store) UpdatePlayerScore(ctx context.Context, chatID int64, tgID int64, pointsToAdd int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q().ExecContext(ctx,
+		"UPDATE chat_players SET score = score + ? WHERE chat_id = ? AND player_tg_id = ?",
+		pointsToAdd, chatID, tgID,
+	)
+	return err
+}
+
+// ListChats возвращает все чаты, в которых есть игроки.
+func (s *Store) ListChats(ctx context.Context) ([]int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx, "SELECT DISTINCT chat_id FROM chat_players ORDER BY chat_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chats = append(chats, chatID)
+	}
+	return chats, rows.Err()
+}
+
+// GetChatScoring возвращает ключ стратегии подсчёта очков чата.
+// Если чат ничего не выбирал, возвращается пустая строка.
+func (s *Store) GetChatScoring(ctx context.Context, chatID int64) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var scoring string
+	err := s.q().QueryRowContext(ctx, "SELECT scoring FROM chat_settings WHERE chat_id = ?", chatID).Scan(&scoring)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return scoring, err
+}
+
+// SetChatScoring сохраняет стратегию подсчёта очков чата.
+func (s *Store) SetChatScoring(ctx context.Context, chatID int64, scoring string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q().ExecContext(ctx,
+		`INSERT INTO chat_settings (chat_id, scoring) VALUES (?, ?)
+		 ON CONFLICT (chat_id) DO UPDATE SET scoring = excluded.scoring`,
+		chatID, scoring,
+	)
+	return err
+}
+
+// GetChatGameConfig возвращает настройки игры чата или nil, если чат их не менял.
+func (s *Store) GetChatGameConfig(ctx context.Context, chatID int64) (*storage.GameConfig, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var cfg storage.GameConfig
+	err := s.q().QueryRowContext(ctx,
+		`SELECT min_players, max_players, auto_place_last FROM chat_settings
+		 WHERE chat_id = ? AND min_players IS NOT NULL AND max_players IS NOT NULL AND auto_place_last IS NOT NULL`,
+		chatID,
+	).Scan(&cfg.MinPlayers, &cfg.MaxPlayers, &cfg.AutoPlaceLast)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SetChatGameConfig сохраняет настройки игры чата. Если строки настроек чата еще нет, стратегия
+// подсчёта очков остается пустой, то есть по умолчанию.
+func (s *Store) SetChatGameConfig(ctx context.Context, chatID int64, cfg storage.GameConfig) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q().ExecContext(ctx,
+		`INSERT INTO chat_settings (chat_id, scoring, min_players, max_players, auto_place_last) VALUES (?, '', ?, ?, ?)
+		 ON CONFLICT (chat_id) DO UPDATE SET min_players = excluded.min_players,
+		   max_players = excluded.max_players, auto_place_last = excluded.auto_place_last`,
+		chatID, cfg.MinPlayers, cfg.MaxPlayers, cfg.AutoPlaceLast,
+	)
+	return err
+}
+
+// CreateGame создает новую игру в чате и возвращает ее ID.
+// Игра привязывается к текущему сезону чата, если он есть. recordedBy - кто ее записал.
+func (s *Store) CreateGame(ctx context.Context, chatID int64, scoring string, recordedBy int64) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var gameID int
+	err := s.q().QueryRowContext(ctx,
+		`INSERT INTO games (chat_id, scoring, season_id, recorded_by, created_at)
+		 VALUES (?1, ?2, (SELECT id FROM seasons WHERE chat_id = ?1 AND ended_at IS NULL), ?3, ?4)
+		 RETURNING id`,
+		chatID, scoring, recordedBy, micros(time.Now()),
+	).Scan(&gameID)
+	return gameID, err
+}
+
+// SaveGameResults - Сохранение результатов игры
+func (s *Store) SaveGameResults(ctx context.Context, results []storage.GameResult) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		for _, r := range results {
+			_, err := q.ExecContext(ctx,
+				"INSERT INTO game_results (game_id, user_id, place, points, status) VALUES (?, ?, ?, ?, ?)",
+				r.GameID, r.Player.TGID, r.Place, r.Points, storage.ResultStatus(r.DNF),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetResultPoints исправляет очки игрока в результатах игры.
+func (s *Store) SetResultPoints(ctx context.Context, gameID int, tgID int64, points int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q().ExecContext(ctx,
+		"UPDATE game_results SET points = ? WHERE game_id = ? AND user_id = ?",
+		points, gameID, tgID,
+	)
+	return err
+}
+
+// LoadGamesByYear - Получение результатов игр чата за год
+func (s *Store) LoadGamesByYear(ctx context.Context, chatID int64, year int) ([]storage.GameResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT r.game_id, p.tg_id, p.username, p.display_name, r.place, r.points, r.status = 'dnf', g.created_at
+		 FROM game_results r
+		 JOIN players p ON r.user_id = p.tg_id
+		 JOIN games g ON r.game_id = g.id
+		 WHERE g.chat_id = ? AND CAST(strftime('%Y', g.created_at / 1000000, 'unixepoch', 'localtime') AS INTEGER) = ?
+		 ORDER BY g.id, r.place, r.id`,
+		chatID, year,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanGameResults(rows)
+}
+
+// LoadAllGames - Получение результатов всех игр чата в порядке их записи
+func (s *Store) LoadAllGames(ctx context.Context, chatID int64) ([]storage.GameResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT r.game_id, p.tg_id, p.username, p.display_name, r.place, r.points, r.status = 'dnf', g.created_at
+		 FROM game_results r
+		 JOIN players p ON r.user_id = p.tg_id
+		 JOIN games g ON r.game_id = g.id
+		 WHERE g.chat_id = ?
+		 ORDER BY g.id, r.place, r.id`,
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanGameResults(rows)
+}
+
+// scanGameResults читает строки вида (game_id, tg_id, username, display_name, place, points, dnf, created_at).
+func scanGameResults(rows *sql.Rows) ([]storage.GameResult, error) {
+	defer rows.Close()
+
+	var results []storage.GameResult
+	for rows.Next() {
+		var r storage.GameResult
+		var date int64
+		if err := rows.Scan(&r.GameID, &r.Player.TGID, &r.Player.Username, &r.Player.DisplayName, &r.Place, &r.Points, &r.DNF, &date); err != nil {
+			return nil, err
+		}
+		r.Date = fromMicros(date)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// CreateRecordingSession создает новую сессию записи для сообщения messageID. Запись начинается
+// с набора состава игры. Другие сессии чата не затрагиваются: в чате можно записывать несколько игр одновременно.
+func (s *Store) CreateRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q().ExecContext(ctx,
+		"INSERT INTO recording_sessions (chat_id, message_id, owner_tg_id, lineup_open, created_at, updated_at) VALUES (?1, ?2, ?3, 1, ?4, ?4)",
+		chatID, messageID, ownerTGID, micros(time.Now()),
+	)
+	return err
+}
+
+// CreateEditSession создает сессию редактирования игры gameID, заполненную текущими местами игроков.
+func (s *Store) CreateEditSession(ctx context.Context, chatID int64, messageID int64, gameID int, ownerTGID int64, players []storage.SessionPlayer) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO recording_sessions (chat_id, message_id, edit_game_id, owner_tg_id, created_at, updated_at)
+			 VALUES (?1, ?2, ?3, ?4, ?5, ?5)`,
+			chatID, messageID, gameID, ownerTGID, micros(time.Now()),
+		)
+		if err != nil {
+			return err
+		}
+
+		// Игроки считаются выбранными в порядке мест
+		for i, p := range players {
+			_, err = q.ExecContext(ctx,
+				"INSERT INTO session_players (session_chat_id, session_message_id, player_tg_id, place, status, seq) VALUES (?, ?, ?, ?, ?, ?)",
+				chatID, messageID, p.Player.TGID, p.Place, storage.ResultStatus(p.DNF), i+1,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRecordingSession возвращает сессию записи сообщения messageID в чате.
+func (s *Store) GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*storage.RecordingSession, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	session, err := scanSession(s.q().QueryRowContext(ctx,
+		"SELECT "+sessionColumns+" FROM recording_sessions WHERE chat_id = ? AND message_id = ?",
+		chatID, messageID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // Сессии не существует
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// sessionColumns - колонки recording_sessions в порядке scanSession.
+const sessionColumns = "chat_id, message_id, COALESCE(edit_game_id, 0), owner_tg_id, lineup_open, created_at, updated_at"
+
+// scanSession читает сессию записи из строки с колонками sessionColumns.
+func scanSession(row interface{ Scan(dest ...any) error }) (storage.RecordingSession, error) {
+	var session storage.RecordingSession
+	var createdAt, updatedAt int64
+	if err := row.Scan(&session.ChatID, &session.MessageID, &session.EditGameID, &session.OwnerTGID, &session.LineupOpen, &createdAt, &updatedAt); err != nil {
+		return storage.RecordingSession{}, err
+	}
+	session.CreatedAt = fromMicros(createdAt)
+	session.UpdatedAt = fromMicros(updatedAt)
+	return session, nil
+}
+
+// AddPlayerToSession добавляет игрока в сессию записи и продлевает ее. Если tied, игрок делит
+// место с последним выбранным, иначе встает на следующее место с учетом всех, кто выше.
+func (s *Store) AddPlayerToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		// Место считается в том же запросе, как в спортивном рейтинге: после двоих на 2-м месте следующий занимает 4-е.
+		// Выбывшие мест не занимают и не учитываются.
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO session_players (session_chat_id, session_message_id, player_tg_id, place, seq)
+			 SELECT ?1, ?2, ?3, CASE WHEN ?4 THEN COALESCE(MAX(place), 1) ELSE COUNT(*) + 1 END, `+nextSessionSeq+` FROM session_players
+			 WHERE session_chat_id = ?1 AND session_message_id = ?2 AND status <> 'dnf'`,
+			chatID, messageID, playerTgID, tied,
+		)
+		if err != nil {
+			return err
+		}
+		return touchSession(ctx, q, chatID, messageID)
+	})
+}
+
+// AddDNFToSession добавляет в сессию записи выбывшего игрока и продлевает ее.
+// Выбывший не занимает места, доигравшие не сдвигаются.
+func (s *Store) AddDNFToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO session_players (session_chat_id, session_message_id, player_tg_id, place, status, seq)
+			 VALUES (?1, ?2, ?3, 0, 'dnf', `+nextSessionSeq+`)`,
+			chatID, messageID, playerTgID,
+		)
+		if err != nil {
+			return err
+		}
+		return touchSession(ctx, q, chatID, messageID)
+	})
+}
+
+// nextSessionSeq - номер следующего выбора в сессии ?1, ?2: по нему "⬅️ Назад" находит последнего выбранного.
+const nextSessionSeq = "(SELECT COALESCE(MAX(seq), 0) + 1 FROM session_players WHERE session_chat_id = ?1 AND session_message_id = ?2)"
+
+// touchSession отмечает действие в сессии записи, чтобы она не истекла.
+func touchSession(ctx context.Context, q querier, chatID int64, messageID int64) error {
+	_, err := q.ExecContext(ctx,
+		"UPDATE recording_sessions SET updated_at = ? WHERE chat_id = ? AND message_id = ?",
+		micros(time.Now()), chatID, messageID,
+	)
+	return err
+}
+
+// RemovePlayerFromSession убирает игрока из сессии, игроки ниже него поднимаются на место вверх
+// (после выбывшего места не сдвигаются). Сессия продлевается.
+func (s *Store) RemovePlayerFromSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		var place int
+		var status string
+		err := q.QueryRowContext(ctx,
+			`DELETE FROM session_players
+			 WHERE session_chat_id = ? AND session_message_id = ? AND player_tg_id = ?
+			 RETURNING place, status`,
+			chatID, messageID, playerTgID,
+		).Scan(&place, &status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil // Игрока уже нет в сессии
+		}
+		if err != nil {
+			return err
+		}
+
+		if status != storage.StatusDNF {
+			_, err = q.ExecContext(ctx,
+				"UPDATE session_players SET place = place - 1 WHERE session_chat_id = ? AND session_message_id = ? AND place > ?",
+				chatID, messageID, place,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return touchSession(ctx, q, chatID, messageID)
+	})
+}
+
+// GetLastSelectedPlayer возвращает Telegram ID игрока, выбранного в сессии последним (в том числе
+// выбывшего), или 0, если в сессии никого нет.
+func (s *Store) GetLastSelectedPlayer(ctx context.Context, chatID int64, messageID int64) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var tgID int64
+	err := s.q().QueryRowContext(ctx,
+		`SELECT player_tg_id FROM session_players
+		 WHERE session_chat_id = ? AND session_message_id = ?
+		 ORDER BY seq DESC, place DESC, player_tg_id DESC
+		 LIMIT 1`,
+		chatID, messageID,
+	).Scan(&tgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return tgID, err
+}
+
+// SwapSessionPlayers меняет местами двух игроков сессии. Если кого-то из них нет среди
+// доигравших, ничего не делает.
+func (s *Store) SwapSessionPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) error {
+	if firstTgID == secondTgID {
+		return nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		var firstPlace, secondPlace int
+		err := q.QueryRowContext(ctx,
+			`SELECT
+			   COALESCE(MAX(CASE WHEN player_tg_id = ? THEN place END), 0),
+			   COALESCE(MAX(CASE WHEN player_tg_id = ? THEN place END), 0)
+			 FROM session_players
+			 WHERE session_chat_id = ? AND session_message_id = ?`,
+			firstTgID, secondTgID, chatID, messageID,
+		).Scan(&firstPlace, &secondPlace)
+		if err != nil {
+			return err
+		}
+		if firstPlace == 0 || secondPlace == 0 {
+			return nil // Кого-то из игроков уже нет в сессии или он выбыл
+		}
+
+		_, err = q.ExecContext(ctx,
+			`UPDATE session_players SET place = CASE player_tg_id WHEN ? THEN ? ELSE ? END
+			 WHERE session_chat_id = ? AND session_message_id = ? AND player_tg_id IN (?, ?)`,
+			firstTgID, secondPlace, firstPlace, chatID, messageID, firstTgID, secondTgID,
+		)
+		if err != nil {
+			return err
+		}
+		return touchSession(ctx, q, chatID, messageID)
+	})
+}
+
+// GetSessionPlayers возвращает всех игроков в сессии с их местами, выбывшие идут последними.
+// Игроки, делящие место, идут в порядке Telegram ID.
+func (s *Store) GetSessionPlayers(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating, sp.place, sp.status = 'dnf'
+		 FROM session_players sp
+		 JOIN players p ON sp.player_tg_id = p.tg_id
+		 JOIN chat_players cp ON cp.chat_id = sp.session_chat_id AND cp.player_tg_id = sp.player_tg_id
+		 WHERE sp.session_chat_id = ? AND sp.session_message_id = ?
+		 ORDER BY sp.status = 'dnf', sp.place ASC, sp.player_tg_id ASC`,
+		chatID, messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []storage.SessionPlayer
+	for rows.Next() {
+		var sp storage.SessionPlayer
+		p := &sp.Player
+		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating, &sp.Place, &sp.DNF); err != nil {
+			return nil, err
+		}
+		players = append(players, sp)
+	}
+	return players, rows.Err()
+}
+
+// AddPlayerToLineup добавляет игрока в состав игры сессии и продлевает ее.
+// Если игрок уже в составе, ничего не меняется.
+func (s *Store) AddPlayerToLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO session_lineup (session_chat_id, session_message_id, player_tg_id) VALUES (?, ?, ?)
+			 ON CONFLICT DO NOTHING`,
+			chatID, messageID, playerTgID,
+		)
+		if err != nil {
+			return err
+		}
+		return touchSession(ctx, q, chatID, messageID)
+	})
+}
+
+// RemovePlayerFromLineup убирает игрока из состава игры сессии и продлевает ее.
+func (s *Store) RemovePlayerFromLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		_, err := q.ExecContext(ctx,
+			"DELETE FROM session_lineup WHERE session_chat_id = ? AND session_message_id = ? AND player_tg_id = ?",
+			chatID, messageID, playerTgID,
+		)
+		if err != nil {
+			return err
+		}
+		return touchSession(ctx, q, chatID, messageID)
+	})
+}
+
+// GetSessionLineup возвращает состав игры сессии в том же порядке, что и GetAllPlayers.
+func (s *Store) GetSessionLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating
+		 FROM session_lineup sl
+		 JOIN players p ON sl.player_tg_id = p.tg_id
+		 JOIN chat_players cp ON cp.chat_id = sl.session_chat_id AND cp.player_tg_id = sl.player_tg_id
+		 WHERE sl.session_chat_id = ? AND sl.session_message_id = ?
+		 ORDER BY cp.joined_at, p.tg_id`,
+		chatID, messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []storage.Player
+	for rows.Next() {
+		var p storage.Player
+		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// SetLineupOpen открывает или закрывает набор состава игры сессии и продлевает ее.
+func (s *Store) SetLineupOpen(ctx context.Context, chatID int64, messageID int64, open bool) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q().ExecContext(ctx,
+		"UPDATE recording_sessions SET lineup_open = ?, updated_at = ? WHERE chat_id = ? AND message_id = ?",
+		open, micros(time.Now()), chatID, messageID,
+	)
+	return err
+}
+
+// DeleteRecordingSession удаляет сессию записи и всех связанных с ней игроков.
+func (s *Store) DeleteRecordingSession(ctx context.Context, chatID int64, messageID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.q().ExecContext(ctx, "DELETE FROM recording_sessions WHERE chat_id = ? AND message_id = ?", chatID, messageID)
+	return err
+}
+
+// DeleteExpiredSessions удаляет сессии записи всех чатов, в которых ничего не происходило
+// с момента before, и возвращает удаленные сессии.
+func (s *Store) DeleteExpiredSessions(ctx context.Context, before time.Time) ([]storage.RecordingSession, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		"DELETE FROM recording_sessions WHERE updated_at < ? RETURNING "+sessionColumns,
+		micros(before),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []storage.RecordingSession
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// SaveRatingChanges сохраняет новые рейтинги игроков чата и записывает их в историю.
+func (s *Store) SaveRatingChanges(ctx context.Context, chatID int64, changes []storage.RatingChange) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := micros(time.Now())
+	return s.inTx(ctx, func(q querier) error {
+		for _, c := range changes {
+			_, err := q.ExecContext(ctx,
+				`INSERT INTO rating_history (game_id, chat_id, player_tg_id, rating_before, rating_after, created_at)
+				 VALUES (?, ?, ?, ?, ?, ?)`,
+				c.GameID, chatID, c.TGID, c.Before, c.After, now,
+			)
+			if err != nil {
+				return err
+			}
+			_, err = q.ExecContext(ctx,
+				"UPDATE chat_players SET rating = ? WHERE chat_id = ? AND player_tg_id = ?",
+				c.After, chatID, c.TGID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRatingHistory возвращает последние изменения рейтинга игрока в чате, начиная с самых новых.
+func (s *Store) GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]storage.RatingChange, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT game_id, player_tg_id, rating_before, rating_after, created_at
+		 FROM rating_history
+		 WHERE chat_id = ? AND player_tg_id = ?
+		 ORDER BY game_id DESC
+		 LIMIT ?`,
+		chatID, tgID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []storage.RatingChange
+	for rows.Next() {
+		var c storage.RatingChange
+		var date int64
+		if err := rows.Scan(&c.GameID, &c.TGID, &c.Before, &c.After, &date); err != nil {
+			return nil, err
+		}
+		c.Date = fromMicros(date)
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// ReplaceRatings перезаписывает историю и текущие рейтинги Эло чата, например после
+// пересчета всех игр. Игроки без игр получают начальный рейтинг initial.
+func (s *Store) ReplaceRatings(ctx context.Context, chatID int64, history []storage.RatingChange, initial float64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		if _, err := q.ExecContext(ctx, "DELETE FROM rating_history WHERE chat_id = ?", chatID); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, "UPDATE chat_players SET rating = ? WHERE chat_id = ?", initial, chatID); err != nil {
+			return err
+		}
+
+		for _, c := range history {
+			_, err := q.ExecContext(ctx,
+				`INSERT INTO rating_history (game_id, chat_id, player_tg_id, rating_before, rating_after, created_at)
+				 VALUES (?, ?, ?, ?, ?, ?)`,
+				c.GameID, chatID, c.TGID, c.Before, c.After, micros(c.Date),
+			)
+			if err != nil {
+				return err
+			}
+			// История идет по порядку игр, поэтому последняя запись игрока - его текущий рейтинг
+			_, err = q.ExecContext(ctx,
+				"UPDATE chat_players SET rating = ? WHERE chat_id = ? AND player_tg_id = ?",
+				c.After, chatID, c.TGID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateSeason начинает новый сезон в чате и обнуляет очки игроков, чтобы в таблицу сезона
+// не попали очки, набранные до него. Всё выполняется в одной транзакции.
+func (s *Store) CreateSeason(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	season := storage.Season{ChatID: chatID, Name: name, StartedAt: fromMicros(micros(time.Now()))}
+	err := s.inTx(ctx, func(q querier) error {
+		err := q.QueryRowContext(ctx,
+			"INSERT INTO seasons (chat_id, name, started_at) VALUES (?, ?, ?) RETURNING id",
+			chatID, name, micros(season.StartedAt),
+		).Scan(&season.ID)
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx, "UPDATE chat_players SET score = 0 WHERE chat_id = ?", chatID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// scanSeason читает строку вида (id, chat_id, name, started_at, ended_at).
+func scanSeason(row interface{ Scan(dest ...any) error }) (storage.Season, error) {
+	var season storage.Season
+	var started int64
+	var ended sql.NullInt64
+	if err := row.Scan(&season.ID, &season.ChatID, &season.Name, &started, &ended); err != nil {
+		return season, err
+	}
+	season.StartedAt = fromMicros(started)
+	if ended.Valid {
+		t := fromMicros(ended.Int64)
+		season.EndedAt = &t
+	}
+	return season, nil
+}
+
+// GetActiveSeason возвращает незавершенный сезон чата или nil, если его нет.
+func (s *Store) GetActiveSeason(ctx context.Context, chatID int64) (*storage.Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	season, err := scanSeason(s.q().QueryRowContext(ctx,
+		"SELECT id, chat_id, name, started_at, ended_at FROM seasons WHERE chat_id = ? AND ended_at IS NULL",
+		chatID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetSeasonByName возвращает сезон чата по названию или nil, если его нет.
+func (s *Store) GetSeasonByName(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	season, err := scanSeason(s.q().QueryRowContext(ctx,
+		"SELECT id, chat_id, name, started_at, ended_at FROM seasons WHERE chat_id = ? AND name = ?",
+		chatID, name,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// ListSeasons возвращает все сезоны чата, начиная с последнего.
+func (s *Store) ListSeasons(ctx context.Context, chatID int64) ([]storage.Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		"SELECT id, chat_id, name, started_at, ended_at FROM seasons WHERE chat_id = ? ORDER BY started_at DESC, id DESC",
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seasons []storage.Season
+	for rows.Next() {
+		season, err := scanSeason(rows)
+		if err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, season)
+	}
+	return seasons, rows.Err()
+}
+
+// EndSeason завершает сезон: сохраняет итоговую таблицу по текущим очкам игроков чата
+// и обнуляет их очки. Всё выполняется в одной транзакции.
+func (s *Store) EndSeason(ctx context.Context, chatID int64, seasonID int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO season_standings (season_id, player_tg_id, place, score, games)
+			 SELECT ?2, cp.player_tg_id,
+			        RANK() OVER (ORDER BY cp.score DESC),
+			        cp.score,
+			        (SELECT COUNT(*) FROM game_results r JOIN games g ON r.game_id = g.id
+			         WHERE g.season_id = ?2 AND r.user_id = cp.player_tg_id)
+			 FROM chat_players cp
+			 WHERE cp.chat_id = ?1`,
+			chatID, seasonID,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := q.ExecContext(ctx, "UPDATE chat_players SET score = 0 WHERE chat_id = ?", chatID); err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx,
+			"UPDATE seasons SET ended_at = ? WHERE id = ? AND chat_id = ?",
+			micros(time.Now()), seasonID, chatID,
+		)
+		return err
+	})
+}
+
+// GetSeasonStandings возвращает сохраненную итоговую таблицу сезона.
+func (s *Store) GetSeasonStandings(ctx context.Context, seasonID int) ([]storage.SeasonStanding, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, ss.place, ss.score, ss.games
+		 FROM season_standings ss
+		 JOIN players p ON ss.player_tg_id = p.tg_id
+		 WHERE ss.season_id = ?
+		 ORDER BY ss.place, p.display_name`,
+		seasonID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []storage.SeasonStanding
+	for rows.Next() {
+		var st storage.SeasonStanding
+		if err := rows.Scan(&st.Player.TGID, &st.Player.Username, &st.Player.DisplayName, &st.Place, &st.Score, &st.Games); err != nil {
+			return nil, err
+		}
+		st.Player.Score = st.Score
+		standings = append(standings, st)
+	}
+	return standings, rows.Err()
+}
+
+// GetSeasonGameCounts возвращает, сколько игр сезона сыграл каждый игрок. Игры относятся
+// к сезону, в котором были записаны; игры, из которых игрок выбыл, тоже считаются.
+func (s *Store) GetSeasonGameCounts(ctx context.Context, seasonID int) (map[int64]int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT r.user_id, COUNT(*)
+		 FROM game_results r
+		 JOIN games g ON r.game_id = g.id
+		 WHERE g.season_id = ?
+		 GROUP BY r.user_id`,
+		seasonID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var tgID int64
+		var games int
+		if err := rows.Scan(&tgID, &games); err != nil {
+			return nil, err
+		}
+		counts[tgID] = games
+	}
+	return counts, rows.Err()
+}
+
+// GetGame возвращает игру чата вместе с результатами или nil, если такой игры нет.
+func (s *Store) GetGame(ctx context.Context, chatID int64, gameID int) (*storage.Game, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	games, err := s.loadGames(ctx, "WHERE chat_id = ? AND id = ?", chatID, gameID)
+	if err != nil || len(games) == 0 {
+		return nil, err
+	}
+	return &games[0], nil
+}
+
+// GetLastGame возвращает последнюю записанную игру чата или nil, если игр не было.
+func (s *Store) GetLastGame(ctx context.Context, chatID int64) (*storage.Game, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	games, err := s.loadGames(ctx, "WHERE chat_id = ? ORDER BY id DESC LIMIT 1", chatID)
+	if err != nil || len(games) == 0 {
+		return nil, err
+	}
+	return &games[0], nil
+}
+
+// ListGames возвращает страницу игр чата (сначала новые) и общее число игр.
+func (s *Store) ListGames(ctx context.Context, chatID int64, offset, limit int) ([]storage.Game, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var total int
+	err := s.q().QueryRowContext(ctx, "SELECT COUNT(*) FROM games WHERE chat_id = ?", chatID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	games, err := s.loadGames(ctx, "WHERE chat_id = ? ORDER BY id DESC LIMIT ? OFFSET ?", chatID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return games, total, nil
+}
+
+// LoadGamesSince возвращает игры чата, записанные после since, вместе с результатами, в порядке записи.
+func (s *Store) LoadGamesSince(ctx context.Context, chatID int64, since time.Time) ([]storage.Game, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.loadGames(ctx, "WHERE chat_id = ? AND created_at > ? ORDER BY id", chatID, micros(since))
+}
+
+// loadGames возвращает игры, выбранные условием where, вместе с результатами.
+func (s *Store) loadGames(ctx context.Context, where string, args ...any) ([]storage.Game, error) {
+	rows, err := s.q().QueryContext(ctx, "SELECT id, chat_id, scoring, recorded_by, created_at FROM games "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []storage.Game
+	var ids []any
+	for rows.Next() {
+		var g storage.Game
+		var created int64
+		if err := rows.Scan(&g.ID, &g.ChatID, &g.Scoring, &g.RecordedBy, &created); err != nil {
+			return nil, err
+		}
+		g.CreatedAt = fromMicros(created)
+		games = append(games, g)
+		ids = append(ids, g.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(games) == 0 {
+		return nil, nil
+	}
+
+	results, err := s.loadResultsOfGames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range games {
+		games[i].Results = results[games[i].ID]
+	}
+	return games, nil
+}
+
+// loadResultsOfGames возвращает результаты нескольких игр, сгруппированные по ID игры.
+func (s *Store) loadResultsOfGames(ctx context.Context, gameIDs []any) (map[int][]storage.GameResult, error) {
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT r.game_id, p.tg_id, p.username, p.display_name, r.place, r.points, r.status = 'dnf', g.created_at,
+		        COALESCE(rh.rating_before, 0), COALESCE(rh.rating_after, 0)
+		 FROM game_results r
+		 JOIN players p ON r.user_id = p.tg_id
+		 JOIN games g ON r.game_id = g.id
+		 LEFT JOIN rating_history rh ON rh.game_id = r.game_id AND rh.player_tg_id = r.user_id
+		 WHERE r.game_id IN (`+placeholders(len(gameIDs))+`)
+		 ORDER BY r.game_id, r.place, r.id`,
+		gameIDs...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make(map[int][]storage.GameResult, len(gameIDs))
+	for rows.Next() {
+		var r storage.GameResult
+		var date int64
+		if err := rows.Scan(&r.GameID, &r.Player.TGID, &r.Player.Username, &r.Player.DisplayName,
+			&r.Place, &r.Points, &r.DNF, &date, &r.RatingBefore, &r.RatingAfter); err != nil {
+			return nil, err
+		}
+		r.Date = fromMicros(date)
+		results[r.GameID] = append(results[r.GameID], r)
+	}
+	return results, rows.Err()
+}
+
+// auditResult - результат игрока в записи журнала.
+type auditResult struct {
+	TGID   int64 `json:"tg_id"`
+	Place  int   `json:"place"`
+	Points int   `json:"points"`
+	DNF    bool  `json:"dnf,omitempty"`
+}
+
+// DeleteGame удаляет игру в одной транзакции: вычитает начисленные очки, возвращает
+// рейтинги Эло участников к значениям до игры, удаляет результаты и пишет запись в журнал.
+func (s *Store) DeleteGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.inTx(ctx, func(q querier) error {
+		rows, err := q.QueryContext(ctx,
+			"SELECT user_id, place, points FROM game_results WHERE game_id = ? ORDER BY place, id",
+			gameID,
+		)
+		if err != nil {
+			return err
+		}
+		var deleted []auditResult
+		for rows.Next() {
+			var r auditResult
+			if err := rows.Scan(&r.TGID, &r.Place, &r.Points); err != nil {
+				rows.Close()
+				return err
+			}
+			deleted = append(deleted, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range deleted {
+			_, err := q.ExecContext(ctx,
+				"UPDATE chat_players SET score = score - ? WHERE chat_id = ? AND player_tg_id = ?",
+				r.Points, chatID, r.TGID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = q.ExecContext(ctx,
+			`UPDATE chat_players AS cp SET rating = rh.rating_before
+			 FROM rating_history rh
+			 WHERE rh.game_id = ? AND cp.chat_id = rh.chat_id AND cp.player_tg_id = rh.player_tg_id`,
+			gameID,
+		)
+		if err != nil {
+			return err
+		}
+
+		details, err := json.Marshal(map[string]any{"results": deleted})
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx,
+			"INSERT INTO game_audit (chat_id, game_id, action, actor_tg_id, details, created_at) VALUES (?, ?, 'undo', ?, ?, ?)",
+			chatID, gameID, actorTGID, string(details), micros(time.Now()),
+		)
+		if err != nil {
+			return err
+		}
+
+		// Результаты и история рейтинга удаляются каскадно
+		res, err := q.ExecContext(ctx, "DELETE FROM games WHERE chat_id = ? AND id = ?", chatID, gameID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return storage.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// UpdateGameResults заменяет результаты игры новыми в одной транзакции: сохраняет прежние
+// места как очередную версию, корректирует очки игроков на разницу и пишет запись в журнал.
+func (s *Store) UpdateGameResults(ctx context.Context, chatID int64, gameID int, results []storage.GameResult, editorTGID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := micros(time.Now())
+	return s.inTx(ctx, func(q querier) error {
+		var version int
+		err := q.QueryRowContext(ctx,
+			"SELECT COALESCE(MAX(version), 0) + 1 FROM game_result_versions WHERE game_id = ?",
+			gameID,
+		).Scan(&version)
+		if err != nil {
+			return err
+		}
+
+		// Прежние результаты уходят в историю версий, их очки списываются
+		_, err = q.ExecContext(ctx,
+			`INSERT INTO game_result_versions (game_id, version, player_tg_id, place, points, status, edited_by, edited_at)
+			 SELECT game_id, ?2, user_id, place, points, status, ?3, ?4 FROM game_results WHERE game_id = ?1`,
+			gameID, version, editorTGID, now,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx,
+			`UPDATE chat_players AS cp SET score = cp.score - r.points
+			 FROM game_results r
+			 WHERE r.game_id = ? AND cp.chat_id = ? AND cp.player_tg_id = r.user_id`,
+			gameID, chatID,
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, "DELETE FROM game_results WHERE game_id = ?", gameID); err != nil {
+			return err
+		}
+
+		var edited []auditResult
+		for _, r := range results {
+			_, err := q.ExecContext(ctx,
+				"INSERT INTO game_results (game_id, user_id, place, points, status) VALUES (?, ?, ?, ?, ?)",
+				gameID, r.Player.TGID, r.Place, r.Points, storage.ResultStatus(r.DNF),
+			)
+			if err != nil {
+				return err
+			}
+			_, err = q.ExecContext(ctx,
+				"UPDATE chat_players SET score = score + ? WHERE chat_id = ? AND player_tg_id = ?",
+				r.Points, chatID, r.Player.TGID,
+			)
+			if err != nil {
+				return err
+			}
+			edited = append(edited, auditResult{TGID: r.Player.TGID, Place: r.Place, Points: r.Points, DNF: r.DNF})
+		}
+
+		details, err := json.Marshal(map[string]any{"version": version, "results": edited})
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx,
+			"INSERT INTO game_audit (chat_id, game_id, action, actor_tg_id, details, created_at) VALUES (?, ?, 'edit', ?, ?, ?)",
+			chatID, gameID, editorTGID, string(details), now,
+		)
+		return err
+	})
+}
+
+// GetGameVersions возвращает предыдущие версии результатов игры, начиная с исходной.
+func (s *Store) GetGameVersions(ctx context.Context, gameID int) ([]storage.GameVersion, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.q().QueryContext(ctx,
+		`SELECT v.version, v.edited_by, COALESCE(e.display_name, ''), v.edited_at,
+		        p.tg_id, p.username, p.display_name, v.place, v.points, v.status = 'dnf'
+		 FROM game_result_versions v
+		 JOIN players p ON v.player_tg_id = p.tg_id
+		 LEFT JOIN players e ON v.edited_by = e.tg_id
+		 WHERE v.game_id = ?
+		 ORDER BY v.version, v.place, v.player_tg_id`,
+		gameID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []storage.GameVersion
+	for rows.Next() {
+		var v storage.GameVersion
+		var r storage.GameResult
+		var editedAt int64
+		if err := rows.Scan(&v.Version, &v.EditedBy.TGID, &v.EditedBy.DisplayName, &editedAt,
+			&r.Player.TGID, &r.Player.Username, &r.Player.DisplayName, &r.Place, &r.Points, &r.DNF); err != nil {
+			return nil, err
+		}
+		v.EditedAt = fromMicros(editedAt)
+		r.GameID = gameID
+		if len(versions) == 0 || versions[len(versions)-1].Version != v.Version {
+			versions = append(versions, v)
+		}
+		last := &versions[len(versions)-1]
+		last.Results = append(last.Results, r)
+	}
+	return versions, rows.Err()
+}
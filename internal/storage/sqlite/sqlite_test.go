@@ -0,0 +1,57 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage/sqlite"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ service.StorageInterface = (*sqlite.Store)(nil)
+
+// open создает базу во временном каталоге теста и применяет миграции.
+func open(t *testing.T) *sqlite.Store {
+	t.Helper()
+	ctx := context.Background()
+	s, err := sqlite.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "bot.db"), 0)
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	require.NoError(t, s.Migrate(ctx))
+	return s
+}
+
+func TestContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.StorageInterface {
+		return open(t)
+	})
+}
+
+func TestMigrate_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	s := open(t)
+
+	require.NoError(t, s.Migrate(ctx))
+	assert.NoError(t, s.CheckSchema(ctx))
+}
+
+func TestIsDSN(t *testing.T) {
+	assert.True(t, sqlite.IsDSN("sqlite:bot.db"))
+	assert.True(t, sqlite.IsDSN("sqlite:///var/lib/bot/bot.db"))
+	assert.False(t, sqlite.IsDSN("postgres://user@localhost/bot"))
+	assert.False(t, sqlite.IsDSN("host=localhost dbname=bot"))
+}
+
+func TestCheckSchema_NotMigrated(t *testing.T) {
+	ctx := context.Background()
+	s, err := sqlite.Open(ctx, "sqlite:"+filepath.Join(t.TempDir(), "bot.db"), 0)
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+
+	assert.ErrorIs(t, s.CheckSchema(ctx), storage.ErrIncompatibleSchema)
+}
@@ -2,43 +2,150 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DefaultQueryTimeout - сколько по умолчанию может выполняться один вызов к базе.
+const DefaultQueryTimeout = 5 * time.Second
+
+// ErrNotFound возвращается, когда запрошенной записи нет и метод не может вернуть nil
+// (например, GetPlayerByTGID или DeleteGame). Совпадает с pgx.ErrNoRows, чтобы ошибки
+// Postgres-хранилища и других реализаций проверялись одинаково через errors.Is.
+var ErrNotFound = pgx.ErrNoRows
+
 type Storage struct {
-	db *pgxpool.Pool
+	pool *pgxpool.Pool
+	// db - через что выполняются запросы: пул соединений или открытая транзакция (см. WithTx).
+	db querier
+	// timeout ограничивает время каждого вызова к базе.
+	timeout time.Duration
+}
+
+// querier - общие методы пула соединений и транзакции.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
-// New - Создание подключения
-func New(dsn string) (*Storage, error) {
-	pool, err := pgxpool.New(context.Background(), dsn)
+// Tx - операции, которые можно выполнить в одной транзакции через WithTx.
+type Tx interface {
+	GetAllPlayers(ctx context.Context, chatID int64) ([]Player, error)
+	CreateGame(ctx context.Context, chatID int64, scoring string, recordedBy int64) (int, error)
+	SaveGameResults(ctx context.Context, results []GameResult) error
+	UpdatePlayerScore(ctx context.Context, chatID int64, tgID int64, pointsToAdd int) error
+	SaveRatingChanges(ctx context.Context, chatID int64, changes []RatingChange) error
+	DeleteRecordingSession(ctx context.Context, chatID int64, messageID int64) error
+	SetResultPoints(ctx context.Context, gameID int, tgID int64, points int) error
+	UpdateGameResults(ctx context.Context, chatID int64, gameID int, results []GameResult, editorTGID int64) error
+	LoadAllGames(ctx context.Context, chatID int64) ([]GameResult, error)
+	ReplaceRatings(ctx context.Context, chatID int64, history []RatingChange, initial float64) error
+}
+
+// New - Создание подключения. queryTimeout ограничивает время каждого вызова к базе
+// (0 - DefaultQueryTimeout).
+func New(ctx context.Context, dsn string, queryTimeout time.Duration) (*Storage, error) {
+	pool, err := pgxpool.New(ctx, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to db: %w", err)
 	}
-	return &Storage{db: pool}, nil
+	if queryTimeout <= 0 {
+		queryTimeout = DefaultQueryTimeout
+	}
+	return &Storage{pool: pool, db: pool, timeout: queryTimeout}, nil
+}
+
+// Close закрывает пул соединений, дожидаясь возврата занятых соединений.
+func (s *Storage) Close() {
+	s.pool.Close()
+}
+
+// WithTx выполняет fn в одной транзакции: изменения фиксируются, только если fn
+// не вернула ошибку, иначе откатываются все сразу. Вложенные транзакции методов
+// хранилища внутри fn становятся точками сохранения.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx Tx) error) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&Storage{pool: s.pool, db: tx, timeout: s.timeout}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// PlayerExists - проверяем существует ли игрок
-func (s *Storage) PlayerExists(ctx context.Context, tgID int64) (bool, error) {
+// withTimeout ограничивает контекст вызова таймаутом запроса.
+func (s *Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// PlayerExists - проверяем состоит ли игрок в чате
+func (s *Storage) PlayerExists(ctx context.Context, chatID int64, tgID int64) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	var exists bool
-	err := s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM players WHERE tg_id=$1)", tgID).Scan(&exists)
+	err := s.db.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM chat_players WHERE chat_id=$1 AND player_tg_id=$2)",
+		chatID, tgID,
+	).Scan(&exists)
 	return exists, err
 }
 
-// AddPlayer - добавляем и обновляем игрока
-func (s *Storage) AddPlayer(ctx context.Context, tgID int64, username, displayName string) error {
-	_, err := s.db.Exec(ctx,
-		"INSERT INTO players (tg_id, username, display_name, score) VALUES ($1, $2, $3, 0) ON CONFLICT (tg_id) DO NOTHING",
+// AddPlayer - добавляем и обновляем игрока, записываем его в чат
+func (s *Storage) AddPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO players (tg_id, username, display_name) VALUES ($1, $2, $3)
+		 ON CONFLICT (tg_id) DO UPDATE SET username = EXCLUDED.username, display_name = EXCLUDED.display_name`,
 		tgID, username, displayName)
-	return err
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO chat_players (chat_id, player_tg_id, score) VALUES ($1, $2, 0) ON CONFLICT DO NOTHING",
+		chatID, tgID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-// GetAllPlayers - Получение всех игроков
-func (s *Storage) GetAllPlayers(ctx context.Context) ([]Player, error) {
-	rows, err := s.db.Query(ctx, `SELECT tg_id, username, display_name, score FROM players`)
+// GetAllPlayers - Получение всех игроков чата
+func (s *Storage) GetAllPlayers(ctx context.Context, chatID int64) ([]Player, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating
+		 FROM chat_players cp
+		 JOIN players p ON cp.player_tg_id = p.tg_id
+		 WHERE cp.chat_id = $1
+		 ORDER BY cp.joined_at, p.tg_id`,
+		chatID,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +154,7 @@ func (s *Storage) GetAllPlayers(ctx context.Context) ([]Player, error) {
 	var players []Player
 	for rows.Next() {
 		var p Player
-		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score); err != nil {
+		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating); err != nil {
 			return nil, err
 		}
 		players = append(players, p)
@@ -57,6 +164,9 @@ func (s *Storage) GetAllPlayers(ctx context.Context) ([]Player, error) {
 
 // SaveGameResults - Сохранение результатов игры
 func (s *Storage) SaveGameResults(ctx context.Context, results []GameResult) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return err
@@ -65,9 +175,9 @@ func (s *Storage) SaveGameResults(ctx context.Context, results []GameResult) err
 
 	for _, r := range results {
 		_, err := tx.Exec(ctx,
-			`INSERT INTO game_results (game_id, user_id, place, points)
-			 VALUES ($1, $2, $3, $4)`,
-			r.GameID, r.Player.TGID, r.Place, r.Points,
+			`INSERT INTO game_results (game_id, user_id, place, points, status)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			r.GameID, r.Player.TGID, r.Place, r.Points, ResultStatus(r.DNF),
 		)
 		if err != nil {
 			return err
@@ -77,36 +187,103 @@ func (s *Storage) SaveGameResults(ctx context.Context, results []GameResult) err
 	return tx.Commit(ctx)
 }
 
-// UpdatePlayerScore - добавляем очки
-func (s *Storage) UpdatePlayerScore(ctx context.Context, tgID int64, pointsToAdd int) error {
+// UpdatePlayerScore - добавляем очки игроку в чате
+func (s *Storage) UpdatePlayerScore(ctx context.Context, chatID int64, tgID int64, pointsToAdd int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx,
+		`UPDATE chat_players SET score = score + $1 WHERE chat_id = $2 AND player_tg_id = $3`,
+		pointsToAdd, chatID, tgID,
+	)
+	return err
+}
+
+// SetResultPoints исправляет очки игрока в результатах игры.
+func (s *Storage) SetResultPoints(ctx context.Context, gameID int, tgID int64, points int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	_, err := s.db.Exec(ctx,
-		`UPDATE players SET score = score + $1 WHERE tg_id = $2`,
-		pointsToAdd, tgID,
+		`UPDATE game_results SET points = $1 WHERE game_id = $2 AND user_id = $3`,
+		points, gameID, tgID,
 	)
 	return err
 }
 
-// LoadGamesByYear - Получение результатов игр за год
-func (s *Storage) LoadGamesByYear(ctx context.Context, year int) ([]GameResult, error) {
+// ListChats возвращает все чаты, в которых есть игроки.
+func (s *Storage) ListChats(ctx context.Context) ([]int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT DISTINCT chat_id FROM chat_players ORDER BY chat_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chats = append(chats, chatID)
+	}
+	return chats, rows.Err()
+}
+
+// LoadGamesByYear - Получение результатов игр чата за год
+func (s *Storage) LoadGamesByYear(ctx context.Context, chatID int64, year int) ([]GameResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT r.game_id, p.tg_id, p.username, p.display_name, r.place, r.points, r.status = 'dnf', g.created_at
+		 FROM game_results r
+		 JOIN players p ON r.user_id = p.tg_id
+		 JOIN games g ON r.game_id = g.id
+		 WHERE g.chat_id = $1 AND EXTRACT(YEAR FROM g.created_at) = $2
+		 ORDER BY g.id, r.place, r.id`,
+		chatID, year,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanGameResults(rows)
+}
+
+// LoadAllGames - Получение результатов всех игр чата в порядке их записи
+func (s *Storage) LoadAllGames(ctx context.Context, chatID int64) ([]GameResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	rows, err := s.db.Query(ctx,
-		`SELECT r.game_id, p.tg_id, p.username, p.display_name, r.place, r.points, g.created_at
+		`SELECT r.game_id, p.tg_id, p.username, p.display_name, r.place, r.points, r.status = 'dnf', g.created_at
 		 FROM game_results r
 		 JOIN players p ON r.user_id = p.tg_id
 		 JOIN games g ON r.game_id = g.id
-		 WHERE EXTRACT(YEAR FROM g.created_at) = $1
-		 ORDER BY g.id, r.place`,
-		year,
+		 WHERE g.chat_id = $1
+		 ORDER BY g.id, r.place, r.id`,
+		chatID,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanGameResults(rows)
+}
+
+// scanGameResults читает строки вида (game_id, tg_id, username, display_name, place, points, dnf, created_at).
+func scanGameResults(rows pgx.Rows) ([]GameResult, error) {
 	var results []GameResult
 	for rows.Next() {
 		var r GameResult
 		var p Player
-		if err := rows.Scan(&r.GameID, &p.TGID, &p.Username, &p.DisplayName, &r.Place, &r.Points, &r.Date); err != nil {
+		if err := rows.Scan(&r.GameID, &p.TGID, &p.Username, &p.DisplayName, &r.Place, &r.Points, &r.DNF, &r.Date); err != nil {
 			return nil, err
 		}
 		r.Player = p
@@ -116,11 +293,19 @@ func (s *Storage) LoadGamesByYear(ctx context.Context, year int) ([]GameResult,
 	return results, nil
 }
 
-// GetPlayerByTGID - смотрим игрока по tgID
-func (s *Storage) GetPlayerByTGID(ctx context.Context, tgID int64) (*Player, error) {
+// GetPlayerByTGID - смотрим игрока чата по tgID
+func (s *Storage) GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*Player, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	var p Player
-	err := s.db.QueryRow(ctx, "SELECT tg_id, username, display_name, score FROM players WHERE tg_id=$1", tgID).
-		Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score)
+	err := s.db.QueryRow(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating
+		 FROM chat_players cp
+		 JOIN players p ON cp.player_tg_id = p.tg_id
+		 WHERE cp.chat_id = $1 AND cp.player_tg_id = $2`,
+		chatID, tgID,
+	).Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating)
 	if err != nil {
 		return nil, err
 	}
@@ -128,27 +313,42 @@ func (s *Storage) GetPlayerByTGID(ctx context.Context, tgID int64) (*Player, err
 }
 
 // Ping - проверка подключения к DB
-func (s *Storage) Ping() error {
-	return s.db.Ping(context.Background())
+func (s *Storage) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.pool.Ping(ctx)
 }
 
-// CreateGame создает новую игру и возвращает ее ID.
-func (s *Storage) CreateGame(ctx context.Context) (int, error) {
+// CreateGame создает новую игру в чате и возвращает ее ID.
+// scoring - ключ стратегии подсчёта очков, по которой считается игра.
+// Игра привязывается к текущему сезону чата, если он есть. recordedBy - кто ее записал.
+func (s *Storage) CreateGame(ctx context.Context, chatID int64, scoring string, recordedBy int64) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	var gameID int
-	err := s.db.QueryRow(ctx, "INSERT INTO games (created_at) VALUES (NOW()) RETURNING id").Scan(&gameID)
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO games (chat_id, scoring, season_id, recorded_by, created_at)
+		 VALUES ($1, $2, (SELECT id FROM seasons WHERE chat_id = $1 AND ended_at IS NULL), $3, NOW())
+		 RETURNING id`,
+		chatID, scoring, recordedBy,
+	).Scan(&gameID)
 	return gameID, err
 }
 
-// CheckPlayersExist проверяет, что все игроки с переданными tgID существуют в базе.
-func (s *Storage) CheckPlayersExist(ctx context.Context, tgIDs []int64) (bool, error) {
+// CheckPlayersExist проверяет, что все игроки с переданными tgID состоят в чате.
+func (s *Storage) CheckPlayersExist(ctx context.Context, chatID int64, tgIDs []int64) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	if len(tgIDs) == 0 {
 		return true, nil // Нет игроков для проверки
 	}
 
 	var count int
 	err := s.db.QueryRow(ctx,
-		"SELECT COUNT(*) FROM players WHERE tg_id = ANY($1)",
-		tgIDs,
+		"SELECT COUNT(*) FROM chat_players WHERE chat_id = $1 AND player_tg_id = ANY($2)",
+		chatID, tgIDs,
 	).Scan(&count)
 
 	if err != nil {
@@ -158,100 +358,1162 @@ func (s *Storage) CheckPlayersExist(ctx context.Context, tgIDs []int64) (bool, e
 	return count == len(tgIDs), nil
 }
 
-// CreateRecordingSession создает новую сессию записи.
-// Если сессия для этого чата уже существует, она будет перезаписана (ON CONFLICT).
-func (s *Storage) CreateRecordingSession(ctx context.Context, chatID int64, messageID int64) error {
+// CreateRecordingSession создает новую сессию записи для сообщения messageID. Запись начинается
+// с набора состава игры. Другие сессии чата не затрагиваются: в чате можно записывать несколько игр одновременно.
+func (s *Storage) CreateRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx,
+		"INSERT INTO recording_sessions (chat_id, message_id, owner_tg_id, lineup_open) VALUES ($1, $2, $3, TRUE)",
+		chatID, messageID, ownerTGID,
+	)
+	return err
+}
+
+// GetRecordingSession возвращает сессию записи сообщения messageID в чате.
+func (s *Storage) GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*RecordingSession, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var session RecordingSession
+	err := s.db.QueryRow(ctx,
+		`SELECT chat_id, message_id, COALESCE(edit_game_id, 0), owner_tg_id, lineup_open, created_at, updated_at
+		 FROM recording_sessions WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID,
+	).Scan(&session.ChatID, &session.MessageID, &session.EditGameID, &session.OwnerTGID, &session.LineupOpen, &session.CreatedAt, &session.UpdatedAt)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil // Сессии не существует
+	}
+	return &session, err
+}
+
+// AddPlayerToSession добавляет игрока в сессию записи и продлевает ее. Если tied, игрок делит
+// место с последним выбранным, иначе встает на следующее место с учетом всех, кто выше.
+func (s *Storage) AddPlayerToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	// Сначала удаляем старую сессию, если она есть, чтобы очистить связанных игроков
-	_, err = tx.Exec(ctx, "DELETE FROM recording_sessions WHERE chat_id = $1", chatID)
+	// Места как в спортивном рейтинге: после двоих на 2-м месте следующий занимает 4-е.
+	// Выбывшие мест не занимают и не учитываются.
+	var nextPlace int
+	err = tx.QueryRow(ctx,
+		`SELECT CASE WHEN $3 THEN COALESCE(MAX(place), 1) ELSE COUNT(*) + 1 END
+		 FROM session_players WHERE session_chat_id = $1 AND session_message_id = $2 AND status <> 'dnf'`,
+		chatID, messageID, tied,
+	).Scan(&nextPlace)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO session_players (session_chat_id, session_message_id, player_tg_id, place, seq)
+		 VALUES ($1, $2, $3, $4, `+nextSessionSeq+`)`,
+		chatID, messageID, playerTgID, nextPlace,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := touchSession(ctx, tx, chatID, messageID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AddDNFToSession добавляет в сессию записи выбывшего игрока и продлевает ее.
+// Выбывший не занимает места, доигравшие не сдвигаются.
+func (s *Storage) AddDNFToSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	// Создаем новую сессию
 	_, err = tx.Exec(ctx,
-		"INSERT INTO recording_sessions (chat_id, message_id) VALUES ($1, $2)",
+		`INSERT INTO session_players (session_chat_id, session_message_id, player_tg_id, place, status, seq)
+		 VALUES ($1, $2, $3, 0, 'dnf', `+nextSessionSeq+`)`,
+		chatID, messageID, playerTgID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := touchSession(ctx, tx, chatID, messageID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// nextSessionSeq - номер следующего выбора в сессии $1, $2: по нему "⬅️ Назад" находит последнего выбранного.
+const nextSessionSeq = "(SELECT COALESCE(MAX(seq), 0) + 1 FROM session_players WHERE session_chat_id = $1 AND session_message_id = $2)"
+
+// touchSession отмечает действие в сессии записи, чтобы она не истекла.
+func touchSession(ctx context.Context, db querier, chatID int64, messageID int64) error {
+	_, err := db.Exec(ctx,
+		"UPDATE recording_sessions SET updated_at = now() WHERE chat_id = $1 AND message_id = $2",
 		chatID, messageID,
 	)
+	return err
+}
+
+// CreateEditSession создает сессию редактирования игры gameID, заполненную текущими местами игроков.
+func (s *Storage) CreateEditSession(ctx context.Context, chatID int64, messageID int64, gameID int, ownerTGID int64, players []SessionPlayer) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO recording_sessions (chat_id, message_id, edit_game_id, owner_tg_id) VALUES ($1, $2, $3, $4)",
+		chatID, messageID, gameID, ownerTGID,
+	)
 	if err != nil {
 		return err
 	}
 
+	// Игроки считаются выбранными в порядке мест
+	for i, p := range players {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO session_players (session_chat_id, session_message_id, player_tg_id, place, status, seq) VALUES ($1, $2, $3, $4, $5, $6)",
+			chatID, messageID, p.Player.TGID, p.Place, ResultStatus(p.DNF), i+1,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit(ctx)
 }
 
-// GetRecordingSession возвращает активную сессию записи для чата.
-func (s *Storage) GetRecordingSession(ctx context.Context, chatID int64) (*RecordingSession, error) {
-	var session RecordingSession
-	err := s.db.QueryRow(ctx,
-		"SELECT chat_id, message_id FROM recording_sessions WHERE chat_id = $1",
-		chatID,
-	).Scan(&session.ChatID, &session.MessageID)
+// RemovePlayerFromSession убирает игрока из сессии, игроки ниже него поднимаются на место вверх
+// (после выбывшего места не сдвигаются). Сессия продлевается.
+func (s *Storage) RemovePlayerFromSession(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var place int
+	var status string
+	err = tx.QueryRow(ctx,
+		`DELETE FROM session_players
+		 WHERE session_chat_id = $1 AND session_message_id = $2 AND player_tg_id = $3
+		 RETURNING place, status`,
+		chatID, messageID, playerTgID,
+	).Scan(&place, &status)
 	if err == pgx.ErrNoRows {
-		return nil, nil // Сессии не существует
+		return nil // Игрока уже нет в сессии
 	}
-	return &session, err
+	if err != nil {
+		return err
+	}
+
+	if status != StatusDNF {
+		_, err = tx.Exec(ctx,
+			"UPDATE session_players SET place = place - 1 WHERE session_chat_id = $1 AND session_message_id = $2 AND place > $3",
+			chatID, messageID, place,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := touchSession(ctx, tx, chatID, messageID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// AddPlayerToSession добавляет игрока в сессию записи.
-func (s *Storage) AddPlayerToSession(ctx context.Context, chatID int64, playerTgID int64) error {
-	// Определяем следующее место (place)
-	var nextPlace int
+// GetLastSelectedPlayer возвращает Telegram ID игрока, выбранного в сессии последним (в том числе
+// выбывшего), или 0, если в сессии никого нет.
+func (s *Storage) GetLastSelectedPlayer(ctx context.Context, chatID int64, messageID int64) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var tgID int64
 	err := s.db.QueryRow(ctx,
-		"SELECT COALESCE(MAX(place), 0) + 1 FROM session_players WHERE session_chat_id = $1",
-		chatID,
-	).Scan(&nextPlace)
+		`SELECT player_tg_id FROM session_players
+		 WHERE session_chat_id = $1 AND session_message_id = $2
+		 ORDER BY seq DESC, place DESC, player_tg_id DESC
+		 LIMIT 1`,
+		chatID, messageID,
+	).Scan(&tgID)
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+	return tgID, err
+}
+
+// SwapSessionPlayers меняет местами двух игроков сессии. Если кого-то из них нет среди
+// доигравших, ничего не делает.
+func (s *Storage) SwapSessionPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) error {
+	if firstTgID == secondTgID {
+		return nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var firstPlace, secondPlace int
+	err = tx.QueryRow(ctx,
+		`SELECT
+		   COALESCE(MAX(place) FILTER (WHERE player_tg_id = $3), 0),
+		   COALESCE(MAX(place) FILTER (WHERE player_tg_id = $4), 0)
+		 FROM session_players
+		 WHERE session_chat_id = $1 AND session_message_id = $2`,
+		chatID, messageID, firstTgID, secondTgID,
+	).Scan(&firstPlace, &secondPlace)
 	if err != nil {
 		return err
 	}
+	if firstPlace == 0 || secondPlace == 0 {
+		return nil // Кого-то из игроков уже нет в сессии или он выбыл
+	}
 
-	_, err = s.db.Exec(ctx,
-		"INSERT INTO session_players (session_chat_id, player_tg_id, place) VALUES ($1, $2, $3)",
-		chatID, playerTgID, nextPlace,
+	_, err = tx.Exec(ctx,
+		`UPDATE session_players SET place = CASE player_tg_id WHEN $3 THEN $5 ELSE $6 END
+		 WHERE session_chat_id = $1 AND session_message_id = $2 AND player_tg_id IN ($3, $4)`,
+		chatID, messageID, firstTgID, secondTgID, secondPlace, firstPlace,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if err := touchSession(ctx, tx, chatID, messageID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// GetSessionPlayers возвращает всех игроков в сессии в правильном порядке.
-func (s *Storage) GetSessionPlayers(ctx context.Context, chatID int64) ([]Player, error) {
+// GetSessionPlayers возвращает всех игроков в сессии с их местами, выбывшие идут последними.
+// Игроки, делящие место, идут в порядке Telegram ID.
+func (s *Storage) GetSessionPlayers(ctx context.Context, chatID int64, messageID int64) ([]SessionPlayer, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	rows, err := s.db.Query(ctx,
-		`SELECT p.tg_id, p.username, p.display_name, p.score
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating, sp.place, sp.status = 'dnf'
 		 FROM session_players sp
 		 JOIN players p ON sp.player_tg_id = p.tg_id
-		 WHERE sp.session_chat_id = $1
-		 ORDER BY sp.place ASC`,
-		chatID,
+		 JOIN chat_players cp ON cp.chat_id = sp.session_chat_id AND cp.player_tg_id = sp.player_tg_id
+		 WHERE sp.session_chat_id = $1 AND sp.session_message_id = $2
+		 ORDER BY sp.status = 'dnf', sp.place ASC, sp.player_tg_id ASC`,
+		chatID, messageID,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var players []Player
+	var players []SessionPlayer
 	for rows.Next() {
-		var p Player
-		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score); err != nil {
+		var sp SessionPlayer
+		p := &sp.Player
+		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating, &sp.Place, &sp.DNF); err != nil {
 			return nil, err
 		}
-		players = append(players, p)
+		players = append(players, sp)
 	}
 	return players, nil
 }
 
-// DeleteRecordingSession удаляет сессию записи и всех связанных с ней игроков.
-func (s *Storage) DeleteRecordingSession(ctx context.Context, chatID int64) error {
-	_, err := s.db.Exec(ctx, "DELETE FROM recording_sessions WHERE chat_id = $1", chatID)
-	return err
+// AddPlayerToLineup добавляет игрока в состав игры сессии и продлевает ее.
+// Если игрок уже в составе, ничего не меняется.
+func (s *Storage) AddPlayerToLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO session_lineup (session_chat_id, session_message_id, player_tg_id) VALUES ($1, $2, $3)
+		 ON CONFLICT DO NOTHING`,
+		chatID, messageID, playerTgID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := touchSession(ctx, tx, chatID, messageID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// ResetPlayerScore сбрасывает очки игрока до 0.
-func (s *Storage) ResetPlayerScore(ctx context.Context, tgID int64) error {
-	_, err := s.db.Exec(ctx, "UPDATE players SET score = 0 WHERE tg_id = $1", tgID)
-	return err
-}
\ No newline at end of file
+// RemovePlayerFromLineup убирает игрока из состава игры сессии и продлевает ее.
+func (s *Storage) RemovePlayerFromLineup(ctx context.Context, chatID int64, messageID int64, playerTgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"DELETE FROM session_lineup WHERE session_chat_id = $1 AND session_message_id = $2 AND player_tg_id = $3",
+		chatID, messageID, playerTgID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := touchSession(ctx, tx, chatID, messageID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetSessionLineup возвращает состав игры сессии в том же порядке, что и GetAllPlayers.
+func (s *Storage) GetSessionLineup(ctx context.Context, chatID int64, messageID int64) ([]Player, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, cp.score, cp.rating
+		 FROM session_lineup sl
+		 JOIN players p ON sl.player_tg_id = p.tg_id
+		 JOIN chat_players cp ON cp.chat_id = sl.session_chat_id AND cp.player_tg_id = sl.player_tg_id
+		 WHERE sl.session_chat_id = $1 AND sl.session_message_id = $2
+		 ORDER BY cp.joined_at, p.tg_id`,
+		chatID, messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []Player
+	for rows.Next() {
+		var p Player
+		if err := rows.Scan(&p.TGID, &p.Username, &p.DisplayName, &p.Score, &p.Rating); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// SetLineupOpen открывает или закрывает набор состава игры сессии и продлевает ее.
+func (s *Storage) SetLineupOpen(ctx context.Context, chatID int64, messageID int64, open bool) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx,
+		"UPDATE recording_sessions SET lineup_open = $3, updated_at = now() WHERE chat_id = $1 AND message_id = $2",
+		chatID, messageID, open,
+	)
+	return err
+}
+
+// DeleteRecordingSession удаляет сессию записи и всех связанных с ней игроков.
+func (s *Storage) DeleteRecordingSession(ctx context.Context, chatID int64, messageID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx, "DELETE FROM recording_sessions WHERE chat_id = $1 AND message_id = $2", chatID, messageID)
+	return err
+}
+
+// DeleteExpiredSessions удаляет сессии записи всех чатов, в которых ничего не происходило
+// с момента before, и возвращает удаленные сессии.
+func (s *Storage) DeleteExpiredSessions(ctx context.Context, before time.Time) ([]RecordingSession, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`DELETE FROM recording_sessions WHERE updated_at < $1
+		 RETURNING chat_id, message_id, COALESCE(edit_game_id, 0), owner_tg_id, lineup_open, created_at, updated_at`,
+		before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []RecordingSession
+	for rows.Next() {
+		var session RecordingSession
+		if err := rows.Scan(&session.ChatID, &session.MessageID, &session.EditGameID, &session.OwnerTGID, &session.LineupOpen, &session.CreatedAt, &session.UpdatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// ResetPlayerScore сбрасывает очки игрока в чате до 0.
+func (s *Storage) ResetPlayerScore(ctx context.Context, chatID int64, tgID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx, "UPDATE chat_players SET score = 0 WHERE chat_id = $1 AND player_tg_id = $2", chatID, tgID)
+	return err
+}
+
+// GetChatScoring возвращает ключ стратегии подсчёта очков чата.
+// Если чат ничего не выбирал, возвращается пустая строка.
+func (s *Storage) GetChatScoring(ctx context.Context, chatID int64) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var scoring string
+	err := s.db.QueryRow(ctx, "SELECT scoring FROM chat_settings WHERE chat_id = $1", chatID).Scan(&scoring)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return scoring, err
+}
+
+// SetChatScoring сохраняет стратегию подсчёта очков чата.
+func (s *Storage) SetChatScoring(ctx context.Context, chatID int64, scoring string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO chat_settings (chat_id, scoring) VALUES ($1, $2)
+		 ON CONFLICT (chat_id) DO UPDATE SET scoring = EXCLUDED.scoring`,
+		chatID, scoring,
+	)
+	return err
+}
+
+// GetChatGameConfig возвращает настройки игры чата или nil, если чат их не менял.
+func (s *Storage) GetChatGameConfig(ctx context.Context, chatID int64) (*GameConfig, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var cfg GameConfig
+	err := s.db.QueryRow(ctx,
+		`SELECT min_players, max_players, auto_place_last FROM chat_settings
+		 WHERE chat_id = $1 AND min_players IS NOT NULL AND max_players IS NOT NULL AND auto_place_last IS NOT NULL`,
+		chatID,
+	).Scan(&cfg.MinPlayers, &cfg.MaxPlayers, &cfg.AutoPlaceLast)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SetChatGameConfig сохраняет настройки игры чата. Если строки настроек чата еще нет, стратегия
+// подсчёта очков остается пустой, то есть по умолчанию.
+func (s *Storage) SetChatGameConfig(ctx context.Context, chatID int64, cfg GameConfig) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO chat_settings (chat_id, scoring, min_players, max_players, auto_place_last) VALUES ($1, '', $2, $3, $4)
+		 ON CONFLICT (chat_id) DO UPDATE SET min_players = EXCLUDED.min_players,
+		   max_players = EXCLUDED.max_players, auto_place_last = EXCLUDED.auto_place_last`,
+		chatID, cfg.MinPlayers, cfg.MaxPlayers, cfg.AutoPlaceLast,
+	)
+	return err
+}
+
+// SaveRatingChanges сохраняет новые рейтинги игроков чата и записывает их в историю.
+func (s *Storage) SaveRatingChanges(ctx context.Context, chatID int64, changes []RatingChange) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, c := range changes {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO rating_history (game_id, chat_id, player_tg_id, rating_before, rating_after)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			c.GameID, chatID, c.TGID, c.Before, c.After,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			"UPDATE chat_players SET rating = $1 WHERE chat_id = $2 AND player_tg_id = $3",
+			c.After, chatID, c.TGID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetRatingHistory возвращает последние изменения рейтинга игрока в чате, начиная с самых новых.
+func (s *Storage) GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]RatingChange, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT game_id, player_tg_id, rating_before, rating_after, created_at
+		 FROM rating_history
+		 WHERE chat_id = $1 AND player_tg_id = $2
+		 ORDER BY game_id DESC
+		 LIMIT $3`,
+		chatID, tgID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []RatingChange
+	for rows.Next() {
+		var c RatingChange
+		if err := rows.Scan(&c.GameID, &c.TGID, &c.Before, &c.After, &c.Date); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// CreateSeason начинает новый сезон в чате и обнуляет очки игроков, чтобы в таблицу сезона
+// не попали очки, набранные до него. Всё выполняется в одной транзакции.
+func (s *Storage) CreateSeason(ctx context.Context, chatID int64, name string) (*Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	season := Season{ChatID: chatID, Name: name}
+	err = tx.QueryRow(ctx,
+		"INSERT INTO seasons (chat_id, name) VALUES ($1, $2) RETURNING id, started_at",
+		chatID, name,
+	).Scan(&season.ID, &season.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE chat_players SET score = 0 WHERE chat_id = $1", chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetActiveSeason возвращает незавершенный сезон чата или nil, если его нет.
+func (s *Storage) GetActiveSeason(ctx context.Context, chatID int64) (*Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var season Season
+	err := s.db.QueryRow(ctx,
+		"SELECT id, chat_id, name, started_at, ended_at FROM seasons WHERE chat_id = $1 AND ended_at IS NULL",
+		chatID,
+	).Scan(&season.ID, &season.ChatID, &season.Name, &season.StartedAt, &season.EndedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetSeasonByName возвращает сезон чата по названию или nil, если его нет.
+func (s *Storage) GetSeasonByName(ctx context.Context, chatID int64, name string) (*Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var season Season
+	err := s.db.QueryRow(ctx,
+		"SELECT id, chat_id, name, started_at, ended_at FROM seasons WHERE chat_id = $1 AND name = $2",
+		chatID, name,
+	).Scan(&season.ID, &season.ChatID, &season.Name, &season.StartedAt, &season.EndedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// ListSeasons возвращает все сезоны чата, начиная с последнего.
+func (s *Storage) ListSeasons(ctx context.Context, chatID int64) ([]Season, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		"SELECT id, chat_id, name, started_at, ended_at FROM seasons WHERE chat_id = $1 ORDER BY started_at DESC",
+		chatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seasons []Season
+	for rows.Next() {
+		var season Season
+		if err := rows.Scan(&season.ID, &season.ChatID, &season.Name, &season.StartedAt, &season.EndedAt); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, season)
+	}
+	return seasons, nil
+}
+
+// EndSeason завершает сезон: сохраняет итоговую таблицу по текущим очкам игроков чата
+// и обнуляет их очки. Всё выполняется в одной транзакции.
+func (s *Storage) EndSeason(ctx context.Context, chatID int64, seasonID int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO season_standings (season_id, player_tg_id, place, score, games)
+		 SELECT $2, cp.player_tg_id,
+		        RANK() OVER (ORDER BY cp.score DESC),
+		        cp.score,
+		        (SELECT COUNT(*) FROM game_results r JOIN games g ON r.game_id = g.id
+		         WHERE g.season_id = $2 AND r.user_id = cp.player_tg_id)
+		 FROM chat_players cp
+		 WHERE cp.chat_id = $1`,
+		chatID, seasonID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE chat_players SET score = 0 WHERE chat_id = $1", chatID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE seasons SET ended_at = now() WHERE id = $1 AND chat_id = $2", seasonID, chatID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetSeasonStandings возвращает сохраненную итоговую таблицу сезона.
+func (s *Storage) GetSeasonStandings(ctx context.Context, seasonID int) ([]SeasonStanding, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT p.tg_id, p.username, p.display_name, ss.place, ss.score, ss.games
+		 FROM season_standings ss
+		 JOIN players p ON ss.player_tg_id = p.tg_id
+		 WHERE ss.season_id = $1
+		 ORDER BY ss.place, p.display_name`,
+		seasonID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []SeasonStanding
+	for rows.Next() {
+		var st SeasonStanding
+		if err := rows.Scan(&st.Player.TGID, &st.Player.Username, &st.Player.DisplayName, &st.Place, &st.Score, &st.Games); err != nil {
+			return nil, err
+		}
+		st.Player.Score = st.Score
+		standings = append(standings, st)
+	}
+	return standings, nil
+}
+
+// GetSeasonGameCounts возвращает, сколько игр сезона сыграл каждый игрок. Игры относятся
+// к сезону, в котором были записаны; игры, из которых игрок выбыл, тоже считаются.
+func (s *Storage) GetSeasonGameCounts(ctx context.Context, seasonID int) (map[int64]int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT r.user_id, COUNT(*)
+		 FROM game_results r
+		 JOIN games g ON r.game_id = g.id
+		 WHERE g.season_id = $1
+		 GROUP BY r.user_id`,
+		seasonID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var tgID int64
+		var games int
+		if err := rows.Scan(&tgID, &games); err != nil {
+			return nil, err
+		}
+		counts[tgID] = games
+	}
+	return counts, rows.Err()
+}
+
+// GetGame возвращает игру чата вместе с результатами или nil, если такой игры нет.
+func (s *Storage) GetGame(ctx context.Context, chatID int64, gameID int) (*Game, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var game Game
+	err := s.db.QueryRow(ctx,
+		"SELECT id, chat_id, scoring, recorded_by, created_at FROM games WHERE chat_id = $1 AND id = $2",
+		chatID, gameID,
+	).Scan(&game.ID, &game.ChatID, &game.Scoring, &game.RecordedBy, &game.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	game.Results, err = s.loadGameResults(ctx, game.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// GetLastGame возвращает последнюю записанную игру чата или nil, если игр не было.
+func (s *Storage) GetLastGame(ctx context.Context, chatID int64) (*Game, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var gameID int
+	err := s.db.QueryRow(ctx,
+		"SELECT id FROM games WHERE chat_id = $1 ORDER BY id DESC LIMIT 1",
+		chatID,
+	).Scan(&gameID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetGame(ctx, chatID, gameID)
+}
+
+// loadGameResults возвращает результаты игры по местам вместе с изменением рейтинга Эло.
+func (s *Storage) loadGameResults(ctx context.Context, gameID int) ([]GameResult, error) {
+	games, err := s.loadResultsOfGames(ctx, []int{gameID})
+	if err != nil {
+		return nil, err
+	}
+	return games[gameID], nil
+}
+
+// loadResultsOfGames возвращает результаты нескольких игр, сгруппированные по ID игры.
+func (s *Storage) loadResultsOfGames(ctx context.Context, gameIDs []int) (map[int][]GameResult, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT r.game_id, p.tg_id, p.username, p.display_name, r.place, r.points, r.status = 'dnf', g.created_at,
+		        COALESCE(rh.rating_before, 0), COALESCE(rh.rating_after, 0)
+		 FROM game_results r
+		 JOIN players p ON r.user_id = p.tg_id
+		 JOIN games g ON r.game_id = g.id
+		 LEFT JOIN rating_history rh ON rh.game_id = r.game_id AND rh.player_tg_id = r.user_id
+		 WHERE r.game_id = ANY($1)
+		 ORDER BY r.game_id, r.place, r.id`,
+		gameIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make(map[int][]GameResult, len(gameIDs))
+	for rows.Next() {
+		var r GameResult
+		if err := rows.Scan(&r.GameID, &r.Player.TGID, &r.Player.Username, &r.Player.DisplayName,
+			&r.Place, &r.Points, &r.DNF, &r.Date, &r.RatingBefore, &r.RatingAfter); err != nil {
+			return nil, err
+		}
+		results[r.GameID] = append(results[r.GameID], r)
+	}
+	return results, nil
+}
+
+// ListGames возвращает страницу игр чата (сначала новые) и общее число игр.
+func (s *Storage) ListGames(ctx context.Context, chatID int64, offset, limit int) ([]Game, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var total int
+	err := s.db.QueryRow(ctx, "SELECT COUNT(*) FROM games WHERE chat_id = $1", chatID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT id, chat_id, scoring, recorded_by, created_at FROM games
+		 WHERE chat_id = $1
+		 ORDER BY id DESC
+		 OFFSET $2 LIMIT $3`,
+		chatID, offset, limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var games []Game
+	var ids []int
+	for rows.Next() {
+		var g Game
+		if err := rows.Scan(&g.ID, &g.ChatID, &g.Scoring, &g.RecordedBy, &g.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		games = append(games, g)
+		ids = append(ids, g.ID)
+	}
+	rows.Close()
+	if len(games) == 0 {
+		return nil, total, nil
+	}
+
+	results, err := s.loadResultsOfGames(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range games {
+		games[i].Results = results[games[i].ID]
+	}
+	return games, total, nil
+}
+
+// LoadGamesSince возвращает игры чата, записанные после since, вместе с результатами, в порядке записи.
+func (s *Storage) LoadGamesSince(ctx context.Context, chatID int64, since time.Time) ([]Game, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT id, chat_id, scoring, recorded_by, created_at FROM games
+		 WHERE chat_id = $1 AND created_at > $2
+		 ORDER BY id`,
+		chatID, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []Game
+	var ids []int
+	for rows.Next() {
+		var g Game
+		if err := rows.Scan(&g.ID, &g.ChatID, &g.Scoring, &g.RecordedBy, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+		ids = append(ids, g.ID)
+	}
+	rows.Close()
+	if len(games) == 0 {
+		return nil, nil
+	}
+
+	results, err := s.loadResultsOfGames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range games {
+		games[i].Results = results[games[i].ID]
+	}
+	return games, nil
+}
+
+// DeleteGame удаляет игру в одной транзакции: вычитает начисленные очки, возвращает
+// рейтинги Эло участников к значениям до игры, удаляет результаты и пишет запись в журнал.
+func (s *Storage) DeleteGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		"SELECT user_id, place, points FROM game_results WHERE game_id = $1 ORDER BY place, id",
+		gameID,
+	)
+	if err != nil {
+		return err
+	}
+	type deletedResult struct {
+		TGID   int64 `json:"tg_id"`
+		Place  int   `json:"place"`
+		Points int   `json:"points"`
+	}
+	var deleted []deletedResult
+	for rows.Next() {
+		var r deletedResult
+		if err := rows.Scan(&r.TGID, &r.Place, &r.Points); err != nil {
+			rows.Close()
+			return err
+		}
+		deleted = append(deleted, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range deleted {
+		_, err := tx.Exec(ctx,
+			"UPDATE chat_players SET score = score - $1 WHERE chat_id = $2 AND player_tg_id = $3",
+			r.Points, chatID, r.TGID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE chat_players cp SET rating = rh.rating_before
+		 FROM rating_history rh
+		 WHERE rh.game_id = $1 AND cp.chat_id = rh.chat_id AND cp.player_tg_id = rh.player_tg_id`,
+		gameID,
+	)
+	if err != nil {
+		return err
+	}
+
+	details, err := json.Marshal(map[string]any{"results": deleted})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO game_audit (chat_id, game_id, action, actor_tg_id, details) VALUES ($1, $2, 'undo', $3, $4::jsonb)",
+		chatID, gameID, actorTGID, string(details),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Результаты и история рейтинга удаляются каскадно
+	tag, err := tx.Exec(ctx, "DELETE FROM games WHERE chat_id = $1 AND id = $2", chatID, gameID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateGameResults заменяет результаты игры новыми в одной транзакции: сохраняет прежние
+// места как очередную версию, корректирует очки игроков на разницу и пишет запись в журнал.
+func (s *Storage) UpdateGameResults(ctx context.Context, chatID int64, gameID int, results []GameResult, editorTGID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var version int
+	err = tx.QueryRow(ctx,
+		"SELECT COALESCE(MAX(version), 0) + 1 FROM game_result_versions WHERE game_id = $1",
+		gameID,
+	).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	// Прежние результаты уходят в историю версий, их очки списываются
+	_, err = tx.Exec(ctx,
+		`INSERT INTO game_result_versions (game_id, version, player_tg_id, place, points, status, edited_by)
+		 SELECT game_id, $2, user_id, place, points, status, $3 FROM game_results WHERE game_id = $1`,
+		gameID, version, editorTGID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE chat_players cp SET score = cp.score - r.points
+		 FROM game_results r
+		 WHERE r.game_id = $1 AND cp.chat_id = $2 AND cp.player_tg_id = r.user_id`,
+		gameID, chatID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM game_results WHERE game_id = $1", gameID)
+	if err != nil {
+		return err
+	}
+
+	type editedResult struct {
+		TGID   int64 `json:"tg_id"`
+		Place  int   `json:"place"`
+		Points int   `json:"points"`
+		DNF    bool  `json:"dnf,omitempty"`
+	}
+	var edited []editedResult
+	for _, r := range results {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO game_results (game_id, user_id, place, points, status)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			gameID, r.Player.TGID, r.Place, r.Points, ResultStatus(r.DNF),
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			"UPDATE chat_players SET score = score + $1 WHERE chat_id = $2 AND player_tg_id = $3",
+			r.Points, chatID, r.Player.TGID,
+		)
+		if err != nil {
+			return err
+		}
+		edited = append(edited, editedResult{TGID: r.Player.TGID, Place: r.Place, Points: r.Points, DNF: r.DNF})
+	}
+
+	details, err := json.Marshal(map[string]any{"version": version, "results": edited})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO game_audit (chat_id, game_id, action, actor_tg_id, details) VALUES ($1, $2, 'edit', $3, $4::jsonb)",
+		chatID, gameID, editorTGID, string(details),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetGameVersions возвращает предыдущие версии результатов игры, начиная с исходной.
+func (s *Storage) GetGameVersions(ctx context.Context, gameID int) ([]GameVersion, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx,
+		`SELECT v.version, v.edited_by, COALESCE(e.display_name, ''), v.edited_at,
+		        p.tg_id, p.username, p.display_name, v.place, v.points, v.status = 'dnf'
+		 FROM game_result_versions v
+		 JOIN players p ON v.player_tg_id = p.tg_id
+		 LEFT JOIN players e ON v.edited_by = e.tg_id
+		 WHERE v.game_id = $1
+		 ORDER BY v.version, v.place, v.player_tg_id`,
+		gameID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []GameVersion
+	for rows.Next() {
+		var v GameVersion
+		var r GameResult
+		if err := rows.Scan(&v.Version, &v.EditedBy.TGID, &v.EditedBy.DisplayName, &v.EditedAt,
+			&r.Player.TGID, &r.Player.Username, &r.Player.DisplayName, &r.Place, &r.Points, &r.DNF); err != nil {
+			return nil, err
+		}
+		r.GameID = gameID
+		if len(versions) == 0 || versions[len(versions)-1].Version != v.Version {
+			versions = append(versions, v)
+		}
+		last := &versions[len(versions)-1]
+		last.Results = append(last.Results, r)
+	}
+	return versions, nil
+}
+
+// ReplaceRatings перезаписывает историю и текущие рейтинги Эло чата, например после
+// пересчета всех игр. Игроки без игр получают начальный рейтинг initial.
+func (s *Storage) ReplaceRatings(ctx context.Context, chatID int64, history []RatingChange, initial float64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM rating_history WHERE chat_id = $1", chatID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "UPDATE chat_players SET rating = $1 WHERE chat_id = $2", initial, chatID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range history {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO rating_history (game_id, chat_id, player_tg_id, rating_before, rating_after, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			c.GameID, chatID, c.TGID, c.Before, c.After, c.Date,
+		)
+		if err != nil {
+			return err
+		}
+		// История идет по порядку игр, поэтому последняя запись игрока - его текущий рейтинг
+		_, err = tx.Exec(ctx,
+			"UPDATE chat_players SET rating = $1 WHERE chat_id = $2 AND player_tg_id = $3",
+			c.After, chatID, c.TGID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,39 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage/storagetest"
+)
+
+var _ service.StorageInterface = (*storage.Storage)(nil)
+
+// TestContract прогоняет тесты контракта на настоящей базе. Нужна отдельная тестовая база
+// в TEST_POSTGRES_DSN: перед каждым тестом все таблицы очищаются.
+func TestContract(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+	s, err := storage.New(ctx, dsn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	storagetest.Run(t, func(t *testing.T) service.StorageInterface {
+		if err := s.Truncate(ctx); err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return s
+	})
+}
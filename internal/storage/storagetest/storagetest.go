@@ -0,0 +1,1015 @@
+// Package storagetest - общие тесты контракта хранилища. Каждая реализация
+// service.StorageInterface прогоняет их, чтобы вести себя так же, как Postgres-хранилище.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chatID    int64 = -100
+	otherChat int64 = -200
+)
+
+// Run прогоняет тесты контракта. newStore вызывается для каждого теста и должна
+// возвращать пустое хранилище.
+func Run(t *testing.T, newStore func(t *testing.T) service.StorageInterface) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s service.StorageInterface)
+	}{
+		{"Players", testPlayers},
+		{"PlayerNotFound", testPlayerNotFound},
+		{"CheckPlayersExist", testCheckPlayersExist},
+		{"ChatScoring", testChatScoring},
+		{"ChatGameConfig", testChatGameConfig},
+		{"SessionPlaces", testSessionPlaces},
+		{"SessionTies", testSessionTies},
+		{"SessionDNF", testSessionDNF},
+		{"LastSelectedPlayer", testLastSelectedPlayer},
+		{"SessionLineup", testSessionLineup},
+		{"ParallelSessions", testParallelSessions},
+		{"SessionConstraints", testSessionConstraints},
+		{"SessionExpiry", testSessionExpiry},
+		{"Games", testGames},
+		{"GameNotFound", testGameNotFound},
+		{"ListGames", testListGames},
+		{"LoadGamesSince", testLoadGamesSince},
+		{"RatingHistory", testRatingHistory},
+		{"DeleteGame", testDeleteGame},
+		{"UpdateGameResults", testUpdateGameResults},
+		{"ResultStatus", testResultStatus},
+		{"Seasons", testSeasons},
+		{"EndSeason", testEndSeason},
+		{"WithTx", testWithTx},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// addPlayers добавляет в чат игроков с ID 1..n по порядку.
+func addPlayers(t *testing.T, s service.StorageInterface, chatID int64, names ...string) {
+	t.Helper()
+	for i, name := range names {
+		require.NoError(t, s.AddPlayer(context.Background(), chatID, int64(i+1), name, name))
+	}
+}
+
+// recordGame записывает игру, в которой игроки заняли места по порядку tgIDs.
+func recordGame(t *testing.T, s service.StorageInterface, chatID int64, tgIDs ...int64) int {
+	t.Helper()
+	ctx := context.Background()
+	gameID, err := s.CreateGame(ctx, chatID, "linear", 0)
+	require.NoError(t, err)
+
+	var results []storage.GameResult
+	for i, tgID := range tgIDs {
+		points := len(tgIDs) - i - 1
+		results = append(results, storage.GameResult{GameID: gameID, Player: storage.Player{TGID: tgID}, Place: i + 1, Points: points})
+		require.NoError(t, s.UpdatePlayerScore(ctx, chatID, tgID, points))
+	}
+	require.NoError(t, s.SaveGameResults(ctx, results))
+	return gameID
+}
+
+func tgIDs(players []storage.Player) []int64 {
+	var ids []int64
+	for _, p := range players {
+		ids = append(ids, p.TGID)
+	}
+	return ids
+}
+
+func sessionIDs(players []storage.SessionPlayer) []int64 {
+	var ids []int64
+	for _, p := range players {
+		ids = append(ids, p.Player.TGID)
+	}
+	return ids
+}
+
+func sessionPlaces(players []storage.SessionPlayer) []int {
+	var places []int
+	for _, p := range players {
+		places = append(places, p.Place)
+	}
+	return places
+}
+
+// placed возвращает игроков сессии на местах по порядку.
+func placed(ids ...int64) []storage.SessionPlayer {
+	players := make([]storage.SessionPlayer, len(ids))
+	for i, id := range ids {
+		players[i] = storage.SessionPlayer{Player: storage.Player{TGID: id}, Place: i + 1}
+	}
+	return players
+}
+
+func resultIDs(results []storage.GameResult) []int64 {
+	var ids []int64
+	for _, r := range results {
+		ids = append(ids, r.Player.TGID)
+	}
+	return ids
+}
+
+func scores(t *testing.T, s service.StorageInterface, chatID int64) map[int64]int {
+	t.Helper()
+	players, err := s.GetAllPlayers(context.Background(), chatID)
+	require.NoError(t, err)
+	scores := make(map[int64]int)
+	for _, p := range players {
+		scores[p.TGID] = p.Score
+	}
+	return scores
+}
+
+func testPlayers(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+
+	players, err := s.GetAllPlayers(ctx, chatID)
+	require.NoError(t, err)
+	assert.Empty(t, players)
+
+	addPlayers(t, s, chatID, "alice", "bob", "carol")
+	require.NoError(t, s.UpdatePlayerScore(ctx, chatID, 2, 5))
+
+	// Повторная регистрация обновляет имя, но не сбрасывает очки и не меняет порядок
+	require.NoError(t, s.AddPlayer(ctx, chatID, 2, "bobby", "Bobby"))
+
+	players, err = s.GetAllPlayers(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, tgIDs(players))
+
+	bob, err := s.GetPlayerByTGID(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Player{TGID: 2, Username: "bobby", DisplayName: "Bobby", Score: 5, Rating: 1500}, *bob)
+
+	exists, err := s.PlayerExists(ctx, chatID, 3)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// Игрок состоит только в тех чатах, в которые вступил
+	exists, err = s.PlayerExists(ctx, otherChat, 3)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, s.AddPlayer(ctx, otherChat, 3, "carol", "carol"))
+	carol, err := s.GetPlayerByTGID(ctx, otherChat, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, carol.Score)
+}
+
+func testPlayerNotFound(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice")
+
+	_, err := s.GetPlayerByTGID(ctx, chatID, 42)
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "got %v", err)
+
+	_, err = s.GetPlayerByTGID(ctx, otherChat, 1)
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "got %v", err)
+}
+
+func testCheckPlayersExist(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob")
+
+	for _, tt := range []struct {
+		ids  []int64
+		want bool
+	}{
+		{nil, true},
+		{[]int64{1, 2}, true},
+		{[]int64{1, 3}, false},
+	} {
+		ok, err := s.CheckPlayersExist(ctx, chatID, tt.ids)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, ok, "ids %v", tt.ids)
+	}
+}
+
+func testChatScoring(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+
+	scoring, err := s.GetChatScoring(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, "", scoring)
+
+	require.NoError(t, s.SetChatScoring(ctx, chatID, "classic"))
+	require.NoError(t, s.SetChatScoring(ctx, chatID, "winner"))
+
+	scoring, err = s.GetChatScoring(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, "winner", scoring)
+
+	scoring, err = s.GetChatScoring(ctx, otherChat)
+	require.NoError(t, err)
+	assert.Equal(t, "", scoring)
+}
+
+func testChatGameConfig(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+
+	cfg, err := s.GetChatGameConfig(ctx, chatID)
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	// Настройки игры и подсчёт очков хранятся вместе, но не затирают друг друга
+	require.NoError(t, s.SetChatScoring(ctx, chatID, "winner"))
+	require.NoError(t, s.SetChatGameConfig(ctx, chatID, storage.GameConfig{MinPlayers: 3, MaxPlayers: 5, AutoPlaceLast: true}))
+	require.NoError(t, s.SetChatGameConfig(ctx, chatID, storage.GameConfig{MinPlayers: 2, MaxPlayers: 4}))
+
+	cfg, err = s.GetChatGameConfig(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, &storage.GameConfig{MinPlayers: 2, MaxPlayers: 4}, cfg)
+	scoring, err := s.GetChatScoring(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, "winner", scoring)
+
+	require.NoError(t, s.SetChatGameConfig(ctx, otherChat, storage.GameConfig{MinPlayers: 2, MaxPlayers: 6, AutoPlaceLast: true}))
+	scoring, err = s.GetChatScoring(ctx, otherChat)
+	require.NoError(t, err)
+	assert.Equal(t, "", scoring)
+}
+
+func testSessionPlaces(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol", "dave")
+
+	session, err := s.GetRecordingSession(ctx, chatID, 77)
+	require.NoError(t, err)
+	assert.Nil(t, session)
+
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 77, 5))
+	session, err = s.GetRecordingSession(ctx, chatID, 77)
+	require.NoError(t, err)
+	require.NotNil(t, session)
+	assert.Equal(t, storage.RecordingSession{ChatID: chatID, MessageID: 77, OwnerTGID: 5}, sessionKey(session))
+
+	for _, id := range []int64{3, 1, 4, 2} {
+		require.NoError(t, s.AddPlayerToSession(ctx, chatID, 77, id, false))
+	}
+
+	// Игроки ниже убранного поднимаются, новый игрок встает в конец
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 77, 1))
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 77, 1))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 77, 1, false))
+
+	players, err := s.GetSessionPlayers(ctx, chatID, 77)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4, 2, 1}, sessionIDs(players))
+	assert.Equal(t, 1500.0, players[0].Player.Rating)
+
+	// Обмен не трогает остальных, а с игроком не из сессии ничего не меняет
+	require.NoError(t, s.SwapSessionPlayers(ctx, chatID, 77, 3, 2))
+	require.NoError(t, s.SwapSessionPlayers(ctx, chatID, 77, 4, 9))
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 77, 4))
+	players, err = s.GetSessionPlayers(ctx, chatID, 77)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 1}, sessionIDs(players))
+
+	require.NoError(t, s.DeleteRecordingSession(ctx, chatID, 77))
+	session, err = s.GetRecordingSession(ctx, chatID, 77)
+	require.NoError(t, err)
+	assert.Nil(t, session)
+	players, err = s.GetSessionPlayers(ctx, chatID, 77)
+	require.NoError(t, err)
+	assert.Empty(t, players)
+}
+
+func testSessionTies(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol", "dave")
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+
+	// Делить место с предыдущим первому игроку не с кем: он просто первый
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 4, true))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 3, false))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 2, true))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 1, false))
+
+	// Поделившие место идут по ID, следующий за ними пропускает общее место
+	players, err := s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 2, 3, 1}, sessionIDs(players))
+	assert.Equal(t, []int{1, 2, 2, 4}, sessionPlaces(players))
+
+	// Без одного из поделивших место ниже стоящие поднимаются на одно место
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 1, 3))
+	players, err = s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 2, 1}, sessionIDs(players))
+	assert.Equal(t, []int{1, 2, 3}, sessionPlaces(players))
+
+	// Сессия редактирования сохраняет общие места игры
+	gameID := recordGame(t, s, chatID, 1, 2, 3)
+	require.NoError(t, s.CreateEditSession(ctx, chatID, 2, gameID, 1, []storage.SessionPlayer{
+		{Player: storage.Player{TGID: 1}, Place: 1},
+		{Player: storage.Player{TGID: 3}, Place: 2},
+		{Player: storage.Player{TGID: 2}, Place: 2},
+	}))
+	players, err = s.GetSessionPlayers(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, sessionIDs(players))
+	assert.Equal(t, []int{1, 2, 2}, sessionPlaces(players))
+}
+
+func testSessionDNF(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol", "dave")
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+
+	// Выбывший не занимает места и идет после доигравших, даже если отмечен раньше них
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 1, false))
+	require.NoError(t, s.AddDNFToSession(ctx, chatID, 1, 2))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 3, false))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 4, true))
+	players, err := s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3, 4, 2}, sessionIDs(players))
+	assert.Equal(t, []int{1, 2, 2, 0}, sessionPlaces(players))
+	assert.True(t, players[3].DNF)
+	assert.False(t, players[0].DNF)
+
+	// С выбывшим нельзя поменяться местами, а без него доигравшие не сдвигаются
+	require.NoError(t, s.SwapSessionPlayers(ctx, chatID, 1, 1, 2))
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 1, 2))
+	players, err = s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3, 4}, sessionIDs(players))
+	assert.Equal(t, []int{1, 2, 2}, sessionPlaces(players))
+
+	// Сессия редактирования сохраняет выбывших
+	gameID := recordGame(t, s, chatID, 1, 2)
+	require.NoError(t, s.CreateEditSession(ctx, chatID, 2, gameID, 1, []storage.SessionPlayer{
+		{Player: storage.Player{TGID: 2}, DNF: true},
+		{Player: storage.Player{TGID: 1}, Place: 1},
+	}))
+	players, err = s.GetSessionPlayers(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, sessionIDs(players))
+	assert.Equal(t, []bool{false, true}, []bool{players[0].DNF, players[1].DNF})
+}
+
+func testLastSelectedPlayer(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol", "dave")
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+
+	last := func(messageID int64) int64 {
+		t.Helper()
+		tgID, err := s.GetLastSelectedPlayer(ctx, chatID, messageID)
+		require.NoError(t, err)
+		return tgID
+	}
+	assert.Zero(t, last(1))
+
+	// Важен порядок выбора, а не места: ни дележ места, ни обмен, ни выбывание его не меняют
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 3, false))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 2, false))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 1, true))
+	assert.Equal(t, int64(1), last(1))
+	require.NoError(t, s.SwapSessionPlayers(ctx, chatID, 1, 3, 1))
+	assert.Equal(t, int64(1), last(1))
+	require.NoError(t, s.AddDNFToSession(ctx, chatID, 1, 4))
+	assert.Equal(t, int64(4), last(1))
+
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 1, 4))
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 1, 1))
+	assert.Equal(t, int64(2), last(1))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 4, false))
+	assert.Equal(t, int64(4), last(1))
+
+	// В сессии редактирования игроки считаются выбранными в порядке мест
+	gameID := recordGame(t, s, chatID, 1, 2)
+	require.NoError(t, s.CreateEditSession(ctx, chatID, 2, gameID, 1, []storage.SessionPlayer{
+		{Player: storage.Player{TGID: 2}, Place: 1},
+		{Player: storage.Player{TGID: 1}, Place: 2},
+	}))
+	assert.Equal(t, int64(1), last(2))
+}
+
+func testSessionLineup(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol")
+
+	// Запись начинается с набора состава, редактирование - сразу с мест
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+	session, err := s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.True(t, session.LineupOpen)
+
+	require.NoError(t, s.AddPlayerToLineup(ctx, chatID, 1, 3))
+	require.NoError(t, s.AddPlayerToLineup(ctx, chatID, 1, 1))
+	require.NoError(t, s.AddPlayerToLineup(ctx, chatID, 1, 1))
+	require.NoError(t, s.AddPlayerToLineup(ctx, chatID, 1, 2))
+	require.NoError(t, s.RemovePlayerFromLineup(ctx, chatID, 1, 2))
+	lineup, err := s.GetSessionLineup(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, tgIDs(lineup))
+
+	require.NoError(t, s.SetLineupOpen(ctx, chatID, 1, false))
+	session, err = s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.False(t, session.LineupOpen)
+
+	gameID := recordGame(t, s, chatID, 1, 2)
+	require.NoError(t, s.CreateEditSession(ctx, chatID, 2, gameID, 1, nil))
+	session, err = s.GetRecordingSession(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.False(t, session.LineupOpen)
+	lineup, err = s.GetSessionLineup(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.Empty(t, lineup)
+
+	// Состав удаляется вместе с сессией
+	require.NoError(t, s.DeleteRecordingSession(ctx, chatID, 1))
+	lineup, err = s.GetSessionLineup(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Empty(t, lineup)
+}
+
+func testParallelSessions(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol")
+	gameID := recordGame(t, s, chatID, 1, 2, 3)
+
+	// Сессии одного чата с разными сообщениями не мешают друг другу
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 1, false))
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 2, 1))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 2, 2, false))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 2, 1, false))
+	require.NoError(t, s.CreateEditSession(ctx, chatID, 3, gameID, 9, placed(2, 3, 1)))
+
+	players, err := s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, sessionIDs(players))
+	players, err = s.GetSessionPlayers(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 1}, sessionIDs(players))
+	players, err = s.GetSessionPlayers(ctx, chatID, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 1}, sessionIDs(players))
+
+	session, err := s.GetRecordingSession(ctx, chatID, 3)
+	require.NoError(t, err)
+	require.NotNil(t, session)
+	assert.Equal(t, storage.RecordingSession{ChatID: chatID, MessageID: 3, EditGameID: gameID, OwnerTGID: 9}, sessionKey(session))
+
+	// Места считаются внутри сессии, удаление не трогает соседей
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 2, 2))
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 3, false))
+	require.NoError(t, s.DeleteRecordingSession(ctx, chatID, 3))
+
+	players, err = s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, sessionIDs(players))
+	players, err = s.GetSessionPlayers(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, sessionIDs(players))
+	session, err = s.GetRecordingSession(ctx, chatID, 3)
+	require.NoError(t, err)
+	assert.Nil(t, session)
+
+	// Сообщение с тем же ID в другом чате - другая сессия
+	session, err = s.GetRecordingSession(ctx, otherChat, 1)
+	require.NoError(t, err)
+	assert.Nil(t, session)
+}
+
+// sessionKey возвращает сессию без времени создания и последнего действия.
+func sessionKey(session *storage.RecordingSession) storage.RecordingSession {
+	return storage.RecordingSession{ChatID: session.ChatID, MessageID: session.MessageID, EditGameID: session.EditGameID, OwnerTGID: session.OwnerTGID}
+}
+
+func testSessionExpiry(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob")
+
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+	created, err := s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.False(t, created.CreatedAt.IsZero())
+	assert.True(t, created.UpdatedAt.Equal(created.CreatedAt), "new session: %v != %v", created.UpdatedAt, created.CreatedAt)
+
+	// Добавление и удаление игроков продлевают сессию
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 1, false))
+	added, err := s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.True(t, added.CreatedAt.Equal(created.CreatedAt))
+	assert.True(t, added.UpdatedAt.After(created.UpdatedAt), "add: %v is not after %v", added.UpdatedAt, created.UpdatedAt)
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, s.RemovePlayerFromSession(ctx, chatID, 1, 1))
+	removed, err := s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.True(t, removed.UpdatedAt.After(added.UpdatedAt), "remove: %v is not after %v", removed.UpdatedAt, added.UpdatedAt)
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 2, false))
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 2, 1))
+	fresh, err := s.GetRecordingSession(ctx, chatID, 2)
+	require.NoError(t, err)
+
+	// Истекают только сессии, в которых ничего не происходило до границы
+	expired, err := s.DeleteExpiredSessions(ctx, fresh.UpdatedAt)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, storage.RecordingSession{ChatID: chatID, MessageID: 1, OwnerTGID: 1}, sessionKey(&expired[0]))
+
+	session, err := s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Nil(t, session)
+	players, err := s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Empty(t, players)
+
+	session, err = s.GetRecordingSession(ctx, chatID, 2)
+	require.NoError(t, err)
+	assert.NotNil(t, session)
+
+	expired, err = s.DeleteExpiredSessions(ctx, fresh.UpdatedAt)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+}
+
+func testSessionConstraints(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice")
+
+	assert.Error(t, s.AddPlayerToSession(ctx, chatID, 1, 1, false), "no session")
+
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+	assert.Error(t, s.CreateRecordingSession(ctx, chatID, 1, 1), "duplicate session")
+	require.NoError(t, s.AddPlayerToSession(ctx, chatID, 1, 1, false))
+	assert.Error(t, s.AddPlayerToSession(ctx, chatID, 1, 1, false), "duplicate player")
+
+	players, err := s.GetSessionPlayers(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, sessionIDs(players))
+}
+
+func testGames(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol")
+
+	first := recordGame(t, s, chatID, 2, 1, 3)
+	second := recordGame(t, s, chatID, 3, 2)
+	assert.Greater(t, second, first)
+
+	game, err := s.GetGame(ctx, chatID, first)
+	require.NoError(t, err)
+	require.NotNil(t, game)
+	assert.Equal(t, chatID, game.ChatID)
+	assert.Equal(t, "linear", game.Scoring)
+	assert.Equal(t, []int64{2, 1, 3}, resultIDs(game.Results))
+	assert.Equal(t, "bob", game.Results[0].Player.Username)
+	assert.Equal(t, 2, game.Results[0].Points)
+	assert.False(t, game.CreatedAt.IsZero())
+
+	last, err := s.GetLastGame(ctx, chatID)
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, second, last.ID)
+
+	results, err := s.LoadAllGames(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 1, 3, 3, 2}, resultIDs(results))
+	assert.Equal(t, first, results[0].GameID)
+	assert.Equal(t, second, results[3].GameID)
+
+	results, err = s.LoadGamesByYear(ctx, chatID, game.CreatedAt.Year())
+	require.NoError(t, err)
+	assert.Len(t, results, 5)
+
+	assert.Equal(t, map[int64]int{1: 1, 2: 2, 3: 1}, scores(t, s, chatID))
+
+	// Игры другого чата не видны
+	game, err = s.GetGame(ctx, otherChat, first)
+	require.NoError(t, err)
+	assert.Nil(t, game)
+
+	// Запоминается, кто записал игру
+	recorded, err := s.CreateGame(ctx, chatID, "linear", 2)
+	require.NoError(t, err)
+	game, err = s.GetGame(ctx, chatID, recorded)
+	require.NoError(t, err)
+	require.NotNil(t, game)
+	assert.Equal(t, int64(2), game.RecordedBy)
+	games, _, err := s.ListGames(ctx, chatID, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, games, 2)
+	assert.Equal(t, []int64{2, 0}, []int64{games[0].RecordedBy, games[1].RecordedBy})
+}
+
+func testGameNotFound(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+
+	game, err := s.GetLastGame(ctx, chatID)
+	require.NoError(t, err)
+	assert.Nil(t, game)
+
+	game, err = s.GetGame(ctx, chatID, 12345)
+	require.NoError(t, err)
+	assert.Nil(t, game)
+
+	results, err := s.LoadAllGames(ctx, chatID)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	assert.Error(t, s.DeleteGame(ctx, chatID, 12345, 1))
+}
+
+func testListGames(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob")
+
+	var ids []int
+	for range 5 {
+		ids = append(ids, recordGame(t, s, chatID, 1, 2))
+	}
+
+	games, total, err := s.ListGames(ctx, chatID, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 5, total)
+	require.Len(t, games, 2)
+	assert.Equal(t, ids[4], games[0].ID)
+	assert.Equal(t, ids[3], games[1].ID)
+	assert.Equal(t, []int64{1, 2}, resultIDs(games[0].Results))
+
+	games, total, err = s.ListGames(ctx, chatID, 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 5, total)
+	require.Len(t, games, 1)
+	assert.Equal(t, ids[0], games[0].ID)
+
+	games, total, err = s.ListGames(ctx, otherChat, 0, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, games)
+}
+
+func testLoadGamesSince(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob")
+
+	old := recordGame(t, s, chatID, 1, 2)
+	oldGame, err := s.GetGame(ctx, chatID, old)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	recent := recordGame(t, s, chatID, 2, 1)
+
+	games, err := s.LoadGamesSince(ctx, chatID, oldGame.CreatedAt)
+	require.NoError(t, err)
+	require.Len(t, games, 1)
+	assert.Equal(t, recent, games[0].ID)
+	assert.Equal(t, []int64{2, 1}, resultIDs(games[0].Results))
+
+	games, err = s.LoadGamesSince(ctx, chatID, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, games, 2)
+}
+
+func testRatingHistory(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob")
+
+	first := recordGame(t, s, chatID, 1, 2)
+	require.NoError(t, s.SaveRatingChanges(ctx, chatID, []storage.RatingChange{
+		{GameID: first, TGID: 1, Before: 1500, After: 1516},
+		{GameID: first, TGID: 2, Before: 1500, After: 1484},
+	}))
+	second := recordGame(t, s, chatID, 1, 2)
+	require.NoError(t, s.SaveRatingChanges(ctx, chatID, []storage.RatingChange{
+		{GameID: second, TGID: 1, Before: 1516, After: 1530},
+		{GameID: second, TGID: 2, Before: 1484, After: 1470},
+	}))
+
+	alice, err := s.GetPlayerByTGID(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1530.0, alice.Rating)
+
+	history, err := s.GetRatingHistory(ctx, chatID, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, second, history[0].GameID)
+	assert.Equal(t, 1530.0, history[0].After)
+
+	game, err := s.GetGame(ctx, chatID, first)
+	require.NoError(t, err)
+	assert.Equal(t, 1484.0, game.Results[1].RatingAfter)
+
+	// Пересчет заменяет историю: у игрока без записей - начальный рейтинг
+	require.NoError(t, s.ReplaceRatings(ctx, chatID, []storage.RatingChange{
+		{GameID: first, TGID: 1, Before: 1500, After: 1510, Date: time.Now()},
+	}, 1500))
+
+	history, err = s.GetRatingHistory(ctx, chatID, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, 1510.0, history[0].After)
+
+	players, err := s.GetAllPlayers(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, 1510.0, players[0].Rating)
+	assert.Equal(t, 1500.0, players[1].Rating)
+}
+
+func testDeleteGame(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob")
+
+	keep := recordGame(t, s, chatID, 2, 1)
+	gameID := recordGame(t, s, chatID, 1, 2)
+	require.NoError(t, s.SaveRatingChanges(ctx, chatID, []storage.RatingChange{
+		{GameID: gameID, TGID: 1, Before: 1500, After: 1516},
+		{GameID: gameID, TGID: 2, Before: 1500, After: 1484},
+	}))
+
+	// Чужой чат не может удалить игру
+	assert.Error(t, s.DeleteGame(ctx, otherChat, gameID, 1))
+
+	require.NoError(t, s.DeleteGame(ctx, chatID, gameID, 1))
+
+	game, err := s.GetGame(ctx, chatID, gameID)
+	require.NoError(t, err)
+	assert.Nil(t, game)
+
+	last, err := s.GetLastGame(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, keep, last.ID)
+
+	assert.Equal(t, map[int64]int{1: 0, 2: 1}, scores(t, s, chatID))
+	alice, err := s.GetPlayerByTGID(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1500.0, alice.Rating)
+
+	history, err := s.GetRatingHistory(ctx, chatID, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testUpdateGameResults(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol")
+	gameID := recordGame(t, s, chatID, 1, 2, 3)
+
+	edited := []storage.GameResult{
+		{Player: storage.Player{TGID: 3}, Place: 1, Points: 2},
+		{Player: storage.Player{TGID: 1}, Place: 2, Points: 1},
+		{Player: storage.Player{TGID: 2}, Place: 3, Points: 0},
+	}
+	require.NoError(t, s.UpdateGameResults(ctx, chatID, gameID, edited, 2))
+	edited[0], edited[1] = edited[1], edited[0]
+	edited[0].Place, edited[1].Place = 1, 2
+	require.NoError(t, s.UpdateGameResults(ctx, chatID, gameID, edited, 3))
+
+	game, err := s.GetGame(ctx, chatID, gameID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3, 2}, resultIDs(game.Results))
+	assert.Equal(t, map[int64]int{1: 1, 2: 0, 3: 2}, scores(t, s, chatID))
+
+	versions, err := s.GetGameVersions(ctx, gameID)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 1, versions[0].Version)
+	assert.Equal(t, storage.Player{TGID: 2, DisplayName: "bob"}, versions[0].EditedBy)
+	assert.Equal(t, []int64{1, 2, 3}, resultIDs(versions[0].Results))
+	assert.Equal(t, 2, versions[1].Version)
+	assert.Equal(t, []int64{3, 1, 2}, resultIDs(versions[1].Results))
+}
+
+func testResultStatus(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol")
+	gameID, err := s.CreateGame(ctx, chatID, "linear", 0)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveGameResults(ctx, []storage.GameResult{
+		{GameID: gameID, Player: storage.Player{TGID: 1}, Place: 1, Points: 1},
+		{GameID: gameID, Player: storage.Player{TGID: 2}, Place: 2, Points: 0},
+		{GameID: gameID, Player: storage.Player{TGID: 3}, Place: 3, Points: -2, DNF: true},
+	}))
+
+	dnf := func(results []storage.GameResult) []bool {
+		flags := make([]bool, len(results))
+		for i, r := range results {
+			flags[i] = r.DNF
+		}
+		return flags
+	}
+	all, err := s.LoadAllGames(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, dnf(all))
+	game, err := s.GetGame(ctx, chatID, gameID)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, dnf(game.Results))
+	assert.Equal(t, -2, game.Results[2].Points)
+
+	// Выбывший вернулся в игру при редактировании, прежний статус остается в версии
+	require.NoError(t, s.UpdateGameResults(ctx, chatID, gameID, []storage.GameResult{
+		{Player: storage.Player{TGID: 3}, Place: 1, Points: 2},
+		{Player: storage.Player{TGID: 1}, Place: 2, Points: 1},
+		{Player: storage.Player{TGID: 2}, Place: 3, Points: -2, DNF: true},
+	}, 1))
+	game, err = s.GetGame(ctx, chatID, gameID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 1, 2}, resultIDs(game.Results))
+	assert.Equal(t, []bool{false, false, true}, dnf(game.Results))
+	versions, err := s.GetGameVersions(ctx, gameID)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, []int64{1, 2, 3}, resultIDs(versions[0].Results))
+	assert.Equal(t, []bool{false, false, true}, dnf(versions[0].Results))
+}
+
+func testSeasons(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+
+	active, err := s.GetActiveSeason(ctx, chatID)
+	require.NoError(t, err)
+	assert.Nil(t, active)
+
+	spring, err := s.CreateSeason(ctx, chatID, "spring")
+	require.NoError(t, err)
+	assert.Equal(t, "spring", spring.Name)
+	assert.False(t, spring.StartedAt.IsZero())
+
+	_, err = s.CreateSeason(ctx, chatID, "summer")
+	assert.Error(t, err, "second active season")
+
+	require.NoError(t, s.EndSeason(ctx, chatID, spring.ID))
+	_, err = s.CreateSeason(ctx, chatID, "spring")
+	assert.Error(t, err, "duplicate name")
+
+	time.Sleep(10 * time.Millisecond)
+	summer, err := s.CreateSeason(ctx, chatID, "summer")
+	require.NoError(t, err)
+
+	active, err = s.GetActiveSeason(ctx, chatID)
+	require.NoError(t, err)
+	require.NotNil(t, active)
+	assert.Equal(t, summer.ID, active.ID)
+	assert.Nil(t, active.EndedAt)
+
+	found, err := s.GetSeasonByName(ctx, chatID, "spring")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.NotNil(t, found.EndedAt)
+
+	found, err = s.GetSeasonByName(ctx, otherChat, "spring")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	seasons, err := s.ListSeasons(ctx, chatID)
+	require.NoError(t, err)
+	require.Len(t, seasons, 2)
+	assert.Equal(t, "summer", seasons[0].Name)
+	assert.Equal(t, "spring", seasons[1].Name)
+}
+
+func testEndSeason(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob", "carol")
+	recordGame(t, s, chatID, 1, 2, 3) // до сезона: не считается ни в очках, ни в играх сезона
+
+	season, err := s.CreateSeason(ctx, chatID, "spring")
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int{1: 0, 2: 0, 3: 0}, scores(t, s, chatID))
+	recordGame(t, s, chatID, 2, 1)
+	// Игра, из которой carol выбыла, тоже считается сыгранной
+	gameID, err := s.CreateGame(ctx, chatID, "linear", 0)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveGameResults(ctx, []storage.GameResult{
+		{GameID: gameID, Player: storage.Player{TGID: 2}, Place: 1, Points: 1},
+		{GameID: gameID, Player: storage.Player{TGID: 3}, Place: 2, DNF: true},
+	}))
+	require.NoError(t, s.UpdatePlayerScore(ctx, chatID, 2, 1))
+
+	games, err := s.GetSeasonGameCounts(ctx, season.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int{1: 1, 2: 2, 3: 1}, games)
+
+	// Очки за сезон: alice 0, bob 2, carol 3 -> carol первая, bob второй, alice третья
+	require.NoError(t, s.UpdatePlayerScore(ctx, chatID, 3, 3))
+	require.NoError(t, s.EndSeason(ctx, chatID, season.ID))
+
+	standings, err := s.GetSeasonStandings(ctx, season.ID)
+	require.NoError(t, err)
+	require.Len(t, standings, 3)
+	assert.Equal(t, storage.SeasonStanding{
+		Player: storage.Player{TGID: 3, Username: "carol", DisplayName: "carol", Score: 3},
+		Place:  1, Score: 3, Games: 1,
+	}, standings[0])
+	assert.Equal(t, []int64{2, 1}, []int64{standings[1].Player.TGID, standings[2].Player.TGID})
+	assert.Equal(t, []int{2, 0}, []int{standings[1].Score, standings[2].Score})
+	assert.Equal(t, []int{2, 3}, []int{standings[1].Place, standings[2].Place})
+	assert.Equal(t, []int{2, 1}, []int{standings[1].Games, standings[2].Games})
+
+	assert.Equal(t, map[int64]int{1: 0, 2: 0, 3: 0}, scores(t, s, chatID))
+
+	active, err := s.GetActiveSeason(ctx, chatID)
+	require.NoError(t, err)
+	assert.Nil(t, active)
+
+	// Игры между сезонами тоже не попадают в очки следующего сезона
+	recordGame(t, s, chatID, 1, 2)
+	summer, err := s.CreateSeason(ctx, chatID, "summer")
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int{1: 0, 2: 0, 3: 0}, scores(t, s, chatID))
+	recordGame(t, s, chatID, 3, 1)
+	require.NoError(t, s.EndSeason(ctx, chatID, summer.ID))
+
+	standings, err = s.GetSeasonStandings(ctx, summer.ID)
+	require.NoError(t, err)
+	require.Len(t, standings, 3)
+	assert.Equal(t, []int64{3, 1, 2}, []int64{standings[0].Player.TGID, standings[1].Player.TGID, standings[2].Player.TGID})
+	assert.Equal(t, []int{1, 0, 0}, []int{standings[0].Score, standings[1].Score, standings[2].Score})
+	assert.Equal(t, []int{1, 1, 0}, []int{standings[0].Games, standings[1].Games, standings[2].Games})
+}
+
+func testWithTx(t *testing.T, s service.StorageInterface) {
+	ctx := context.Background()
+	addPlayers(t, s, chatID, "alice", "bob")
+	require.NoError(t, s.CreateRecordingSession(ctx, chatID, 1, 1))
+
+	errAbort := errors.New("abort")
+	err := s.WithTx(ctx, func(tx storage.Tx) error {
+		gameID, err := tx.CreateGame(ctx, chatID, "linear", 0)
+		require.NoError(t, err)
+		require.NoError(t, tx.SaveGameResults(ctx, []storage.GameResult{{GameID: gameID, Player: storage.Player{TGID: 1}, Place: 1, Points: 1}}))
+		require.NoError(t, tx.UpdatePlayerScore(ctx, chatID, 1, 1))
+		require.NoError(t, tx.DeleteRecordingSession(ctx, chatID, 1))
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	// Откат: ни игры, ни очков, сессия на месте
+	game, err := s.GetLastGame(ctx, chatID)
+	require.NoError(t, err)
+	assert.Nil(t, game)
+	assert.Equal(t, map[int64]int{1: 0, 2: 0}, scores(t, s, chatID))
+	session, err := s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.NotNil(t, session)
+
+	var gameID int
+	err = s.WithTx(ctx, func(tx storage.Tx) error {
+		players, err := tx.GetAllPlayers(ctx, chatID)
+		require.NoError(t, err)
+		require.Len(t, players, 2)
+
+		gameID, err = tx.CreateGame(ctx, chatID, "linear", 0)
+		require.NoError(t, err)
+		require.NoError(t, tx.SaveGameResults(ctx, []storage.GameResult{{GameID: gameID, Player: storage.Player{TGID: 2}, Place: 1, Points: 3}}))
+		require.NoError(t, tx.SetResultPoints(ctx, gameID, 2, 1))
+		require.NoError(t, tx.UpdatePlayerScore(ctx, chatID, 2, 1))
+		require.NoError(t, tx.SaveRatingChanges(ctx, chatID, []storage.RatingChange{{GameID: gameID, TGID: 2, Before: 1500, After: 1510}}))
+		return tx.DeleteRecordingSession(ctx, chatID, 1)
+	})
+	require.NoError(t, err)
+
+	game, err = s.GetLastGame(ctx, chatID)
+	require.NoError(t, err)
+	require.NotNil(t, game)
+	assert.Equal(t, gameID, game.ID)
+	assert.Equal(t, 1, game.Results[0].Points)
+	assert.Equal(t, 1510.0, game.Results[0].RatingAfter)
+	assert.Equal(t, map[int64]int{1: 0, 2: 1}, scores(t, s, chatID))
+	session, err = s.GetRecordingSession(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Nil(t, session)
+
+	// Правка результатов откатывается вместе с пересчетом рейтингов
+	err = s.WithTx(ctx, func(tx storage.Tx) error {
+		require.NoError(t, tx.UpdateGameResults(ctx, chatID, gameID, []storage.GameResult{
+			{GameID: gameID, Player: storage.Player{TGID: 1}, Place: 1, Points: 1},
+			{GameID: gameID, Player: storage.Player{TGID: 2}, Place: 2, Points: 0},
+		}, 1))
+		results, err := tx.LoadAllGames(ctx, chatID)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 2}, resultIDs(results))
+		require.NoError(t, tx.ReplaceRatings(ctx, chatID, nil, 1500))
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	game, err = s.GetGame(ctx, chatID, gameID)
+	require.NoError(t, err)
+	require.NotNil(t, game)
+	assert.Equal(t, []int64{2}, resultIDs(game.Results))
+	assert.Equal(t, 1510.0, game.Results[0].RatingAfter)
+}
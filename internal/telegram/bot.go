@@ -1,22 +1,49 @@
 package telegram
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
 	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
 	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage/memory"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage/sqlite"
 )
 
 type Bot struct {
 	bot     *tgbotapi.BotAPI
 	handler *Handler
+	store   Store
+	// webhook - настройки вебхука; nil - обновления получаются long polling'ом.
+	webhook *WebhookConfig
+	// workers и queueSize - размер пула обработчиков обновлений и длина очереди каждого.
+	workers   int
+	queueSize int
+	// shutdownTimeout - сколько при остановке ждать обработки уже полученных обновлений.
+	shutdownTimeout time.Duration
 }
 
-func NewBot() (*Bot, error) {
+// Store - хранилище бота: данные для сервиса и освобождение ресурсов при остановке.
+type Store interface {
+	service.StorageInterface
+	ListChats(ctx context.Context) ([]int64, error)
+	Close()
+}
+
+// DefaultShutdownTimeout - сколько по умолчанию ждать обработки обновлений при остановке.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// sessionJanitorInterval - как часто удаляются истекшие сессии записи.
+const sessionJanitorInterval = time.Minute
+
+func NewBot(ctx context.Context) (*Bot, error) {
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Warning: .env file not found, using system variables")
@@ -32,79 +59,391 @@ func NewBot() (*Bot, error) {
 		return nil, err
 	}
 
-	dsn := os.Getenv("POSTGRES_DSN")
-	if dsn == "" {
-		log.Fatal("POSTGRES_DSN is not set")
-	}
-
-	store, err := storage.New(dsn)
+	store, err := OpenStore(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	err = store.Ping()
+	var cfg service.Config
+	if table := os.Getenv("SCORING_TABLE"); table != "" {
+		cfg.ScoringTable, err = service.ParsePointsTable(table)
+		if err != nil {
+			log.Fatalf("invalid SCORING_TABLE: %v", err)
+		}
+	}
+
+	if period := os.Getenv("RATING_PERIOD"); period != "" {
+		cfg.RatingPeriod, err = time.ParseDuration(period)
+		if err != nil || cfg.RatingPeriod < 24*time.Hour {
+			log.Fatalf("invalid RATING_PERIOD %q: must be a duration of at least 24h", period)
+		}
+	}
+
+	if window := os.Getenv("UNDO_WINDOW"); window != "" {
+		cfg.UndoWindow, err = time.ParseDuration(window)
+		if err != nil {
+			log.Fatalf("invalid UNDO_WINDOW %q: %v", window, err)
+		}
+	}
+
+	var webhook *WebhookConfig
+	switch mode := os.Getenv("BOT_MODE"); mode {
+	case "", "polling":
+	case "webhook":
+		webhook = &WebhookConfig{
+			Listen: os.Getenv("WEBHOOK_LISTEN"),
+			Path:   os.Getenv("WEBHOOK_PATH"),
+			Secret: os.Getenv("WEBHOOK_SECRET"),
+			URL:    os.Getenv("WEBHOOK_URL"),
+		}
+		if webhook.Listen == "" {
+			webhook.Listen = ":8080"
+		}
+		if err := webhook.Validate(); err != nil {
+			log.Fatalf("invalid webhook config: %v", err)
+		}
+	default:
+		log.Fatalf("invalid BOT_MODE %q: must be polling or webhook", mode)
+	}
+
+	workers, err := envInt("BOT_WORKERS", DefaultWorkers)
 	if err != nil {
-		log.Fatalf("cannot ping DB: %v", err)
-	} else {
-		log.Println("✅ Connected to Postgres")
+		log.Fatal(err)
+	}
+	queueSize, err := envInt("BOT_QUEUE_SIZE", DefaultQueueSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTimeout, err := envDuration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.SessionTTL, err = envDuration("SESSION_TTL", service.DefaultSessionTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if policy := os.Getenv("RECORD_POLICY"); policy != "" {
+		cfg.RecordPolicy, err = service.ParseRecordPolicy(policy)
+		if err != nil {
+			log.Fatalf("invalid RECORD_POLICY: %v (must be owner, participants or admins)", err)
+		}
+	}
+	if penalty := os.Getenv("DNF_PENALTY"); penalty != "" {
+		cfg.DNFPenalty, err = strconv.Atoi(penalty)
+		if err != nil || cfg.DNFPenalty < 0 {
+			log.Fatalf("invalid DNF_PENALTY %q: must be a non-negative integer", penalty)
+		}
 	}
 
-	svc := service.New(store)
+	svc := service.New(store, cfg)
 	handler := NewHandler(botAPI, svc)
 
 	return &Bot{
-		bot:     botAPI,
-		handler: handler,
+		bot:             botAPI,
+		handler:         handler,
+		store:           store,
+		webhook:         webhook,
+		workers:         workers,
+		queueSize:       queueSize,
+		shutdownTimeout: shutdownTimeout,
 	}, nil
 }
 
-func (b *Bot) Start() {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates := b.bot.GetUpdatesChan(u)
-
-	log.Println("Bot started!")
-
-	for update := range updates {
-		if update.Message != nil { // If we got a message
-			msg := update.Message
-			switch msg.Command() {
-			case "start":
-				b.handler.HandleHelp(msg)
-			case "help":
-				b.handler.HandleHelp(msg)
-			case "join":
-				b.handler.HandleJoin(msg.Chat.ID, msg.From)
-			case "leaderboard":
-				b.handler.HandleLeaderboard(msg.Chat.ID)
-			case "myscore":
-				b.handler.HandleMyScore(msg.Chat.ID, msg.From)
-			case "record":
-				b.handler.HandleRecordStart(msg)
+// OpenStore открывает хранилище. STORAGE=memory - хранилище в памяти; иначе хранилище
+// выбирается по схеме DB_DSN (или POSTGRES_DSN): sqlite:путь - файл SQLite, остальное - PostgreSQL.
+// Схема базы обновляется миграциями, если не задано AUTO_MIGRATE=false, и проверяется на совместимость.
+func OpenStore(ctx context.Context) (Store, error) {
+	switch backend := os.Getenv("STORAGE"); backend {
+	case "":
+	case "memory":
+		log.Println("⚠️ Using in-memory storage, data will be lost on restart")
+		return memory.New(), nil
+	default:
+		log.Fatalf("invalid STORAGE %q: only memory is supported, databases are selected by DB_DSN", backend)
+	}
+
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("POSTGRES_DSN")
+	}
+	if dsn == "" {
+		log.Fatal("DB_DSN is not set")
+	}
+
+	queryTimeout, err := envDuration("DB_TIMEOUT", storage.DefaultQueryTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var store interface {
+		Store
+		Migrate(ctx context.Context) error
+		CheckSchema(ctx context.Context) error
+	}
+	if sqlite.IsDSN(dsn) {
+		store, err = sqlite.Open(ctx, dsn, queryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("✅ Opened SQLite database")
+	} else {
+		pg, err := storage.New(ctx, dsn, queryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if err := pg.Ping(ctx); err != nil {
+			log.Fatalf("cannot ping DB: %v", err)
+		}
+		log.Println("✅ Connected to Postgres")
+		store = pg
+	}
+
+	// AUTO_MIGRATE=false - если миграции применяются отдельно, бот только проверяет схему
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		if err := store.Migrate(ctx); err != nil {
+			log.Fatalf("cannot migrate DB: %v", err)
+		}
+	}
+	if err := store.CheckSchema(ctx); err != nil {
+		log.Fatalf("refusing to start: %v", err)
+	}
+	return store, nil
+}
+
+// envInt читает положительное целое из переменной окружения name или возвращает def, если она не задана.
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive integer", name, value)
+	}
+	return n, nil
+}
+
+// envDuration читает положительную длительность из переменной окружения name или возвращает def, если она не задана.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive duration", name, value)
+	}
+	return d, nil
+}
+
+// Start получает и обрабатывает обновления, пока не отменен ctx. После отмены перестает
+// принимать новые обновления и ждет обработки уже полученных не дольше shutdownTimeout,
+// после чего отменяет незавершенные запросы.
+func (b *Bot) Start(ctx context.Context) {
+	// Обработчики не должны прерываться сразу при остановке - им дается время до конца ожидания
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	dispatcher := NewDispatcher(b.workers, b.queueSize, func(update tgbotapi.Update) {
+		b.handleUpdate(workCtx, update)
+	})
+	go logDispatcherStats(ctx, dispatcher, time.Minute)
+	go runSessionJanitor(ctx, b.handler, sessionJanitorInterval)
+
+	var updates tgbotapi.UpdatesChannel
+	var stop func(context.Context)
+	if b.webhook != nil {
+		var err error
+		updates, stop, err = b.listenWebhook(ctx, *b.webhook)
+		if err != nil {
+			log.Fatalf("cannot start webhook: %v", err)
+		}
+	} else {
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+		updates = b.bot.GetUpdatesChan(u)
+		stop = func(context.Context) { b.bot.StopReceivingUpdates() }
+	}
+
+	log.Printf("Bot started! Workers: %d, queue size: %d", b.workers, b.queueSize)
+
+receive:
+	for {
+		select {
+		case <-ctx.Done():
+			break receive
+		case update, ok := <-updates:
+			if !ok {
+				break receive
 			}
-		} else if update.CallbackQuery != nil {
-			callback := update.CallbackQuery
+			dispatcher.Dispatch(update)
+		}
+	}
+
+	log.Printf("Stopping bot, waiting up to %s for in-flight updates...", b.shutdownTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), b.shutdownTimeout)
+	defer cancel()
 
-			if strings.HasPrefix(callback.Data, "record_") {
-				b.handler.HandleRecordCallback(callback)
-				continue
+	stop(drainCtx)
+	// Обновления, которые уже получены, но еще не переданы в обработку, тоже обрабатываем
+	for pending := true; pending; {
+		select {
+		case update, ok := <-updates:
+			if ok {
+				dispatcher.Dispatch(update)
+			} else {
+				pending = false
 			}
+		default:
+			pending = false
+		}
+	}
 
-			switch callback.Data {
-			case "help":
-				b.handler.HandleHelp(callback.Message)
-			case "join":
-				b.handler.HandleJoin(callback.Message.Chat.ID, callback.From)
-			case "leaderboard":
-				b.handler.HandleLeaderboard(callback.Message.Chat.ID)
-			case "myscore":
-				b.handler.HandleMyScore(callback.Message.Chat.ID, callback.From)
+	if err := dispatcher.Shutdown(drainCtx); err != nil {
+		log.Printf("Not all updates were processed before shutdown: %v (%+v)", err, dispatcher.Stats())
+		return
+	}
+	log.Println("All updates processed")
+}
+
+// Close освобождает ресурсы бота: закрывает хранилище.
+func (b *Bot) Close() {
+	b.store.Close()
+}
+
+// logDispatcherStats раз в interval пишет в лог метрики диспетчера, если за это время были обновления.
+func logDispatcherStats(ctx context.Context, d *Dispatcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last DispatcherStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stats := d.Stats()
+		if stats.Dispatched == last.Dispatched {
+			continue
+		}
+		log.Printf("[Dispatcher] queued: %d, processed: %d (+%d), blocked: %d (+%d), waited: %s (+%s)",
+			stats.Queued, stats.Processed, stats.Processed-last.Processed,
+			stats.Blocked, stats.Blocked-last.Blocked, stats.Waited, stats.Waited-last.Waited)
+		last = stats
+	}
+}
+
+// runSessionJanitor раз в interval удаляет истекшие сессии записи, пока не отменен ctx.
+func runSessionJanitor(ctx context.Context, h *Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		h.ExpireSessions(ctx)
+	}
+}
+
+// handleUpdate передает обновление нужному обработчику. Одинаково для polling и вебхука.
+func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	if update.Message != nil { // If we got a message
+		msg := update.Message
+		switch msg.Command() {
+		case "start":
+			b.handler.HandleHelp(msg)
+		case "help":
+			b.handler.HandleHelp(msg)
+		case "join":
+			b.handler.HandleJoin(ctx, msg.Chat.ID, msg.From)
+		case "leaderboard":
+			args := strings.TrimSpace(msg.CommandArguments())
+			if season, ok := strings.CutPrefix(args, "season:"); ok {
+				b.handler.HandleSeasonLeaderboard(ctx, msg.Chat.ID, strings.TrimSpace(season))
+				return
 			}
-			// Answer callback query so the loading icon on the button disappears
-			callbackResp := tgbotapi.NewCallback(callback.ID, "")
-			if _, err := b.bot.Request(callbackResp); err != nil {
-				log.Printf("Failed to send callback request: %v", err)
+			order := service.ByPoints
+			if args == "rating" {
+				order = service.ByRating
 			}
+			b.handler.HandleLeaderboard(ctx, msg.Chat.ID, order)
+		case "season":
+			b.handler.HandleSeason(ctx, msg)
+		case "myscore":
+			b.handler.HandleMyScore(ctx, msg.Chat.ID, msg.From)
+		case "stats":
+			b.handler.HandleStats(ctx, msg)
+		case "vs":
+			b.handler.HandleVs(ctx, msg)
+		case "rating":
+			b.handler.HandleRating(ctx, msg.Chat.ID, msg.From)
+		case "glicko":
+			b.handler.HandleGlicko(ctx, msg.Chat.ID)
+		case "record":
+			b.handler.HandleRecordStart(ctx, msg)
+		case "scoring":
+			b.handler.HandleScoring(ctx, msg)
+		case "gameconfig":
+			b.handler.HandleGameConfig(ctx, msg)
+		case "undo":
+			b.handler.HandleUndo(ctx, msg)
+		case "recalc":
+			b.handler.HandleRecalc(ctx, msg)
+		case "editgame":
+			b.handler.HandleEditGame(ctx, msg)
+		case "games":
+			b.handler.HandleGames(ctx, msg.Chat.ID)
+		case "game":
+			b.handler.HandleGame(ctx, msg)
+		}
+	} else if update.CallbackQuery != nil {
+		callback := update.CallbackQuery
+
+		if strings.HasPrefix(callback.Data, "record_") {
+			b.handler.HandleRecordCallback(ctx, callback)
+			return
+		}
+		if strings.HasPrefix(callback.Data, "vs_") {
+			b.handler.HandleVsCallback(ctx, callback)
+			return
+		}
+		if strings.HasPrefix(callback.Data, "games_page_") {
+			b.handler.HandleGamesCallback(ctx, callback)
+			return
+		}
+		if callback.Data == "recalc_fix" {
+			b.handler.HandleRecalcCallback(ctx, callback)
+			return
+		}
+		if strings.HasPrefix(callback.Data, "undo_") {
+			b.handler.HandleUndoCallback(ctx, callback)
+			return
+		}
+		if strings.HasPrefix(callback.Data, "scoring_") {
+			b.handler.HandleScoringCallback(ctx, callback)
+			return
+		}
+
+		switch callback.Data {
+		case "help":
+			b.handler.HandleHelp(callback.Message)
+		case "join":
+			b.handler.HandleJoin(ctx, callback.Message.Chat.ID, callback.From)
+		case "leaderboard":
+			b.handler.HandleLeaderboard(ctx, callback.Message.Chat.ID, service.ByPoints)
+		case "leaderboard_rating":
+			b.handler.HandleLeaderboard(ctx, callback.Message.Chat.ID, service.ByRating)
+		case "myscore":
+			b.handler.HandleMyScore(ctx, callback.Message.Chat.ID, callback.From)
+		}
+		// Answer callback query so the loading icon on the button disappears
+		callbackResp := tgbotapi.NewCallback(callback.ID, "")
+		if _, err := b.bot.Request(callbackResp); err != nil {
+			log.Printf("Failed to send callback request: %v", err)
 		}
 	}
 }
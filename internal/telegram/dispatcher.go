@@ -0,0 +1,155 @@
+package telegram
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// DefaultWorkers - размер пула обработчиков по умолчанию.
+	DefaultWorkers = 8
+	// DefaultQueueSize - длина очереди одного обработчика по умолчанию.
+	DefaultQueueSize = 64
+)
+
+// Dispatcher обрабатывает обновления пулом из фиксированного числа обработчиков.
+// Обновления одного чата всегда попадают в одну очередь и обрабатываются по порядку,
+// обновления разных чатов - параллельно. Если очередь переполнена, Dispatch ждет
+// (обратное давление на polling или HTTP-сервер вебхука).
+type Dispatcher struct {
+	handle func(tgbotapi.Update)
+	queues []chan tgbotapi.Update
+	wg     sync.WaitGroup
+
+	dispatched atomic.Int64
+	processed  atomic.Int64
+	blocked    atomic.Int64
+	waitNanos  atomic.Int64
+}
+
+// DispatcherStats - метрики диспетчера.
+type DispatcherStats struct {
+	Workers    int
+	Queued     int           // обновлений ждут в очередях сейчас
+	Dispatched int64         // обновлений принято всего
+	Processed  int64         // обновлений обработано всего
+	Blocked    int64         // сколько раз очередь была заполнена и прием обновления ждал
+	Waited     time.Duration // суммарное время ожидания из-за заполненных очередей
+}
+
+// NewDispatcher запускает workers обработчиков с очередями длиной queueSize.
+// Неположительные значения заменяются значениями по умолчанию.
+func NewDispatcher(workers, queueSize int, handle func(tgbotapi.Update)) *Dispatcher {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	d := &Dispatcher{
+		handle: handle,
+		queues: make([]chan tgbotapi.Update, workers),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan tgbotapi.Update, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+// Dispatch ставит обновление в очередь его чата. Блокируется, пока в очереди нет места.
+func (d *Dispatcher) Dispatch(update tgbotapi.Update) {
+	queue := d.queues[chatKey(update)%uint64(len(d.queues))]
+	d.dispatched.Add(1)
+
+	select {
+	case queue <- update:
+		return
+	default:
+	}
+
+	d.blocked.Add(1)
+	start := time.Now()
+	queue <- update
+	d.waitNanos.Add(int64(time.Since(start)))
+}
+
+// Close перестает принимать обновления и ждет, пока обработаются уже поставленные в очередь.
+func (d *Dispatcher) Close() {
+	_ = d.Shutdown(context.Background())
+}
+
+// Shutdown перестает принимать обновления и ждет обработки поставленных в очередь,
+// но не дольше, чем живет ctx. Возвращает ошибку ctx, если не дождался.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	for _, q := range d.queues {
+		close(q)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats возвращает текущие метрики диспетчера.
+func (d *Dispatcher) Stats() DispatcherStats {
+	stats := DispatcherStats{
+		Workers:    len(d.queues),
+		Dispatched: d.dispatched.Load(),
+		Processed:  d.processed.Load(),
+		Blocked:    d.blocked.Load(),
+		Waited:     time.Duration(d.waitNanos.Load()),
+	}
+	for _, q := range d.queues {
+		stats.Queued += len(q)
+	}
+	return stats
+}
+
+func (d *Dispatcher) work(queue <-chan tgbotapi.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		d.process(update)
+	}
+}
+
+// process обрабатывает одно обновление. Паника в обработчике не должна ронять весь пул.
+func (d *Dispatcher) process(update tgbotapi.Update) {
+	defer d.processed.Add(1)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic while handling update %d: %v\n%s", update.UpdateID, r, debug.Stack())
+		}
+	}()
+	d.handle(update)
+}
+
+// chatKey возвращает ключ очереди обновления - ID чата, а для обновлений без чата ID пользователя.
+func chatKey(update tgbotapi.Update) uint64 {
+	switch {
+	case update.Message != nil:
+		return uint64(update.Message.Chat.ID)
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return uint64(update.CallbackQuery.Message.Chat.ID)
+	}
+	if user := update.SentFrom(); user != nil {
+		return uint64(user.ID)
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func chatUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}}}
+}
+
+func TestDispatcher_PerChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[int64][]int)
+	d := NewDispatcher(4, 2, func(u tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[u.Message.Chat.ID] = append(seen[u.Message.Chat.ID], u.UpdateID)
+	})
+
+	for i := 0; i < 300; i++ {
+		d.Dispatch(chatUpdate(i, int64(i%3)))
+	}
+	d.Close()
+
+	for chatID, ids := range seen {
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Fatalf("чат %d: обновления обработаны не по порядку: %v", chatID, ids)
+			}
+		}
+	}
+	if stats := d.Stats(); stats.Dispatched != 300 || stats.Processed != 300 || stats.Queued != 0 {
+		t.Errorf("неверные метрики: %+v", stats)
+	}
+}
+
+func TestDispatcher_SlowChatDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan int64, 1)
+	d := NewDispatcher(2, 1, func(u tgbotapi.Update) {
+		if u.Message.Chat.ID == 0 {
+			<-release
+			return
+		}
+		done <- u.Message.Chat.ID
+	})
+	defer d.Close()
+	defer close(release)
+
+	d.Dispatch(chatUpdate(1, 0))
+	d.Dispatch(chatUpdate(2, 1))
+
+	select {
+	case chatID := <-done:
+		if chatID != 1 {
+			t.Errorf("ожидался чат 1, получен %d", chatID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("медленный чат заблокировал обработку другого чата")
+	}
+}
+
+func TestDispatcher_Backpressure(t *testing.T) {
+	release := make(chan struct{})
+	d := NewDispatcher(1, 1, func(tgbotapi.Update) { <-release })
+
+	d.Dispatch(chatUpdate(1, 5)) // обрабатывается
+	time.Sleep(10 * time.Millisecond)
+	d.Dispatch(chatUpdate(2, 5)) // ждет в очереди
+
+	dispatched := make(chan struct{})
+	go func() {
+		d.Dispatch(chatUpdate(3, 5)) // очередь заполнена - ждем
+		close(dispatched)
+	}()
+
+	select {
+	case <-dispatched:
+		t.Fatal("Dispatch не должен возвращаться, пока очередь заполнена")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-dispatched
+	d.Close()
+
+	if stats := d.Stats(); stats.Blocked != 1 || stats.Waited <= 0 || stats.Processed != 3 {
+		t.Errorf("неверные метрики обратного давления: %+v", stats)
+	}
+}
+
+func TestDispatcher_RecoversFromPanic(t *testing.T) {
+	var handled []int
+	d := NewDispatcher(1, 4, func(u tgbotapi.Update) {
+		if u.UpdateID == 1 {
+			panic("boom")
+		}
+		handled = append(handled, u.UpdateID)
+	})
+	d.Dispatch(chatUpdate(1, 7))
+	d.Dispatch(chatUpdate(2, 7))
+	d.Close()
+
+	if len(handled) != 1 || handled[0] != 2 {
+		t.Errorf("после паники обработка должна продолжиться, обработаны: %v", handled)
+	}
+}
+
+func TestDispatcher_ShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	d := NewDispatcher(1, 1, func(tgbotapi.Update) { <-release })
+	d.Dispatch(chatUpdate(1, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ожидалась ошибка DeadlineExceeded, получено: %v", err)
+	}
+}
@@ -1,9 +1,12 @@
 package telegram
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
@@ -29,8 +32,8 @@ func NewHandler(bot MessageSender, service service.GameServiceInterface) *Handle
 }
 
 // HandleJoin - /join
-func (h *Handler) HandleJoin(chatID int64, user *tgbotapi.User) {
-	err := h.Service.RegisterPlayer(user.ID, user.UserName, user.FirstName)
+func (h *Handler) HandleJoin(ctx context.Context, chatID int64, user *tgbotapi.User) {
+	err := h.Service.RegisterPlayer(ctx, chatID, user.ID, user.UserName, user.FirstName)
 	if err != nil {
 		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось зарегистрироваться 😅"))
 		return
@@ -38,10 +41,10 @@ func (h *Handler) HandleJoin(chatID int64, user *tgbotapi.User) {
 	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("%s присоединился к игре!", user.FirstName)))
 }
 
-// HandleRecordStart - начинает интерактивную запись результатов игры
-func (h *Handler) HandleRecordStart(msg *tgbotapi.Message) {
+// HandleRecordStart - начинает интерактивную запись результатов игры: сначала отмечается, кто играл
+func (h *Handler) HandleRecordStart(ctx context.Context, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	allPlayers, err := h.Service.GetAllPlayers()
+	allPlayers, err := h.Service.GetAllPlayers(ctx, chatID)
 	if err != nil {
 		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить список игроков 😅"))
 		return
@@ -52,35 +55,85 @@ func (h *Handler) HandleRecordStart(msg *tgbotapi.Message) {
 		return
 	}
 
-	keyboard := h.buildPlayersKeyboard(allPlayers, []storage.Player{})
-	reply := tgbotapi.NewMessage(chatID, "Кто занял 1-е место?")
-	reply.ReplyMarkup = keyboard
-
-	sentMsg, err := h.Bot.Send(reply)
+	// Сессия привязана к сообщению с клавиатурой, а его ID попадает в кнопки,
+	// поэтому сначала отправляем сообщение, а клавиатуру добавляем после создания сессии
+	sentMsg, err := h.Bot.Send(tgbotapi.NewMessage(chatID, "📝 Начинаю запись…"))
 	if err != nil {
 		log.Printf("Failed to send record start message: %v", err)
 		return
 	}
+	messageID := int64(sentMsg.MessageID)
 
 	// Создаем сессию в базе данных
-	err = h.Service.StartRecordingSession(chatID, int64(sentMsg.MessageID))
+	err = h.Service.StartRecordingSession(ctx, chatID, messageID, msg.From.ID)
 	if err != nil {
 		log.Printf("Failed to start recording session: %v", err)
-		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось начать сессию записи. Попробуйте еще раз."))
+		sendMessage(h.Bot, tgbotapi.NewEditMessageText(chatID, sentMsg.MessageID, "Не удалось начать сессию записи. Попробуйте еще раз."))
+		return
+	}
+
+	session := &storage.RecordingSession{ChatID: chatID, MessageID: messageID, OwnerTGID: msg.From.ID, LineupOpen: true}
+	h.renderLineup(ctx, session, nil)
+}
+
+// recordCallbackData возвращает данные кнопки сессии записи:
+// record_<действие>_<сообщение сессии>[_<игрок>[_<второй игрок>]].
+func recordCallbackData(action string, messageID int64, playerID ...int64) string {
+	data := fmt.Sprintf("record_%s_%d", action, messageID)
+	for _, id := range playerID {
+		data += fmt.Sprintf("_%d", id)
+	}
+	return data
+}
+
+// parseRecordCallback разбирает данные кнопки сессии записи, см. recordCallbackData.
+// playerID и otherID равны 0, если в кнопке нет соответствующего игрока.
+func parseRecordCallback(data string) (action string, messageID int64, playerID int64, otherID int64, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(data, "record_"), "_")
+	if len(parts) < 2 || len(parts) > 4 {
+		return "", 0, 0, 0, false
+	}
+	ids := []*int64{&messageID, &playerID, &otherID}
+	for i, part := range parts[1:] {
+		if _, err := fmt.Sscanf(part, "%d", ids[i]); err != nil {
+			return "", 0, 0, 0, false
+		}
+	}
+	return parts[0], messageID, playerID, otherID, true
+}
+
+// ExpireSessions удаляет брошенные сессии записи во всех чатах и убирает клавиатуру из их сообщений.
+func (h *Handler) ExpireSessions(ctx context.Context) {
+	sessions, err := h.Service.ExpireRecordingSessions(ctx)
+	if err != nil {
+		log.Printf("Failed to expire recording sessions: %v", err)
+		return
+	}
+	for _, session := range sessions {
+		sendMessage(h.Bot, tgbotapi.NewEditMessageText(session.ChatID, int(session.MessageID), "Сессия истекла."))
+	}
+	if len(sessions) > 0 {
+		log.Printf("Expired %d recording sessions", len(sessions))
 	}
 }
 
-// HandleRecordCallback обрабатывает нажатия кнопок во время записи игры
-func (h *Handler) HandleRecordCallback(callback *tgbotapi.CallbackQuery) {
+// HandleRecordCallback обрабатывает нажатия кнопок во время записи игры. В чате может идти
+// несколько записей сразу: сессия определяется по сообщению, указанному в данных кнопки.
+// Нажатия тех, кому правило записи не разрешает вести эту сессию, ничего не меняют.
+func (h *Handler) HandleRecordCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) {
 	chatID := callback.Message.Chat.ID
-	data := callback.Data
 
-	if _, err := h.Bot.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
-		log.Printf("Failed to send callback request: %v", err)
+	action, messageID, playerID, otherID, ok := parseRecordCallback(callback.Data)
+	if !ok {
+		// Кнопки клавиатур, отправленных до появления нескольких сессий в чате
+		answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сессия записи истекла, начните заново с /record."))
+		return
 	}
 
-	session, err := h.Service.GetRecordingSession(chatID)
+	session, err := h.Service.GetRecordingSession(ctx, chatID, messageID)
 	if err != nil {
+		answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
 		if errors.Is(err, service.ErrSessionNotFound) {
 			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сессия записи истекла, начните заново с /record."))
 		} else {
@@ -89,139 +142,1434 @@ func (h *Handler) HandleRecordCallback(callback *tgbotapi.CallbackQuery) {
 		return
 	}
 
-	switch data {
-	case "record_cancel":
-		h.handleRecordingCancel(callback)
-	case "record_finish":
-		h.handleRecordingFinish(callback)
-	default:
-		h.handlePlayerSelection(callback, session)
+	allowed, err := h.Service.CanControlRecording(ctx, session, callback.From.ID, func() bool {
+		return isChatAdmin(h.Bot, callback.Message.Chat, callback.From.ID)
+	})
+	if err != nil {
+		log.Printf("Failed to check access to session %d in chat %d: %v", messageID, chatID, err)
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Не удалось проверить доступ к записи 😅"))
+		return
+	}
+	if !allowed {
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Эту запись ведет другой игрок 🙅"))
+		return
+	}
+
+	// На выбор места отвечают сами обработчики: устаревшая кнопка получает всплывающую подсказку
+	switch action {
+	case "select":
+		h.handlePlayerSelection(ctx, callback, session, playerID, false)
+		return
+	case "tie":
+		h.handlePlayerSelection(ctx, callback, session, playerID, true)
+		return
+	case "dnf":
+		h.handlePlayerDNF(ctx, callback, session, playerID)
+		return
+	}
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+
+	switch action {
+	case "play":
+		h.handleLineupToggle(ctx, session, playerID)
+	case "next":
+		h.handleLineupConfirm(ctx, session)
+	case "lineup":
+		h.handleLineupReopen(ctx, session)
+	case "cancel":
+		h.handleRecordingCancel(ctx, session)
+	case "finish":
+		if session.EditGameID != 0 {
+			h.handleEditFinish(ctx, callback, session)
+		} else {
+			h.handleRecordingFinish(ctx, session)
+		}
+	case "remove":
+		h.handlePlayerRemoval(ctx, session, playerID)
+	case "back":
+		h.handleLastPlayerRemoval(ctx, session)
+	case "pick":
+		h.handleSwapPick(ctx, session, playerID)
+	case "swap":
+		h.handlePlayerSwap(ctx, session, playerID, otherID)
 	}
 }
 
 // handleRecordingCancel обрабатывает отмену записи.
-func (h *Handler) handleRecordingCancel(callback *tgbotapi.CallbackQuery) {
-	chatID := callback.Message.Chat.ID
-	if err := h.Service.CancelRecording(chatID); err != nil {
+func (h *Handler) handleRecordingCancel(ctx context.Context, session *storage.RecordingSession) {
+	if err := h.Service.CancelRecording(ctx, session.ChatID, session.MessageID); err != nil {
 		log.Printf("Failed to cancel recording: %v", err)
 	}
-	editMsg := tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, "Запись отменена.")
+	text := "Запись отменена."
+	if session.EditGameID != 0 {
+		text = fmt.Sprintf("Редактирование игры #%d отменено.", session.EditGameID)
+	}
+	editMsg := tgbotapi.NewEditMessageText(session.ChatID, int(session.MessageID), text)
 	sendMessage(h.Bot, editMsg)
 }
 
 // handleRecordingFinish обрабатывает завершение записи.
-func (h *Handler) handleRecordingFinish(callback *tgbotapi.CallbackQuery) {
-	chatID := callback.Message.Chat.ID
+func (h *Handler) handleRecordingFinish(ctx context.Context, session *storage.RecordingSession) {
+	chatID := session.ChatID
 
-	winners, err := h.Service.FinishRecording(chatID)
+	game, err := h.Service.FinishRecording(ctx, chatID, session.MessageID)
+	if errors.Is(err, service.ErrLineupIncomplete) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сначала расставьте по местам всех, кто играл."))
+		return
+	}
+	if text, ok := h.playerLimitText(ctx, chatID, err); ok {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		return
+	}
 	if err != nil {
 		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Ошибка при сохранении результатов. Попробуйте еще раз."))
 		log.Printf("RecordGame error: %v", err)
 		return
 	}
 
-	if len(winners) == 0 {
+	if game == nil {
 		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Вы не выбрали ни одного игрока."))
 		return
 	}
 
-	resultText := "🏆 Результаты игры сохранены:\n"
-	for i, p := range winners {
-		resultText += fmt.Sprintf("%d. %s\n", i+1, p.DisplayName)
+	resultText := fmt.Sprintf("🏆 Результаты игры #%d сохранены:\n", game.ID)
+	for _, group := range groupByPlace(game.Results, resultPlace) {
+		resultText += fmt.Sprintf("%s — %+d, Эло %s\n", resultGroupLine(group), group[0].Points, formatRatingChanges(group))
 	}
-	editMsg := tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, resultText)
+	undoKeyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ Отменить", fmt.Sprintf("undo_%d", game.ID)),
+	))
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, int(session.MessageID), resultText, undoKeyboard)
 	sendMessage(h.Bot, editMsg)
 }
 
-// handlePlayerSelection обрабатывает выбор игрока.
-func (h *Handler) handlePlayerSelection(callback *tgbotapi.CallbackQuery, session *storage.RecordingSession) {
-	chatID := callback.Message.Chat.ID
-	var selectedPlayerID int64
-	if _, err := fmt.Sscanf(callback.Data, "record_select_%d", &selectedPlayerID); err != nil {
-		return
+// formatRatingChanges возвращает рейтинги Эло игроков группы после игры с изменениями.
+func formatRatingChanges(group []storage.GameResult) string {
+	parts := make([]string, len(group))
+	for i, r := range group {
+		parts[i] = fmt.Sprintf("%.0f (%+.0f)", r.RatingAfter, r.RatingAfter-r.RatingBefore)
 	}
+	return strings.Join(parts, ", ")
+}
+
+// handlePlayerSelection обрабатывает выбор игрока. Если tied, игрок делит место с предыдущим (кнопка 🤝).
+func (h *Handler) handlePlayerSelection(ctx context.Context, callback *tgbotapi.CallbackQuery, session *storage.RecordingSession, selectedPlayerID int64, tied bool) {
+	chatID := session.ChatID
 
 	// Добавляем игрока и получаем обновленный список
-	sessionPlayers, err := h.Service.AddPlayerToRecording(chatID, selectedPlayerID)
+	sessionPlayers, err := h.Service.AddPlayerToRecording(ctx, chatID, session.MessageID, selectedPlayerID, tied)
+	if text, ok := placementAlertText(err); ok {
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, text))
+		return
+	}
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+	if text, ok := h.playerLimitText(ctx, chatID, err); ok {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to add player to recording: %v", err)
 		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Произошла ошибка при добавлении игрока."))
 		return
 	}
 
-	allPlayers, err := h.Service.GetAllPlayers()
+	h.renderSession(ctx, chatID, session, sessionPlayers)
+}
+
+// handlePlayerDNF отмечает игрока выбывшим (кнопка 🚪).
+func (h *Handler) handlePlayerDNF(ctx context.Context, callback *tgbotapi.CallbackQuery, session *storage.RecordingSession, playerID int64) {
+	chatID := session.ChatID
+
+	sessionPlayers, err := h.Service.AddDNFToRecording(ctx, chatID, session.MessageID, playerID)
+	if text, ok := placementAlertText(err); ok {
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, text))
+		return
+	}
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+	if text, ok := h.playerLimitText(ctx, chatID, err); ok {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to mark player as DNF: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Произошла ошибка при добавлении игрока."))
+		return
+	}
+
+	h.renderSession(ctx, chatID, session, sessionPlayers)
+}
+
+// placementAlertText возвращает подсказку для устаревшей кнопки выбора места: состав игры
+// еще набирается, игрока в нем уже нет или место ему уже выбрано. Если err не об этом, возвращает false.
+func placementAlertText(err error) (string, bool) {
+	switch {
+	case errors.Is(err, service.ErrLineupOpen):
+		return "Сначала отметьте, кто играл, и нажмите «➡️ Далее».", true
+	case errors.Is(err, service.ErrNotInLineup):
+		return "Этого игрока нет в составе игры. Чтобы изменить состав, нажмите «⬅️ Состав».", true
+	case errors.Is(err, service.ErrAlreadyPlaced):
+		return "Этому игроку место уже выбрано. Чтобы его поменять, нажмите на игрока (↕️).", true
+	}
+	return "", false
+}
+
+// handlePlayerRemoval убирает игрока из сессии (кнопка ✖️ при редактировании игры и у выбывших).
+func (h *Handler) handlePlayerRemoval(ctx context.Context, session *storage.RecordingSession, removedPlayerID int64) {
+	chatID := session.ChatID
+
+	sessionPlayers, err := h.Service.RemovePlayerFromRecording(ctx, chatID, session.MessageID, removedPlayerID)
+	if err != nil {
+		log.Printf("Failed to remove player from recording: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Произошла ошибка при удалении игрока."))
+		return
+	}
+
+	h.renderSession(ctx, chatID, session, sessionPlayers)
+}
+
+// handleLastPlayerRemoval убирает последнего выбранного игрока (кнопка ⬅️ Назад).
+func (h *Handler) handleLastPlayerRemoval(ctx context.Context, session *storage.RecordingSession) {
+	chatID := session.ChatID
+
+	sessionPlayers, err := h.Service.RemoveLastPlayerFromRecording(ctx, chatID, session.MessageID)
+	if err != nil {
+		log.Printf("Failed to remove last player from recording: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Произошла ошибка при удалении игрока."))
+		return
+	}
+
+	h.renderSession(ctx, chatID, session, sessionPlayers)
+}
+
+// handleSwapPick показывает, с кем можно поменять местами уже выбранного игрока.
+// Без игрока возвращает обычную клавиатуру записи.
+func (h *Handler) handleSwapPick(ctx context.Context, session *storage.RecordingSession, pickedPlayerID int64) {
+	chatID := session.ChatID
+
+	sessionPlayers, err := h.Service.GetRecordingPlayers(ctx, chatID, session.MessageID)
+	if err != nil {
+		log.Printf("Failed to get recording players: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось обновить список игроков. 😥"))
+		return
+	}
+
+	i := slices.IndexFunc(sessionPlayers, func(p storage.SessionPlayer) bool { return p.Player.TGID == pickedPlayerID })
+	if i < 0 {
+		h.renderSession(ctx, chatID, session, sessionPlayers)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for j, p := range sessionPlayers {
+		if j != i && !p.DNF {
+			button := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⇄ %d. %s", p.Place, p.Player.DisplayName), recordCallbackData("swap", session.MessageID, pickedPlayerID, p.Player.TGID))
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+		}
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ Не менять", recordCallbackData("pick", session.MessageID)),
+	))
+
+	text := formatSessionOrder(sessionPlayers) + fmt.Sprintf("С кем поменять местами %s?", sessionPlayers[i].Player.DisplayName)
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, int(session.MessageID), text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+	sendMessage(h.Bot, editMsg)
+}
+
+// handlePlayerSwap меняет местами двух выбранных игроков.
+func (h *Handler) handlePlayerSwap(ctx context.Context, session *storage.RecordingSession, firstPlayerID, secondPlayerID int64) {
+	chatID := session.ChatID
+
+	sessionPlayers, err := h.Service.SwapRecordingPlayers(ctx, chatID, session.MessageID, firstPlayerID, secondPlayerID)
+	if err != nil {
+		log.Printf("Failed to swap recording players: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось поменять игроков местами."))
+		return
+	}
+
+	h.renderSession(ctx, chatID, session, sessionPlayers)
+}
+
+// lineupConfirmedText - ответ на кнопку набора состава, когда состав уже подтвержден.
+const lineupConfirmedText = "Состав уже подтвержден. Чтобы изменить его, нажмите «⬅️ Состав»."
+
+// handleLineupToggle отмечает игрока участником игры или снимает отметку.
+func (h *Handler) handleLineupToggle(ctx context.Context, session *storage.RecordingSession, playerID int64) {
+	chatID := session.ChatID
+
+	lineup, err := h.Service.ToggleLineupPlayer(ctx, chatID, session.MessageID, playerID)
+	if errors.Is(err, service.ErrLineupLocked) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, lineupConfirmedText))
+		return
+	}
+	if text, ok := h.playerLimitText(ctx, chatID, err); ok {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to toggle lineup player: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Произошла ошибка при выборе игрока."))
+		return
+	}
+
+	h.renderLineup(ctx, session, lineup)
+}
+
+// handleLineupConfirm закрывает состав игры и переходит к выбору мест (кнопка ➡️ Далее).
+func (h *Handler) handleLineupConfirm(ctx context.Context, session *storage.RecordingSession) {
+	chatID := session.ChatID
+
+	_, err := h.Service.ConfirmLineup(ctx, chatID, session.MessageID)
+	if errors.Is(err, service.ErrLineupLocked) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, lineupConfirmedText))
+		return
+	}
+	if text, ok := h.playerLimitText(ctx, chatID, err); ok {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to confirm lineup: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось сохранить состав игры. Попробуйте еще раз."))
+		return
+	}
+
+	session.LineupOpen = false
+	h.renderSession(ctx, chatID, session, nil)
+}
+
+// handleLineupReopen возвращает к выбору состава игры (кнопка ⬅️ Состав).
+func (h *Handler) handleLineupReopen(ctx context.Context, session *storage.RecordingSession) {
+	chatID := session.ChatID
+
+	lineup, err := h.Service.ReopenLineup(ctx, chatID, session.MessageID)
+	if errors.Is(err, service.ErrLineupLocked) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Состав нельзя менять, когда места уже выбраны. Сначала уберите игроков кнопкой ⬅️ Назад."))
+		return
+	}
+	if errors.Is(err, service.ErrNotRecording) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "При редактировании игры состава нет: уберите игрока кнопкой ✖️ или выберите, кого добавить."))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reopen lineup: %v", err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось вернуться к составу игры."))
+		return
+	}
+
+	session.LineupOpen = true
+	h.renderLineup(ctx, session, lineup)
+}
+
+// renderLineup обновляет сообщение сессии записи, пока набирается состав игры.
+func (h *Handler) renderLineup(ctx context.Context, session *storage.RecordingSession, lineup []storage.Player) {
+	chatID := session.ChatID
+	allPlayers, err := h.Service.GetAllPlayers(ctx, chatID)
+	if err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось обновить список игроков. 😥"))
+		return
+	}
+	cfg, err := h.Service.GetGameConfig(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get game config for chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить настройки игры 😅"))
+		return
+	}
+
+	text := fmt.Sprintf("Кто играл? Отметьте от %d до %d игроков и нажмите «➡️ Далее».", cfg.MinPlayers, cfg.MaxPlayers)
+	if len(lineup) > 0 {
+		text += fmt.Sprintf("\nОтмечено: %d", len(lineup))
+	}
+	keyboard := h.buildLineupKeyboard(session.MessageID, allPlayers, lineup, cfg)
+	sendMessage(h.Bot, tgbotapi.NewEditMessageTextAndMarkup(chatID, int(session.MessageID), text, keyboard))
+}
+
+// playerLimitText возвращает сообщение о нарушении ограничений на число игроков в игре.
+// Если err не об этом, возвращает false.
+func (h *Handler) playerLimitText(ctx context.Context, chatID int64, err error) (string, bool) {
+	if !errors.Is(err, service.ErrTooFewPlayers) && !errors.Is(err, service.ErrTooManyPlayers) {
+		return "", false
+	}
+	cfg, cfgErr := h.Service.GetGameConfig(ctx, chatID)
+	if cfgErr != nil {
+		log.Printf("Failed to get game config for chat %d: %v", chatID, cfgErr)
+		return "Число игроков не подходит под настройки игры чата: /gameconfig", true
+	}
+	return fmt.Sprintf("В игре должно быть от %d до %d игроков.", cfg.MinPlayers, cfg.MaxPlayers), true
+}
+
+// renderSession обновляет сообщение сессии записи: порядок игроков и клавиатуру.
+// Места выбираются среди объявленного состава игры, а без него (при редактировании) - среди всех игроков чата.
+func (h *Handler) renderSession(ctx context.Context, chatID int64, session *storage.RecordingSession, sessionPlayers []storage.SessionPlayer) {
+	editing := session.EditGameID != 0
+	var candidates []storage.Player
+	var err error
+	if !editing {
+		candidates, err = h.Service.GetRecordingLineup(ctx, chatID, session.MessageID)
+	}
+	lineup := len(candidates) > 0
+	if err == nil && !lineup {
+		candidates, err = h.Service.GetAllPlayers(ctx, chatID)
+	}
 	if err != nil {
 		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось обновить список игроков. 😥"))
 		return
 	}
-	newKeyboard := h.buildPlayersKeyboard(allPlayers, sessionPlayers)
+	newKeyboard := h.buildPlayersKeyboard(session.MessageID, candidates, sessionPlayers, editing, lineup)
 
-	winnerText := "Порядок победителей:\n"
-	for i, p := range sessionPlayers {
-		winnerText += fmt.Sprintf("%d. %s\n", i+1, p.DisplayName)
+	var winnerText string
+	if editing {
+		winnerText = fmt.Sprintf("✏️ Редактирование игры #%d\nНажмите ✖️, чтобы убрать игрока, или выберите, кого добавить следующим.\n\n", session.EditGameID)
+	}
+	winnerText += formatSessionOrder(sessionPlayers)
+	finished := countFinished(sessionPlayers)
+	if lineup && len(sessionPlayers) == len(candidates) {
+		winnerText += "Все места расставлены. Нажмите «✅ Завершить», чтобы сохранить игру."
+	} else {
+		winnerText += fmt.Sprintf("Кто занял %d-е место?", finished+1)
+		if finished > 0 {
+			winnerText += "\n🤝 — разделить место с предыдущим"
+		}
+		winnerText += "\n🚪 — выбыл, не доиграв"
 	}
-	winnerText += fmt.Sprintf("\nКто занял %d-е место?", len(sessionPlayers)+1)
 
 	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, int(session.MessageID), winnerText, newKeyboard)
 	sendMessage(h.Bot, editMsg)
 }
 
-// buildPlayersKeyboard создает клавиатуру с игроками, исключая уже выбранных.
-func (h *Handler) buildPlayersKeyboard(all, selected []storage.Player) tgbotapi.InlineKeyboardMarkup {
-	var rows [][]tgbotapi.InlineKeyboardButton
+// HandleEditGame - /editgame <id> открывает редактирование мест игры, /editgame <id> history показывает ее версии
+func (h *Handler) HandleEditGame(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	args := strings.Fields(msg.CommandArguments())
+	var gameID int
+	if len(args) == 0 {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Использование: /editgame <номер игры> [history]"))
+		return
+	}
+	if _, err := fmt.Sscanf(strings.TrimPrefix(args[0], "#"), "%d", &gameID); err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Использование: /editgame <номер игры> [history]"))
+		return
+	}
 
-	selectedIDs := make(map[int64]bool)
-	for _, p := range selected {
-		selectedIDs[p.TGID] = true
+	if len(args) > 1 && args[1] == "history" {
+		h.handleGameVersions(ctx, chatID, gameID)
+		return
 	}
 
-	for _, p := range all {
-		if !selectedIDs[p.TGID] {
-			button := tgbotapi.NewInlineKeyboardButtonData(p.DisplayName, fmt.Sprintf("record_select_%d", p.TGID))
-			rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+	if !isChatAdmin(h.Bot, msg.Chat, msg.From.ID) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Редактировать игры могут только администраторы чата."))
+		return
+	}
+
+	sentMsg, err := h.Bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✏️ Открываю игру #%d…", gameID)))
+	if err != nil {
+		log.Printf("Failed to send edit game message: %v", err)
+		return
+	}
+
+	session := &storage.RecordingSession{ChatID: chatID, MessageID: int64(sentMsg.MessageID), EditGameID: gameID}
+	game, err := h.Service.StartGameEdit(ctx, chatID, gameID, session.MessageID, msg.From.ID)
+	if err != nil {
+		text := "Не удалось открыть игру для редактирования 😅"
+		switch {
+		case errors.Is(err, service.ErrGameNotFound):
+			text = fmt.Sprintf("Игра #%d не найдена.", gameID)
+		case errors.Is(err, service.ErrGameArchived):
+			text = "Игра относится к завершенному сезону, изменить ее нельзя."
+		default:
+			log.Printf("Failed to start edit of game %d in chat %d: %v", gameID, chatID, err)
 		}
+		sendMessage(h.Bot, tgbotapi.NewEditMessageText(chatID, sentMsg.MessageID, text))
+		return
 	}
 
-	var controlButtons []tgbotapi.InlineKeyboardButton
-	if len(selected) > 0 {
-		finishButton := tgbotapi.NewInlineKeyboardButtonData("✅ Завершить", "record_finish")
-		controlButtons = append(controlButtons, finishButton)
+	h.renderSession(ctx, chatID, session, service.EditSessionPlayers(game.Results))
+}
+
+// handleEditFinish сохраняет отредактированные места игры. Сохранить может только администратор.
+func (h *Handler) handleEditFinish(ctx context.Context, callback *tgbotapi.CallbackQuery, session *storage.RecordingSession) {
+	chatID := session.ChatID
+	if !isChatAdmin(h.Bot, callback.Message.Chat, callback.From.ID) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сохранить изменения может только администратор чата."))
+		return
 	}
-	cancelButton := tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel")
-	controlButtons = append(controlButtons, cancelButton)
 
-	rows = append(rows, controlButtons)
+	game, err := h.Service.FinishGameEdit(ctx, chatID, session.MessageID, callback.From.ID)
+	if errors.Is(err, service.ErrNoPlayers) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "В игре должен остаться хотя бы один игрок. Чтобы удалить игру целиком, используйте /undo."))
+		return
+	}
+	if text, ok := h.playerLimitText(ctx, chatID, err); ok {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		return
+	}
+	if err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Ошибка при сохранении изменений. Попробуйте еще раз."))
+		log.Printf("FinishGameEdit error: %v", err)
+		return
+	}
 
-	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+	text := fmt.Sprintf("✏️ Игра #%d обновлена:\n", game.ID)
+	text += formatGameResults(game)
+	text += fmt.Sprintf("\nПредыдущие версии: /editgame %d history", game.ID)
+	sendMessage(h.Bot, tgbotapi.NewEditMessageText(chatID, int(session.MessageID), text))
+	log.Printf("[Edit] game %d in chat %d edited by %s", game.ID, chatID, callback.From.UserName)
 }
 
-// HandleLeaderboard - Обработка команды /leaderboard
-func (h *Handler) HandleLeaderboard(chatID int64) {
-	leaderboard, err := h.Service.GetLeaderboard()
+// handleGameVersions показывает текущие и предыдущие места игры.
+func (h *Handler) handleGameVersions(ctx context.Context, chatID int64, gameID int) {
+	game, versions, err := h.Service.GetGameVersions(ctx, chatID, gameID)
+	if errors.Is(err, service.ErrGameNotFound) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("Игра #%d не найдена.", gameID)))
+		return
+	}
 	if err != nil {
-		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить рейтинг 😅"))
+		log.Printf("Failed to get versions of game %d in chat %d: %v", gameID, chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить историю игры 😅"))
+		return
+	}
+
+	text := fmt.Sprintf("🕓 Игра #%d от %s\n\nТекущие места:\n", game.ID, game.CreatedAt.Format("02.01.2006 15:04"))
+	text += formatGameResults(game)
+	if len(versions) == 0 {
+		text += "\nИгру не редактировали."
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		text += fmt.Sprintf("\nВерсия %d (заменил %s %s):\n", v.Version, v.EditedBy.DisplayName, v.EditedAt.Format("02.01.2006 15:04"))
+		text += formatGameResults(&storage.Game{Results: v.Results})
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+}
+
+// HandleUndo - /undo, отмена последней записанной игры (только для администраторов)
+func (h *Handler) HandleUndo(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	if !isChatAdmin(h.Bot, msg.Chat, msg.From.ID) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Отменять игры могут только администраторы чата."))
 		return
 	}
 
-	text := "🏆 Рейтинг игроков:\n"
-	for i, p := range leaderboard {
-		word := Pluralize(p.Score, [3]string{"очко", "очка", "очков"})
-		text += fmt.Sprintf("%d. %s — %d %s\n", i+1, p.DisplayName, p.Score, word)
+	game, err := h.Service.UndoLastGame(ctx, chatID, msg.From.ID)
+	if err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, undoErrorText(err)))
+		if !isUndoRejection(err) {
+			log.Printf("Failed to undo last game in chat %d: %v", chatID, err)
+		}
+		return
 	}
 
+	text := fmt.Sprintf("↩️ Игра #%d от %s отменена, очки списаны:\n", game.ID, game.CreatedAt.Format("02.01.2006 15:04"))
+	text += formatGameResults(game)
 	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+	log.Printf("[Undo] game %d in chat %d undone by %s", game.ID, chatID, msg.From.UserName)
 }
 
-// HandleMyScore - узнать индивидуальные очки
-func (h *Handler) HandleMyScore(chatID int64, user *tgbotapi.User) {
-	score, err := h.Service.GetPlayerScore(user.ID)
+// HandleUndoCallback обрабатывает кнопку "↩️ Отменить" под результатами игры.
+func (h *Handler) HandleUndoCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	var gameID int
+	if _, err := fmt.Sscanf(callback.Data, "undo_%d", &gameID); err != nil {
+		answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
+	allowed, err := h.Service.CanUndoGame(ctx, chatID, gameID, callback.From.ID, func() bool {
+		return isChatAdmin(h.Bot, callback.Message.Chat, callback.From.ID)
+	})
 	if err != nil {
-		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить очки 😅"))
-		log.Printf("[Score] failed for %s: %v", user.UserName, err)
+		log.Printf("Failed to check access to game %d in chat %d: %v", gameID, chatID, err)
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Не удалось проверить доступ к игре 😅"))
 		return
 	}
-	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("%s, у тебя %d очков", user.FirstName, score)))
-	log.Printf("[Score] %s has %d points", user.UserName, score)
+	if !allowed {
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Отменить игру может только тот, кто ее записал, или администратор чата 🙅"))
+		return
+	}
+
+	game, err := h.Service.UndoGame(ctx, chatID, gameID, callback.From.ID)
+	if err != nil {
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, undoErrorText(err)))
+		if isUndoRejection(err) {
+			// Отменить эту игру кнопкой уже нельзя, убираем кнопку
+			removeKeyboard := tgbotapi.NewEditMessageReplyMarkup(chatID, callback.Message.MessageID,
+				tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+			sendMessage(h.Bot, removeKeyboard)
+		} else {
+			log.Printf("Failed to undo game %d in chat %d: %v", gameID, chatID, err)
+		}
+		return
+	}
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, "Игра отменена"))
+
+	text := fmt.Sprintf("↩️ Игра #%d отменена (%s), очки списаны:\n", game.ID, callback.From.FirstName)
+	text += formatGameResults(game)
+	sendMessage(h.Bot, tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, text))
+	log.Printf("[Undo] game %d in chat %d undone by %s", game.ID, chatID, callback.From.UserName)
+}
+
+// isUndoRejection сообщает, что отмена отклонена по правилам, а не из-за сбоя.
+func isUndoRejection(err error) bool {
+	return errors.Is(err, service.ErrGameNotFound) || errors.Is(err, service.ErrNotLastGame) ||
+		errors.Is(err, service.ErrUndoExpired) || errors.Is(err, service.ErrGameArchived)
+}
+
+func undoErrorText(err error) string {
+	switch {
+	case errors.Is(err, service.ErrGameNotFound):
+		return "Нет записанных игр."
+	case errors.Is(err, service.ErrNotLastGame):
+		return "Отменить можно только последнюю записанную игру."
+	case errors.Is(err, service.ErrUndoExpired):
+		return "Время на отмену истекло. Администратор может отменить игру командой /undo."
+	case errors.Is(err, service.ErrGameArchived):
+		return "Игра относится к завершенному сезону, отменить ее нельзя."
+	default:
+		return "Не удалось отменить игру 😅"
+	}
+}
+
+// gamesPageSize - сколько игр показывается на одной странице /games.
+const gamesPageSize = 5
+
+// HandleGames - /games, список последних игр чата с постраничной навигацией
+func (h *Handler) HandleGames(ctx context.Context, chatID int64) {
+	text, keyboard, err := h.gamesPage(ctx, chatID, 0)
+	if err != nil {
+		log.Printf("Failed to list games in chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить список игр 😅"))
+		return
+	}
+	reply := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		reply.ReplyMarkup = *keyboard
+	}
+	sendMessage(h.Bot, reply)
+}
+
+// HandleGamesCallback листает список игр кнопками ◀️ ▶️, редактируя сообщение.
+func (h *Handler) HandleGamesCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+
+	var offset int
+	if _, err := fmt.Sscanf(callback.Data, "games_page_%d", &offset); err != nil {
+		return
+	}
+
+	text, keyboard, err := h.gamesPage(ctx, chatID, offset)
+	if err != nil {
+		log.Printf("Failed to list games in chat %d: %v", chatID, err)
+		return
+	}
+	if keyboard == nil {
+		sendMessage(h.Bot, tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, text))
+		return
+	}
+	sendMessage(h.Bot, tgbotapi.NewEditMessageTextAndMarkup(chatID, callback.Message.MessageID, text, *keyboard))
+}
+
+// gamesPage формирует текст страницы списка игр и кнопки навигации (nil, если листать некуда).
+func (h *Handler) gamesPage(ctx context.Context, chatID int64, offset int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	games, total, err := h.Service.ListGames(ctx, chatID, offset, gamesPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		return "Пока не сыграно ни одной игры. Записать: /record", nil, nil
+	}
+	if len(games) == 0 {
+		// Страница за пределами списка (например, игры удалили) - показываем первую
+		if offset > 0 {
+			return h.gamesPage(ctx, chatID, 0)
+		}
+		return "Пока не сыграно ни одной игры. Записать: /record", nil, nil
+	}
+
+	text := fmt.Sprintf("📜 Игры %d–%d из %d:\n", offset+1, offset+len(games), total)
+	for _, g := range games {
+		text += fmt.Sprintf("\n#%d · %s\n", g.ID, g.CreatedAt.Format("02.01.2006 15:04"))
+		var parts []string
+		for _, group := range groupByPlace(g.Results, resultPlace) {
+			parts = append(parts, fmt.Sprintf("%s %+d", resultGroupLine(group), group[0].Points))
+		}
+		text += strings.Join(parts, " · ") + "\n"
+	}
+	text += "\nПодробнее об игре: /game <номер>"
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if offset > 0 {
+		prev := max(offset-gamesPageSize, 0)
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("games_page_%d", prev)))
+	}
+	if offset+len(games) < total {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("games_page_%d", offset+len(games))))
+	}
+	if len(buttons) == 0 {
+		return text, nil, nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
+	return text, &keyboard, nil
+}
+
+// HandleGame - /game <id>, подробности об игре
+func (h *Handler) HandleGame(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	var gameID int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(strings.TrimSpace(msg.CommandArguments()), "#"), "%d", &gameID); err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Использование: /game <номер игры>. Список игр: /games"))
+		return
+	}
+
+	game, versions, err := h.Service.GetGameVersions(ctx, chatID, gameID)
+	if errors.Is(err, service.ErrGameNotFound) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("Игра #%d не найдена.", gameID)))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get game %d in chat %d: %v", gameID, chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить игру 😅"))
+		return
+	}
+
+	text := fmt.Sprintf("🎲 Игра #%d\n📅 %s\n", game.ID, game.CreatedAt.Format("02.01.2006 15:04"))
+	if strategy, err := service.ParseScoring(game.Scoring); err == nil {
+		text += fmt.Sprintf("🧮 Подсчёт очков: %s\n", strategy.Title())
+	}
+	text += "\n"
+	for _, group := range groupByPlace(game.Results, resultPlace) {
+		points := group[0].Points
+		word := Pluralize(points, [3]string{"очко", "очка", "очков"})
+		text += fmt.Sprintf("%s — %+d %s", resultGroupLine(group), points, word)
+		if group[0].RatingAfter != 0 {
+			text += ", Эло " + formatRatingChanges(group)
+		}
+		text += "\n"
+	}
+	if len(versions) > 0 {
+		text += fmt.Sprintf("\n✏️ Игру редактировали (%d). Прежние места: /editgame %d history", len(versions), game.ID)
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+}
+
+// formatGameResults форматирует места и очки игры.
+func formatGameResults(game *storage.Game) string {
+	var text string
+	for _, group := range groupByPlace(game.Results, resultPlace) {
+		text += fmt.Sprintf("%s — %+d\n", resultGroupLine(group), group[0].Points)
+	}
+	return text
+}
+
+// formatSessionOrder возвращает уже выбранный порядок игроков сессии или пустую строку.
+func formatSessionOrder(sessionPlayers []storage.SessionPlayer) string {
+	if len(sessionPlayers) == 0 {
+		return ""
+	}
+	text := "Порядок победителей:\n"
+	for _, group := range groupByPlace(sessionPlayers, sessionPlace) {
+		names := make([]string, len(group))
+		for i, p := range group {
+			names[i] = p.Player.DisplayName
+		}
+		if group[0].DNF {
+			text += "🚪 " + strings.Join(names, ", ") + "\n"
+			continue
+		}
+		text += placeLine(group[0].Place, names) + "\n"
+	}
+	return text + "\n"
+}
+
+// buildLineupKeyboard создает клавиатуру выбора состава игры: отмеченные игроки помечены ✅.
+// Кнопка ➡️ Далее появляется, когда отмечено достаточно игроков.
+func (h *Handler) buildLineupKeyboard(messageID int64, all []storage.Player, lineup []storage.Player, cfg storage.GameConfig) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, p := range all {
+		text := p.DisplayName
+		if slices.ContainsFunc(lineup, func(l storage.Player) bool { return l.TGID == p.TGID }) {
+			text = "✅ " + text
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(text, recordCallbackData("play", messageID, p.TGID))))
+	}
+
+	var controlButtons []tgbotapi.InlineKeyboardButton
+	if len(lineup) >= cfg.MinPlayers {
+		controlButtons = append(controlButtons, tgbotapi.NewInlineKeyboardButtonData("➡️ Далее", recordCallbackData("next", messageID)))
+	}
+	controlButtons = append(controlButtons, tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", recordCallbackData("cancel", messageID)))
+	rows = append(rows, controlButtons)
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// buildPlayersKeyboard создает клавиатуру с игроками, исключая уже выбранных.
+// Выбранных игроков можно нажать ↕️, чтобы поменять местами, а при редактировании игры - убрать кнопкой ✖️.
+// Кнопка 🤝 рядом с игроком ставит его на то же место, что и предыдущего, а 🚪 отмечает выбывшим.
+// Выбывших можно вернуть кнопкой ✖️ в любой момент. Если all - объявленный состав игры (lineup),
+// завершить запись можно, только когда места есть у всех, а пока мест нет, можно вернуться к составу.
+func (h *Handler) buildPlayersKeyboard(messageID int64, all []storage.Player, selected []storage.SessionPlayer, editing bool, lineup bool) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	finished := countFinished(selected)
+	selectedIDs := make(map[int64]bool)
+	for _, sp := range selected {
+		p := sp.Player
+		selectedIDs[p.TGID] = true
+		if sp.DNF {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✖️ 🚪 "+p.DisplayName, recordCallbackData("remove", messageID, p.TGID)),
+			))
+			continue
+		}
+		var row []tgbotapi.InlineKeyboardButton
+		if finished > 1 {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("↕️ %d. %s", sp.Place, p.DisplayName), recordCallbackData("pick", messageID, p.TGID)))
+		}
+		if editing {
+			removeText := "✖️"
+			if len(row) == 0 {
+				removeText = fmt.Sprintf("✖️ %d. %s", sp.Place, p.DisplayName)
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(removeText, recordCallbackData("remove", messageID, p.TGID)))
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+
+	unplaced := 0
+	for _, p := range all {
+		if !selectedIDs[p.TGID] {
+			unplaced++
+			row := tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(p.DisplayName, recordCallbackData("select", messageID, p.TGID)))
+			if finished > 0 {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData("🤝", recordCallbackData("tie", messageID, p.TGID)))
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData("🚪", recordCallbackData("dnf", messageID, p.TGID)))
+			rows = append(rows, row)
+		}
+	}
+
+	var controlButtons []tgbotapi.InlineKeyboardButton
+	if lineup && len(selected) == 0 {
+		controlButtons = append(controlButtons, tgbotapi.NewInlineKeyboardButtonData("⬅️ Состав", recordCallbackData("lineup", messageID)))
+	}
+	if finished > 0 {
+		controlButtons = append(controlButtons, tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", recordCallbackData("back", messageID)))
+	}
+	if finished > 0 && (!lineup || unplaced == 0) {
+		finishText := "✅ Завершить"
+		if editing {
+			finishText = "✅ Сохранить"
+		}
+		finishButton := tgbotapi.NewInlineKeyboardButtonData(finishText, recordCallbackData("finish", messageID))
+		controlButtons = append(controlButtons, finishButton)
+	}
+	cancelButton := tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", recordCallbackData("cancel", messageID))
+	controlButtons = append(controlButtons, cancelButton)
+
+	rows = append(rows, controlButtons)
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// HandleLeaderboard - Обработка команды /leaderboard (по очкам или по рейтингу Эло)
+func (h *Handler) HandleLeaderboard(ctx context.Context, chatID int64, order service.LeaderboardOrder) {
+	leaderboard, err := h.Service.GetLeaderboard(ctx, chatID, order)
+	if err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить рейтинг 😅"))
+		return
+	}
+
+	var text string
+	var switchButton tgbotapi.InlineKeyboardButton
+	if order == service.ByRating {
+		text = "📈 Рейтинг Эло:\n"
+		for i, p := range leaderboard {
+			text += fmt.Sprintf("%d. %s — %.0f\n", i+1, p.DisplayName, p.Rating)
+		}
+		switchButton = tgbotapi.NewInlineKeyboardButtonData("По очкам", "leaderboard")
+	} else {
+		text = "🏆 Рейтинг игроков:\n"
+		for i, p := range leaderboard {
+			word := Pluralize(p.Score, [3]string{"очко", "очка", "очков"})
+			text += fmt.Sprintf("%d. %s — %d %s\n", i+1, p.DisplayName, p.Score, word)
+		}
+		switchButton = tgbotapi.NewInlineKeyboardButtonData("По рейтингу Эло", "leaderboard_rating")
+	}
+
+	reply := tgbotapi.NewMessage(chatID, text)
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(switchButton))
+	sendMessage(h.Bot, reply)
+}
+
+// HandleRating - /rating, рейтинг Эло игрока и его последние изменения
+func (h *Handler) HandleRating(ctx context.Context, chatID int64, user *tgbotapi.User) {
+	player, err := h.Service.GetPlayerByTGID(ctx, chatID, user.ID)
+	if err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить рейтинг 😅 Вы точно присоединились через /join?"))
+		log.Printf("[Rating] failed for %s: %v", user.UserName, err)
+		return
+	}
+
+	history, err := h.Service.GetRatingHistory(ctx, chatID, user.ID, 5)
+	if err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить рейтинг 😅"))
+		log.Printf("[Rating] history failed for %s: %v", user.UserName, err)
+		return
+	}
+
+	text := fmt.Sprintf("📈 %s, твой рейтинг Эло: %.0f\n", user.FirstName, player.Rating)
+	if len(history) > 0 {
+		text += "\nПоследние игры:\n"
+		for _, c := range history {
+			text += fmt.Sprintf("Игра #%d: %.0f → %.0f (%+.0f)\n", c.GameID, c.Before, c.After, c.After-c.Before)
+		}
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+}
+
+// HandleMyScore - узнать индивидуальные очки
+func (h *Handler) HandleMyScore(ctx context.Context, chatID int64, user *tgbotapi.User) {
+	score, err := h.Service.GetPlayerScore(ctx, chatID, user.ID)
+	if err != nil {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить очки 😅"))
+		log.Printf("[Score] failed for %s: %v", user.UserName, err)
+		return
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("%s, у тебя %d очков", user.FirstName, score)))
+	log.Printf("[Score] %s has %d points", user.UserName, score)
+}
+
+// HandleStats - /stats [@user], статистика игрока. Без аргумента - своя,
+// можно указать @username или ответить командой на сообщение игрока.
+func (h *Handler) HandleStats(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	tgID := msg.From.ID
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && !msg.ReplyToMessage.From.IsBot {
+		tgID = msg.ReplyToMessage.From.ID
+	}
+
+	if args := strings.Fields(msg.CommandArguments()); len(args) > 0 {
+		ids, ok := h.resolveUsernames(ctx, chatID, args[:1])
+		if !ok {
+			return
+		}
+		tgID = ids[0]
+	}
+
+	stats, err := h.Service.GetPlayerStats(ctx, chatID, tgID)
+	if err != nil {
+		log.Printf("[Stats] failed for %d in chat %d: %v", tgID, chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить статистику 😅 Игрок точно присоединился через /join?"))
+		return
+	}
+
+	reply := tgbotapi.NewMessage(chatID, formatStats(stats))
+	if len(stats.Opponents) > 0 {
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, o := range stats.Opponents {
+			data := fmt.Sprintf("vs_%d_%d", stats.Player.TGID, o.Player.TGID)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⚔️ vs "+o.Player.DisplayName, data)))
+		}
+		reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	sendMessage(h.Bot, reply)
+}
+
+// resolveUsernames находит игроков чата по @username. Если кого-то нет,
+// отправляет сообщение об этом и возвращает false.
+func (h *Handler) resolveUsernames(ctx context.Context, chatID int64, usernames []string) ([]int64, bool) {
+	players, err := h.Service.GetAllPlayers(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get players in chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить список игроков 😅"))
+		return nil, false
+	}
+
+	ids := make([]int64, 0, len(usernames))
+	for _, name := range usernames {
+		name = strings.TrimPrefix(name, "@")
+		var id int64
+		for _, p := range players {
+			if strings.EqualFold(p.Username, name) {
+				id = p.TGID
+				break
+			}
+		}
+		if id == 0 {
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("Игрок @%s не найден в этом чате.", name)))
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// HandleVs - /vs @a @b, сравнение двух игроков. С одним аргументом сравнивает автора команды с указанным игроком.
+func (h *Handler) HandleVs(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Использование: /vs @игрок1 @игрок2 или /vs @игрок"))
+		return
+	}
+
+	ids, ok := h.resolveUsernames(ctx, chatID, args)
+	if !ok {
+		return
+	}
+	if len(ids) == 1 {
+		ids = []int64{msg.From.ID, ids[0]}
+	}
+	h.sendHeadToHead(ctx, chatID, ids[0], ids[1])
+}
+
+// HandleVsCallback - кнопка "⚔️ vs" из профиля /stats
+func (h *Handler) HandleVsCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) {
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+
+	var a, b int64
+	if _, err := fmt.Sscanf(callback.Data, "vs_%d_%d", &a, &b); err != nil {
+		return
+	}
+	h.sendHeadToHead(ctx, callback.Message.Chat.ID, a, b)
+}
+
+// sendHeadToHead отправляет сравнение игроков a и b.
+func (h *Handler) sendHeadToHead(ctx context.Context, chatID int64, a, b int64) {
+	if a == b {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сравнивать игрока с самим собой неинтересно 🙃"))
+		return
+	}
+
+	h2h, err := h.Service.GetHeadToHead(ctx, chatID, a, b)
+	if err != nil {
+		log.Printf("[Vs] failed for %d vs %d in chat %d: %v", a, b, chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось сравнить игроков 😅 Оба точно присоединились через /join?"))
+		return
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, formatHeadToHead(h2h)))
+}
+
+// formatHeadToHead форматирует сравнение двух игроков.
+func formatHeadToHead(h2h *service.HeadToHead) string {
+	nameA, nameB := h2h.PlayerA.DisplayName, h2h.PlayerB.DisplayName
+	text := fmt.Sprintf("⚔️ %s vs %s\n\n", nameA, nameB)
+	if h2h.Games == 0 {
+		return text + "Они ещё ни разу не играли вместе."
+	}
+
+	text += fmt.Sprintf("🎲 Общих игр: %d\n", h2h.Games)
+	text += fmt.Sprintf("🏆 Выше соперника: %s — %d, %s — %d", nameA, h2h.WinsA, nameB, h2h.WinsB)
+	if h2h.Draws > 0 {
+		text += fmt.Sprintf(", вровень — %d", h2h.Draws)
+	}
+	text += "\n"
+
+	switch {
+	case h2h.AvgPlaceDiff > 0:
+		text += fmt.Sprintf("📍 %s в среднем на %.1f места выше\n", nameA, h2h.AvgPlaceDiff)
+	case h2h.AvgPlaceDiff < 0:
+		text += fmt.Sprintf("📍 %s в среднем на %.1f места выше\n", nameB, -h2h.AvgPlaceDiff)
+	default:
+		text += "📍 В среднем места равны\n"
+	}
+	text += fmt.Sprintf("💰 Очков отобрано: %s — %d, %s — %d\n", nameA, h2h.PointsA, nameB, h2h.PointsB)
+
+	if h2h.Streak > 0 {
+		leader := nameA
+		if h2h.StreakLeader == h2h.PlayerB.TGID {
+			leader = nameB
+		}
+		text += fmt.Sprintf("🔥 %s выше в последних %d %s подряд\n", leader, h2h.Streak, Pluralize(h2h.Streak, [3]string{"встрече", "встречах", "встречах"}))
+	}
+	return text
+}
+
+// formatStats форматирует профиль игрока.
+func formatStats(stats *service.PlayerStats) string {
+	text := fmt.Sprintf("📊 Статистика: %s\n\n", stats.Player.DisplayName)
+	if stats.Games == 0 {
+		return text + "Пока ни одной игры. Записать: /record"
+	}
+
+	text += fmt.Sprintf("🎲 Игр: %d\n", stats.Games)
+	text += fmt.Sprintf("🏆 Побед: %d (%.0f%%)\n", stats.Wins, stats.WinRate*100)
+	text += fmt.Sprintf("🥉 В тройке: %d\n", stats.Podiums)
+	if stats.DNFs > 0 {
+		text += fmt.Sprintf("🚪 Выбывал: %d %s\n", stats.DNFs, Pluralize(stats.DNFs, [3]string{"раз", "раза", "раз"}))
+	}
+	text += fmt.Sprintf("📍 Среднее место: %.1f\n", stats.AveragePlace)
+	text += fmt.Sprintf("💰 Очков за игру: %.1f\n", stats.PointsPerGame)
+	text += fmt.Sprintf("🔥 Лучшая серия побед: %d\n", stats.BestStreak)
+	text += fmt.Sprintf("🥶 Дольше всего без побед: %d %s\n", stats.WorstStreak, Pluralize(stats.WorstStreak, [3]string{"игра", "игры", "игр"}))
+
+	if len(stats.Opponents) > 0 {
+		text += "\n🤝 Любимые соперники:\n"
+		for _, o := range stats.Opponents {
+			text += fmt.Sprintf("%s — %d %s, выше в %d\n", o.Player.DisplayName, o.Games, Pluralize(o.Games, [3]string{"игра", "игры", "игр"}), o.Wins)
+		}
+	}
+
+	text += "\n🕑 Последние игры:\n"
+	for _, g := range stats.Recent {
+		if g.DNF {
+			text += fmt.Sprintf("#%d %s: выбыл, %+d\n", g.GameID, g.Date.Format("02.01"), g.Points)
+			continue
+		}
+		text += fmt.Sprintf("#%d %s: %d из %d, %+d\n", g.GameID, g.Date.Format("02.01"), g.Place, g.Players, g.Points)
+	}
+	return text
+}
+
+// HandleRecalc - /recalc [fix], сверка очков игроков с результатами игр (только для администраторов).
+// Очки каждой игры пересчитываются по стратегии, с которой она была записана, а не по текущей
+// стратегии чата: смена /scoring не должна задним числом менять очки уже сыгранных игр.
+func (h *Handler) HandleRecalc(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	if !isChatAdmin(h.Bot, msg.Chat, msg.From.ID) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Пересчитывать очки могут только администраторы чата."))
+		return
+	}
+
+	fix := strings.TrimSpace(msg.CommandArguments()) == "fix"
+	report, err := h.Service.RecalcScores(ctx, chatID, fix)
+	if err != nil {
+		log.Printf("Failed to recalc scores in chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось пересчитать очки 😅"))
+		return
+	}
+	if report.Fixed {
+		log.Printf("[Recalc] scores in chat %d fixed by %s", chatID, msg.From.UserName)
+	}
+
+	reply := tgbotapi.NewMessage(chatID, formatRecalcReport(report))
+	if !report.Consistent() && !report.Fixed {
+		reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🛠 Исправить", "recalc_fix"),
+		))
+	}
+	sendMessage(h.Bot, reply)
+}
+
+// HandleRecalcCallback обрабатывает кнопку "🛠 Исправить" под отчетом /recalc.
+func (h *Handler) HandleRecalcCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	if !isChatAdmin(h.Bot, callback.Message.Chat, callback.From.ID) {
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Исправлять очки могут только администраторы чата."))
+		return
+	}
+
+	report, err := h.Service.RecalcScores(ctx, chatID, true)
+	if err != nil {
+		log.Printf("Failed to fix scores in chat %d: %v", chatID, err)
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Не удалось исправить очки 😅"))
+		return
+	}
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+	log.Printf("[Recalc] scores in chat %d fixed by %s", chatID, callback.From.UserName)
+	sendMessage(h.Bot, tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, formatRecalcReport(report)))
+}
+
+// formatRecalcReport форматирует отчет о сверке очков.
+func formatRecalcReport(report *service.RecalcReport) string {
+	text := fmt.Sprintf("🧮 Пересчёт очков по %d %s", report.Games, Pluralize(report.Games, [3]string{"игре", "играм", "играм"}))
+	if !report.Since.IsZero() {
+		text += fmt.Sprintf(" с начала или конца последнего сезона (%s)", report.Since.Format("02.01.2006"))
+	}
+	text += "\nОчки каждой игры считаются по стратегии, с которой она записана, а не по текущей /scoring.\n\n"
+
+	if report.Consistent() {
+		return text + "✅ Очки всех игроков совпадают с результатами игр."
+	}
+	if report.WrongResults > 0 {
+		text += fmt.Sprintf("⚠️ Результатов с неверными очками: %d\n", report.WrongResults)
+	}
+	if len(report.Discrepancies) > 0 {
+		text += "⚠️ Расхождения (сейчас → должно быть):\n"
+		for _, d := range report.Discrepancies {
+			text += fmt.Sprintf("%s: %d → %d\n", d.Player.DisplayName, d.Stored, d.Expected)
+		}
+	}
+	if report.Fixed {
+		text += "\n✅ Исправлено."
+	}
+	return text
+}
+
+// HandleScoring - /scoring, показывает текущую стратегию подсчёта очков и меню выбора
+func (h *Handler) HandleScoring(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	current, err := h.Service.GetScoring(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get scoring for chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить настройки подсчёта очков 😅"))
+		return
+	}
+
+	reply := tgbotapi.NewMessage(chatID, h.scoringText(current))
+	reply.ReplyMarkup = h.buildScoringKeyboard(current)
+	sendMessage(h.Bot, reply)
+}
+
+// HandleScoringCallback обрабатывает выбор стратегии подсчёта очков. Менять её может только администратор чата.
+func (h *Handler) HandleScoringCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	name := strings.TrimPrefix(callback.Data, "scoring_")
+
+	if !isChatAdmin(h.Bot, callback.Message.Chat, callback.From.ID) {
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Менять подсчёт очков могут только администраторы чата."))
+		return
+	}
+
+	if err := h.Service.SetScoring(ctx, chatID, name); err != nil {
+		log.Printf("Failed to set scoring %q for chat %d: %v", name, chatID, err)
+		answerCallback(h.Bot, tgbotapi.NewCallbackWithAlert(callback.ID, "Не удалось сменить подсчёт очков 😅"))
+		return
+	}
+	answerCallback(h.Bot, tgbotapi.NewCallback(callback.ID, ""))
+
+	current, err := h.Service.GetScoring(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get scoring for chat %d: %v", chatID, err)
+		return
+	}
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, callback.Message.MessageID, h.scoringText(current), h.buildScoringKeyboard(current))
+	sendMessage(h.Bot, editMsg)
+}
+
+func (h *Handler) scoringText(current service.ScoringStrategy) string {
+	text := fmt.Sprintf("🧮 Подсчёт очков: %s\n\n", current.Title())
+	text += "Очки за места в игре из 4 игроков:\n"
+	for place := 1; place <= 4; place++ {
+		text += fmt.Sprintf("%d. %+d\n", place, current.Points(place, 4))
+	}
+	text += "\nАдминистраторы чата могут выбрать другой вариант:"
+	return text
+}
+
+// buildScoringKeyboard создает клавиатуру выбора стратегии, отмечая текущую.
+func (h *Handler) buildScoringKeyboard(current service.ScoringStrategy) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, s := range h.Service.AvailableScorings() {
+		title := s.Title()
+		if s.Name() == current.Name() {
+			title = "✅ " + title
+		}
+		button := tgbotapi.NewInlineKeyboardButtonData(title, "scoring_"+s.Name())
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// HandleGameConfig - /gameconfig показывает настройки игры чата, /gameconfig min|max <число> и
+// /gameconfig autolast on|off меняют их. Менять настройки могут только администраторы.
+func (h *Handler) HandleGameConfig(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	args := strings.Fields(msg.CommandArguments())
+
+	cfg, err := h.Service.GetGameConfig(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get game config for chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить настройки игры 😅"))
+		return
+	}
+	if len(args) == 0 {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, formatGameConfig(cfg)))
+		return
+	}
+
+	usage := "Использование: /gameconfig [min <число> | max <число> | autolast on|off]"
+	if len(args) != 2 {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+	if !isChatAdmin(h.Bot, msg.Chat, msg.From.ID) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Менять настройки игры могут только администраторы чата."))
+		return
+	}
+
+	switch args[0] {
+	case "min", "max":
+		var n int
+		if _, err := fmt.Sscanf(args[1], "%d", &n); err != nil {
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, usage))
+			return
+		}
+		if args[0] == "min" {
+			cfg.MinPlayers = n
+		} else {
+			cfg.MaxPlayers = n
+		}
+	case "autolast":
+		switch args[1] {
+		case "on":
+			cfg.AutoPlaceLast = true
+		case "off":
+			cfg.AutoPlaceLast = false
+		default:
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, usage))
+			return
+		}
+	default:
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+
+	err = h.Service.SetGameConfig(ctx, chatID, cfg)
+	if errors.Is(err, service.ErrInvalidGameConfig) {
+		text := fmt.Sprintf("В игре может быть от 2 до %d игроков, и минимум не может быть больше максимума.", service.MaxPlayersLimit)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to set game config for chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось сохранить настройки игры 😅"))
+		return
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, formatGameConfig(cfg)))
+}
+
+// formatGameConfig форматирует настройки игры чата.
+func formatGameConfig(cfg storage.GameConfig) string {
+	autoLast := "нет"
+	if cfg.AutoPlaceLast {
+		autoLast = "да"
+	}
+	text := "⚙️ Настройки игры:\n"
+	text += fmt.Sprintf("Игроков в игре: от %d до %d\n", cfg.MinPlayers, cfg.MaxPlayers)
+	text += fmt.Sprintf("Последний оставшийся из состава занимает место сам: %s\n", autoLast)
+	text += "\nАдминистраторы чата могут изменить их:\n/gameconfig min <число>\n/gameconfig max <число>\n/gameconfig autolast on|off"
+	return text
+}
+
+// HandleGlicko - /glicko, рейтинг Glicko-2 с отклонением
+func (h *Handler) HandleGlicko(ctx context.Context, chatID int64) {
+	ratings, err := h.Service.GetGlickoRatings(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get glicko ratings for chat %d: %v", chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить рейтинг 😅"))
+		return
+	}
+
+	if len(ratings) == 0 {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Пока не сыграно ни одной игры."))
+		return
+	}
+
+	text := "📊 Рейтинг Glicko-2:\n"
+	hasProvisional := false
+	for i, r := range ratings {
+		text += fmt.Sprintf("%d. %s — %.0f ± %.0f", i+1, r.Player.DisplayName, r.Rating, r.Deviation)
+		if r.Provisional {
+			text += " ⏳"
+			hasProvisional = true
+		}
+		text += "\n"
+	}
+	if hasProvisional {
+		text += "\n⏳ — предварительный рейтинг: мало игр или игрок давно не играл"
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+}
+
+// HandleSeason - /season start [название] | end | list
+func (h *Handler) HandleSeason(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	args := strings.Fields(msg.CommandArguments())
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	if (action == "start" || action == "end") && !isChatAdmin(h.Bot, msg.Chat, msg.From.ID) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Управлять сезонами могут только администраторы чата."))
+		return
+	}
+
+	switch action {
+	case "start":
+		name := strings.Join(args[1:], " ")
+		season, err := h.Service.StartSeason(ctx, chatID, name)
+		switch {
+		case errors.Is(err, service.ErrSeasonActive):
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сезон уже идёт. Сначала завершите его: /season end"))
+		case errors.Is(err, service.ErrSeasonExists):
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сезон с таким названием уже был. Укажите другое: /season start <название>"))
+		case err != nil:
+			log.Printf("Failed to start season in chat %d: %v", chatID, err)
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось начать сезон 😅"))
+		default:
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("🚀 Сезон «%s» начался! Очки игроков обнулены.", season.Name)))
+		}
+	case "end":
+		season, standings, err := h.Service.EndSeason(ctx, chatID)
+		switch {
+		case errors.Is(err, service.ErrNoActiveSeason):
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сейчас нет активного сезона. Начать: /season start"))
+		case err != nil:
+			log.Printf("Failed to end season in chat %d: %v", chatID, err)
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось завершить сезон 😅"))
+		default:
+			text := formatStandings(fmt.Sprintf("🏁 Сезон «%s» завершён! Итоги:", season.Name), standings)
+			text += "\nОчки игроков обнулены. Архив: /leaderboard season:" + season.Name
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+		}
+	case "list":
+		seasons, err := h.Service.ListSeasons(ctx, chatID)
+		if err != nil {
+			log.Printf("Failed to list seasons in chat %d: %v", chatID, err)
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить список сезонов 😅"))
+			return
+		}
+		if len(seasons) == 0 {
+			sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Сезонов пока не было. Начать: /season start"))
+			return
+		}
+		text := "📅 Сезоны:\n"
+		for _, season := range seasons {
+			if season.EndedAt == nil {
+				text += fmt.Sprintf("• %s — идёт с %s\n", season.Name, season.StartedAt.Format("02.01.2006"))
+			} else {
+				text += fmt.Sprintf("• %s — %s–%s\n", season.Name, season.StartedAt.Format("02.01.2006"), season.EndedAt.Format("02.01.2006"))
+			}
+		}
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, text))
+	default:
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Использование: /season start [название] | end | list"))
+	}
+}
+
+// HandleSeasonLeaderboard - /leaderboard season:<название>, таблица сезона
+func (h *Handler) HandleSeasonLeaderboard(ctx context.Context, chatID int64, name string) {
+	season, standings, err := h.Service.GetSeasonStandings(ctx, chatID, name)
+	if errors.Is(err, service.ErrSeasonNotFound) {
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("Сезон «%s» не найден. Список сезонов: /season list", name)))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get season %q standings in chat %d: %v", name, chatID, err)
+		sendMessage(h.Bot, tgbotapi.NewMessage(chatID, "Не удалось получить рейтинг 😅"))
+		return
+	}
+
+	title := fmt.Sprintf("🏆 Сезон «%s»:", season.Name)
+	if season.ID != 0 && season.EndedAt == nil {
+		title = fmt.Sprintf("🏆 Сезон «%s» (идёт):", season.Name)
+	}
+	sendMessage(h.Bot, tgbotapi.NewMessage(chatID, formatStandings(title, standings)))
+}
+
+// formatStandings форматирует таблицу сезона.
+func formatStandings(title string, standings []storage.SeasonStanding) string {
+	text := title + "\n"
+	for _, st := range standings {
+		word := Pluralize(st.Score, [3]string{"очко", "очка", "очков"})
+		games := Pluralize(st.Games, [3]string{"игра", "игры", "игр"})
+		text += fmt.Sprintf("%d. %s — %d %s (%d %s)\n", st.Place, st.Player.DisplayName, st.Score, word, st.Games, games)
+	}
+	return text
 }
 
 var commandsKeyboard = tgbotapi.NewInlineKeyboardMarkup(
@@ -236,9 +1584,21 @@ var commandsKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 func (h *Handler) HandleHelp(msg *tgbotapi.Message) {
 	text := "Добро пожаловать в Svintus Bot! Вот что я умею:\n\n" +
 		"/join - присоединиться к игре\n" +
-		"/leaderboard - показать рейтинг игроков\n" +
+		"/leaderboard - показать рейтинг игроков (/leaderboard rating - по рейтингу Эло, /leaderboard season:2025 - архив сезона)\n" +
+		"/season start|end|list - управление сезонами\n" +
+		"/stats [@игрок] - статистика игрока\n" +
+		"/vs @игрок1 @игрок2 - сравнение двух игроков\n" +
+		"/rating - узнать свой рейтинг Эло\n" +
+		"/glicko - рейтинг Glicko-2 с учетом надежности\n" +
 		"/myscore - узнать свои очки\n" +
 		"/record - записать результаты игры \n" +
+		"/games - история игр\n" +
+		"/game <номер> - подробности об игре\n" +
+		"/undo - отменить последнюю игру\n" +
+		"/recalc [fix] - сверить очки с результатами игр\n" +
+		"/editgame <номер> - изменить места в игре (/editgame <номер> history - версии)\n" +
+		"/scoring - выбрать подсчёт очков\n" +
+		"/gameconfig - число игроков в игре и другие настройки записи\n" +
 		"/help - показать это сообщение"
 
 	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
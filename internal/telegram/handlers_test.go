@@ -1,10 +1,13 @@
 package telegram
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/service"
 	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,79 +17,319 @@ type MockGameService struct {
 	mock.Mock
 }
 
-func (m *MockGameService) RegisterPlayer(tgID int64, username, displayName string) error {
-	args := m.Called(tgID, username, displayName)
+func (m *MockGameService) RegisterPlayer(ctx context.Context, chatID int64, tgID int64, username, displayName string) error {
+	args := m.Called(chatID, tgID, username, displayName)
 	return args.Error(0)
 }
 
-func (m *MockGameService) RecordGame(winners []storage.Player) error {
-	args := m.Called(winners)
-	return args.Error(0)
+func (m *MockGameService) RecordGame(ctx context.Context, chatID int64, winners []storage.Player) (*storage.Game, error) {
+	args := m.Called(chatID, winners)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Game), args.Error(1)
 }
 
-func (m *MockGameService) GetLeaderboard() ([]storage.Player, error) {
-	args := m.Called()
+func (m *MockGameService) GetLeaderboard(ctx context.Context, chatID int64, order service.LeaderboardOrder) ([]storage.Player, error) {
+	args := m.Called(chatID, order)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]storage.Player), args.Error(1)
 }
 
-func (m *MockGameService) GetAllPlayers() ([]storage.Player, error) {
-	args := m.Called()
+func (m *MockGameService) GetAllPlayers(ctx context.Context, chatID int64) ([]storage.Player, error) {
+	args := m.Called(chatID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]storage.Player), args.Error(1)
 }
 
-func (m *MockGameService) GetPlayerByTGID(tgID int64) (*storage.Player, error) {
-	args := m.Called(tgID)
+func (m *MockGameService) GetPlayerByTGID(ctx context.Context, chatID int64, tgID int64) (*storage.Player, error) {
+	args := m.Called(chatID, tgID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*storage.Player), args.Error(1)
 }
 
-func (m *MockGameService) GetPlayerScore(tgID int64) (int, error) {
-	args := m.Called(tgID)
+func (m *MockGameService) GetPlayerScore(ctx context.Context, chatID int64, tgID int64) (int, error) {
+	args := m.Called(chatID, tgID)
 	return args.Int(0), args.Error(1)
 }
 
-func (m *MockGameService) StartRecordingSession(chatID int64, messageID int64) error {
-	args := m.Called(chatID, messageID)
+func (m *MockGameService) AvailableScorings() []service.ScoringStrategy {
+	args := m.Called()
+	return args.Get(0).([]service.ScoringStrategy)
+}
+
+func (m *MockGameService) GetScoring(ctx context.Context, chatID int64) (service.ScoringStrategy, error) {
+	args := m.Called(chatID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(service.ScoringStrategy), args.Error(1)
+}
+
+func (m *MockGameService) SetScoring(ctx context.Context, chatID int64, name string) error {
+	args := m.Called(chatID, name)
 	return args.Error(0)
 }
 
-func (m *MockGameService) GetRecordingSession(chatID int64) (*storage.RecordingSession, error) {
+func (m *MockGameService) GetGameConfig(ctx context.Context, chatID int64) (storage.GameConfig, error) {
 	args := m.Called(chatID)
+	return args.Get(0).(storage.GameConfig), args.Error(1)
+}
+
+func (m *MockGameService) SetGameConfig(ctx context.Context, chatID int64, cfg storage.GameConfig) error {
+	args := m.Called(chatID, cfg)
+	return args.Error(0)
+}
+
+func (m *MockGameService) GetRatingHistory(ctx context.Context, chatID int64, tgID int64, limit int) ([]storage.RatingChange, error) {
+	args := m.Called(chatID, tgID, limit)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*storage.RecordingSession), args.Error(1)
+	return args.Get(0).([]storage.RatingChange), args.Error(1)
 }
 
-func (m *MockGameService) AddPlayerToRecording(chatID int64, playerTgID int64) ([]storage.Player, error) {
-	args := m.Called(chatID, playerTgID)
+func (m *MockGameService) GetGlickoRatings(ctx context.Context, chatID int64) ([]service.GlickoRating, error) {
+	args := m.Called(chatID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]storage.Player), args.Error(1)
+	return args.Get(0).([]service.GlickoRating), args.Error(1)
+}
+
+func (m *MockGameService) StartSeason(ctx context.Context, chatID int64, name string) (*storage.Season, error) {
+	args := m.Called(chatID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Season), args.Error(1)
+}
+
+func (m *MockGameService) EndSeason(ctx context.Context, chatID int64) (*storage.Season, []storage.SeasonStanding, error) {
+	args := m.Called(chatID)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*storage.Season), args.Get(1).([]storage.SeasonStanding), args.Error(2)
 }
 
-func (m *MockGameService) FinishRecording(chatID int64) ([]storage.Player, error) {
+func (m *MockGameService) ListSeasons(ctx context.Context, chatID int64) ([]storage.Season, error) {
 	args := m.Called(chatID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
+	return args.Get(0).([]storage.Season), args.Error(1)
+}
+
+func (m *MockGameService) GetSeasonStandings(ctx context.Context, chatID int64, name string) (*storage.Season, []storage.SeasonStanding, error) {
+	args := m.Called(chatID, name)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*storage.Season), args.Get(1).([]storage.SeasonStanding), args.Error(2)
+}
+
+func (m *MockGameService) GetPlayerStats(ctx context.Context, chatID int64, tgID int64) (*service.PlayerStats, error) {
+	args := m.Called(chatID, tgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.PlayerStats), args.Error(1)
+}
+
+func (m *MockGameService) GetHeadToHead(ctx context.Context, chatID int64, a, b int64) (*service.HeadToHead, error) {
+	args := m.Called(chatID, a, b)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.HeadToHead), args.Error(1)
+}
+
+func (m *MockGameService) RecalcScores(ctx context.Context, chatID int64, fix bool) (*service.RecalcReport, error) {
+	args := m.Called(chatID, fix)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.RecalcReport), args.Error(1)
+}
+
+func (m *MockGameService) ListGames(ctx context.Context, chatID int64, offset, limit int) ([]storage.Game, int, error) {
+	args := m.Called(chatID, offset, limit)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]storage.Game), args.Int(1), args.Error(2)
+}
+
+func (m *MockGameService) UndoLastGame(ctx context.Context, chatID int64, actorTGID int64) (*storage.Game, error) {
+	args := m.Called(chatID, actorTGID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Game), args.Error(1)
+}
+
+func (m *MockGameService) UndoGame(ctx context.Context, chatID int64, gameID int, actorTGID int64) (*storage.Game, error) {
+	args := m.Called(chatID, gameID, actorTGID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Game), args.Error(1)
+}
+
+func (m *MockGameService) StartGameEdit(ctx context.Context, chatID int64, gameID int, messageID int64, editorTGID int64) (*storage.Game, error) {
+	args := m.Called(chatID, gameID, messageID, editorTGID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Game), args.Error(1)
+}
+
+func (m *MockGameService) FinishGameEdit(ctx context.Context, chatID int64, messageID int64, editorTGID int64) (*storage.Game, error) {
+	args := m.Called(chatID, messageID, editorTGID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Game), args.Error(1)
+}
+
+func (m *MockGameService) GetGameVersions(ctx context.Context, chatID int64, gameID int) (*storage.Game, []storage.GameVersion, error) {
+	args := m.Called(chatID, gameID)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*storage.Game), args.Get(1).([]storage.GameVersion), args.Error(2)
+}
+
+func (m *MockGameService) StartRecordingSession(ctx context.Context, chatID int64, messageID int64, ownerTGID int64) error {
+	args := m.Called(chatID, messageID, ownerTGID)
+	return args.Error(0)
+}
+
+func (m *MockGameService) CanUndoGame(ctx context.Context, chatID int64, gameID int, userID int64, isAdmin func() bool) (bool, error) {
+	args := m.Called(chatID, gameID, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockGameService) CanControlRecording(ctx context.Context, session *storage.RecordingSession, userID int64, isAdmin func() bool) (bool, error) {
+	args := m.Called(session, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockGameService) GetRecordingLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	args := m.Called(chatID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
 	return args.Get(0).([]storage.Player), args.Error(1)
 }
 
-func (m *MockGameService) CancelRecording(chatID int64) error {
-	args := m.Called(chatID)
+func (m *MockGameService) ToggleLineupPlayer(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.Player, error) {
+	args := m.Called(chatID, messageID, playerTgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.Player), args.Error(1)
+}
+
+func (m *MockGameService) ConfirmLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	args := m.Called(chatID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.Player), args.Error(1)
+}
+
+func (m *MockGameService) ReopenLineup(ctx context.Context, chatID int64, messageID int64) ([]storage.Player, error) {
+	args := m.Called(chatID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.Player), args.Error(1)
+}
+
+func (m *MockGameService) GetRecordingSession(ctx context.Context, chatID int64, messageID int64) (*storage.RecordingSession, error) {
+	args := m.Called(chatID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.RecordingSession), args.Error(1)
+}
+
+func (m *MockGameService) AddPlayerToRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64, tied bool) ([]storage.SessionPlayer, error) {
+	args := m.Called(chatID, messageID, playerTgID, tied)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.SessionPlayer), args.Error(1)
+}
+
+func (m *MockGameService) RemovePlayerFromRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.SessionPlayer, error) {
+	args := m.Called(chatID, messageID, playerTgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.SessionPlayer), args.Error(1)
+}
+
+func (m *MockGameService) AddDNFToRecording(ctx context.Context, chatID int64, messageID int64, playerTgID int64) ([]storage.SessionPlayer, error) {
+	args := m.Called(chatID, messageID, playerTgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.SessionPlayer), args.Error(1)
+}
+func (m *MockGameService) RemoveLastPlayerFromRecording(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error) {
+	args := m.Called(chatID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.SessionPlayer), args.Error(1)
+}
+
+func (m *MockGameService) SwapRecordingPlayers(ctx context.Context, chatID int64, messageID int64, firstTgID int64, secondTgID int64) ([]storage.SessionPlayer, error) {
+	args := m.Called(chatID, messageID, firstTgID, secondTgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.SessionPlayer), args.Error(1)
+}
+
+func (m *MockGameService) GetRecordingPlayers(ctx context.Context, chatID int64, messageID int64) ([]storage.SessionPlayer, error) {
+	args := m.Called(chatID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.SessionPlayer), args.Error(1)
+}
+
+func (m *MockGameService) FinishRecording(ctx context.Context, chatID int64, messageID int64) (*storage.Game, error) {
+	args := m.Called(chatID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Game), args.Error(1)
+}
+
+func (m *MockGameService) CancelRecording(ctx context.Context, chatID int64, messageID int64) error {
+	args := m.Called(chatID, messageID)
 	return args.Error(0)
 }
 
+func (m *MockGameService) ExpireRecordingSessions(ctx context.Context) ([]storage.RecordingSession, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.RecordingSession), args.Error(1)
+}
+
 // MockMessageSender является моком для интерфейса MessageSender
 type MockMessageSender struct {
 	mock.Mock
@@ -115,22 +358,22 @@ func TestHandleJoin(t *testing.T) {
 	chatID := int64(456)
 
 	t.Run("успешная регистрация", func(t *testing.T) {
-		mockService.On("RegisterPlayer", user.ID, user.UserName, user.FirstName).Return(nil).Once()
+		mockService.On("RegisterPlayer", chatID, user.ID, user.UserName, user.FirstName).Return(nil).Once()
 		expectedMsg := tgbotapi.NewMessage(chatID, "Test присоединился к игре!")
 		mockSender.On("Send", expectedMsg).Return(tgbotapi.Message{}, nil).Once()
 
-		handler.HandleJoin(chatID, user)
+		handler.HandleJoin(context.Background(), chatID, user)
 
 		mockService.AssertExpectations(t)
 		mockSender.AssertExpectations(t)
 	})
 
 	t.Run("ошибка регистрации", func(t *testing.T) {
-		mockService.On("RegisterPlayer", user.ID, user.UserName, user.FirstName).Return(errors.New("db error")).Once()
+		mockService.On("RegisterPlayer", chatID, user.ID, user.UserName, user.FirstName).Return(errors.New("db error")).Once()
 		expectedMsg := tgbotapi.NewMessage(chatID, "Не удалось зарегистрироваться 😅")
 		mockSender.On("Send", expectedMsg).Return(tgbotapi.Message{}, nil).Once()
 
-		handler.HandleJoin(chatID, user)
+		handler.HandleJoin(context.Background(), chatID, user)
 
 		mockService.AssertExpectations(t)
 		mockSender.AssertExpectations(t)
@@ -141,16 +384,22 @@ func TestHandleRecordStart(t *testing.T) {
 	mockService := new(MockGameService)
 	mockSender := new(MockMessageSender)
 	handler := NewHandler(mockSender, mockService)
-	msg := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}}
+	msg := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, From: &tgbotapi.User{ID: 7}}
 
 	players := []storage.Player{{TGID: 1, DisplayName: "Player1"}}
-	mockService.On("GetAllPlayers").Return(players, nil).Once()
+	mockService.On("GetAllPlayers", msg.Chat.ID).Return(players, nil).Twice()
+	mockService.On("GetGameConfig", msg.Chat.ID).Return(service.DefaultGameConfig, nil).Once()
 
-	// Ожидаем, что бот отправит сообщение и затем создаст сессию
-	mockSender.On("Send", mock.Anything).Return(tgbotapi.Message{MessageID: 456}, nil).Once()
-	mockService.On("StartRecordingSession", msg.Chat.ID, int64(456)).Return(nil).Once()
+	// Бот отправляет сообщение, создает для него сессию и добавляет клавиатуру выбора состава с ID сессии
+	mockSender.On("Send", tgbotapi.NewMessage(123, "📝 Начинаю запись…")).Return(tgbotapi.Message{MessageID: 456}, nil).Once()
+	mockService.On("StartRecordingSession", msg.Chat.ID, int64(456), int64(7)).Return(nil).Once()
+	expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Player1", "record_play_456_1")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456")),
+	)
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, "Кто играл? Отметьте от 2 до 6 игроков и нажмите «➡️ Далее».", expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
 
-	handler.HandleRecordStart(msg)
+	handler.HandleRecordStart(context.Background(), msg)
 
 	mockService.AssertExpectations(t)
 	mockSender.AssertExpectations(t)
@@ -163,19 +412,867 @@ func TestHandleRecordCallback_Finish(t *testing.T) {
 
 	callback := &tgbotapi.CallbackQuery{
 		ID:      "cb_id",
+		From:    &tgbotapi.User{ID: 7},
 		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
-		Data:    "record_finish",
+		Data:    "record_finish_456",
 	}
-	session := &storage.RecordingSession{ChatID: 123, MessageID: 456}
-	winners := []storage.Player{{DisplayName: "Winner1"}}
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+	game := &storage.Game{ID: 1, Results: []storage.GameResult{
+		{Player: storage.Player{DisplayName: "Winner1"}, Place: 1, Points: 2, RatingBefore: 1500, RatingAfter: 1516},
+		{Player: storage.Player{DisplayName: "Loser1"}, Place: 2, Points: 1, RatingBefore: 1500, RatingAfter: 1484},
+	}}
 
 	// Настраиваем моки
 	mockSender.On("Request", mock.Anything).Return(nil, nil).Once() // Answer callback
-	mockService.On("GetRecordingSession", callback.Message.Chat.ID).Return(session, nil).Once()
-	mockService.On("FinishRecording", callback.Message.Chat.ID).Return(winners, nil).Once()
-	mockSender.On("Send", mock.Anything).Return(tgbotapi.Message{}, nil).Once() // Final message
+	mockService.On("GetRecordingSession", callback.Message.Chat.ID, int64(456)).Return(session, nil).Once()
+	mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+	mockService.On("FinishRecording", callback.Message.Chat.ID, int64(456)).Return(game, nil).Once()
+	expectedText := "🏆 Результаты игры #1 сохранены:\n" +
+		"1. Winner1 — +2, Эло 1516 (+16)\n" +
+		"2. Loser1 — +1, Эло 1484 (-16)\n"
+	undoKeyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ Отменить", "undo_1"),
+	))
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, undoKeyboard)).Return(tgbotapi.Message{}, nil).Once() // Final message
+
+	handler.HandleRecordCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestExpireSessions(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	mockService.On("ExpireRecordingSessions").Return([]storage.RecordingSession{
+		{ChatID: 123, MessageID: 456},
+		{ChatID: 789, MessageID: 12, EditGameID: 3},
+	}, nil).Once()
+	mockSender.On("Send", tgbotapi.NewEditMessageText(123, 456, "Сессия истекла.")).Return(tgbotapi.Message{}, nil).Once()
+	mockSender.On("Send", tgbotapi.NewEditMessageText(789, 12, "Сессия истекла.")).Return(tgbotapi.Message{}, nil).Once()
+
+	handler.ExpireSessions(context.Background())
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestHandleScoringCallback(t *testing.T) {
+	t.Run("выбор в личном чате", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 1},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123, Type: "private"}, MessageID: 456},
+			Data:    "scoring_f1",
+		}
+
+		mockService.On("SetScoring", int64(123), "f1").Return(nil).Once()
+		mockService.On("GetScoring", int64(123)).Return(service.F1Scoring(), nil).Once()
+		mockService.On("AvailableScorings").Return([]service.ScoringStrategy{service.LinearScoring{}, service.F1Scoring()}).Once()
+		mockSender.On("Request", tgbotapi.NewCallback("cb_id", "")).Return(nil, nil).Once()
+		mockSender.On("Send", mock.Anything).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleScoringCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("не администратор группы", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 1},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -100, Type: "group"}, MessageID: 456},
+			Data:    "scoring_f1",
+		}
+
+		// Запрос getChatMember завершается ошибкой - права подтвердить нельзя
+		mockSender.On("Request", mock.AnythingOfType("tgbotapi.GetChatMemberConfig")).Return(nil, errors.New("forbidden")).Once()
+		mockSender.On("Request", tgbotapi.NewCallbackWithAlert("cb_id", "Менять подсчёт очков могут только администраторы чата.")).Return(nil, nil).Once()
+
+		handler.HandleScoringCallback(context.Background(), callback)
+
+		mockService.AssertNotCalled(t, "SetScoring", mock.Anything, mock.Anything)
+		mockSender.AssertExpectations(t)
+	})
+}
+
+func TestHandleUndoCallback(t *testing.T) {
+	newCallback := func() *tgbotapi.CallbackQuery {
+		return &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 7, FirstName: "Admin"},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+			Data:    "undo_42",
+		}
+	}
+
+	t.Run("успешная отмена", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		game := &storage.Game{ID: 42, Results: []storage.GameResult{
+			{Player: storage.Player{DisplayName: "Winner1"}, Place: 1, Points: 2},
+		}}
+		mockService.On("CanUndoGame", int64(123), 42, int64(7)).Return(true, nil).Once()
+		mockService.On("UndoGame", int64(123), 42, int64(7)).Return(game, nil).Once()
+		mockSender.On("Request", tgbotapi.NewCallback("cb_id", "Игра отменена")).Return(nil, nil).Once()
+		expectedText := "↩️ Игра #42 отменена (Admin), очки списаны:\n1. Winner1 — +2\n"
+		mockSender.On("Send", tgbotapi.NewEditMessageText(123, 456, expectedText)).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleUndoCallback(context.Background(), newCallback())
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("время истекло", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		mockService.On("CanUndoGame", int64(123), 42, int64(7)).Return(true, nil).Once()
+		mockService.On("UndoGame", int64(123), 42, int64(7)).Return(nil, service.ErrUndoExpired).Once()
+		mockSender.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).Return(nil, nil).Once()
+		mockSender.On("Send", mock.AnythingOfType("tgbotapi.EditMessageReplyMarkupConfig")).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleUndoCallback(context.Background(), newCallback())
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("не администратор и не записавший", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		mockService.On("CanUndoGame", int64(123), 42, int64(7)).Return(false, nil).Once()
+		mockSender.On("Request", tgbotapi.NewCallbackWithAlert("cb_id", "Отменить игру может только тот, кто ее записал, или администратор чата 🙅")).Return(nil, nil).Once()
+
+		handler.HandleUndoCallback(context.Background(), newCallback())
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+		mockService.AssertNotCalled(t, "UndoGame", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestHandleRecordCallback_EditRemovePlayer(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_id",
+		From:    &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+		Data:    "record_remove_456_1",
+	}
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 456, EditGameID: 9, OwnerTGID: 7}
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+
+	mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+	mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+	mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+	mockService.On("RemovePlayerFromRecording", int64(123), int64(456), int64(1)).Return([]storage.SessionPlayer{{Player: bob, Place: 1}}, nil).Once()
+	mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, bob}, nil).Once()
+
+	expectedText := "✏️ Редактирование игры #9\nНажмите ✖️, чтобы убрать игрока, или выберите, кого добавить следующим.\n\n" +
+		"Порядок победителей:\n1. Bob\n\nКто занял 2-е место?\n🤝 — разделить место с предыдущим\n🚪 — выбыл, не доиграв"
+	expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✖️ 1. Bob", "record_remove_456_2")),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Alice", "record_select_456_1"),
+			tgbotapi.NewInlineKeyboardButtonData("🤝", "record_tie_456_1"),
+			tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_1"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "record_back_456"),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Сохранить", "record_finish_456"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456"),
+		),
+	)
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+	handler.HandleRecordCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestHandleRecordCallback_ParallelSessions(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	// Две записи в одном чате: кнопка второй клавиатуры меняет только вторую сессию
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_id",
+		From:    &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 501},
+		Data:    "record_select_501_2",
+	}
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 501, OwnerTGID: 7}
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+
+	mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+	mockService.On("GetRecordingSession", int64(123), int64(501)).Return(session, nil).Once()
+	mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+	mockService.On("AddPlayerToRecording", int64(123), int64(501), int64(2), false).Return([]storage.SessionPlayer{{Player: bob, Place: 1}}, nil).Once()
+	mockService.On("GetRecordingLineup", int64(123), int64(501)).Return(nil, nil).Once()
+	mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, bob}, nil).Once()
+	expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Alice", "record_select_501_1"),
+			tgbotapi.NewInlineKeyboardButtonData("🤝", "record_tie_501_1"),
+			tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_501_1"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "record_back_501"),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Завершить", "record_finish_501"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_501"),
+		),
+	)
+	expectedText := "Порядок победителей:\n1. Bob\n\nКто занял 2-е место?\n🤝 — разделить место с предыдущим\n🚪 — выбыл, не доиграв"
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 501, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+	handler.HandleRecordCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestHandleRecordCallback_Back(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_id",
+		From:    &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+		Data:    "record_back_456",
+	}
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+
+	mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+	mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+	mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+	mockService.On("RemoveLastPlayerFromRecording", int64(123), int64(456)).Return([]storage.SessionPlayer{}, nil).Once()
+	mockService.On("GetRecordingLineup", int64(123), int64(456)).Return(nil, nil).Once()
+	mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, bob}, nil).Once()
+	expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Alice", "record_select_456_1"),
+			tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_1"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Bob", "record_select_456_2"),
+			tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_2"),
+		),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456")),
+	)
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, "Кто занял 1-е место?\n🚪 — выбыл, не доиграв", expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+	handler.HandleRecordCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestHandleRecordCallback_Swap(t *testing.T) {
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	carol := storage.Player{TGID: 3, DisplayName: "Carol"}
+	newCallback := func(data string) *tgbotapi.CallbackQuery {
+		return &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 7},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+			Data:    data,
+		}
+	}
+
+	t.Run("выбор игрока показывает, с кем поменяться", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+		mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+		mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+		mockService.On("GetRecordingPlayers", int64(123), int64(456)).Return([]storage.SessionPlayer{{Player: alice, Place: 1}, {Player: bob, Place: 2}}, nil).Once()
+		expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⇄ 1. Alice", "record_swap_456_2_1")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↩️ Не менять", "record_pick_456")),
+		)
+		expectedText := "Порядок победителей:\n1. Alice\n2. Bob\n\nС кем поменять местами Bob?"
+		mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), newCallback("record_pick_456_2"))
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("обмен обновляет порядок", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+		mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+		mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+		mockService.On("SwapRecordingPlayers", int64(123), int64(456), int64(2), int64(1)).Return([]storage.SessionPlayer{{Player: bob, Place: 1}, {Player: alice, Place: 2}}, nil).Once()
+		mockService.On("GetRecordingLineup", int64(123), int64(456)).Return(nil, nil).Once()
+		mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, bob, carol}, nil).Once()
+		expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↕️ 1. Bob", "record_pick_456_2")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↕️ 2. Alice", "record_pick_456_1")),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Carol", "record_select_456_3"),
+				tgbotapi.NewInlineKeyboardButtonData("🤝", "record_tie_456_3"),
+				tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_3"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "record_back_456"),
+				tgbotapi.NewInlineKeyboardButtonData("✅ Завершить", "record_finish_456"),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456"),
+			),
+		)
+		expectedText := "Порядок победителей:\n1. Bob\n2. Alice\n\nКто занял 3-е место?\n🤝 — разделить место с предыдущим\n🚪 — выбыл, не доиграв"
+		mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), newCallback("record_swap_456_2_1"))
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+}
+
+func TestHandleRecordCallback_Tie(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_id",
+		From:    &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+		Data:    "record_tie_456_3",
+	}
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	vasya := storage.Player{TGID: 2, DisplayName: "Вася"}
+	petya := storage.Player{TGID: 3, DisplayName: "Петя"}
+	dave := storage.Player{TGID: 4, DisplayName: "Dave"}
+
+	mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+	mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+	mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+	mockService.On("AddPlayerToRecording", int64(123), int64(456), int64(3), true).Return([]storage.SessionPlayer{
+		{Player: alice, Place: 1}, {Player: vasya, Place: 2}, {Player: petya, Place: 2},
+	}, nil).Once()
+	mockService.On("GetRecordingLineup", int64(123), int64(456)).Return(nil, nil).Once()
+	mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, vasya, petya, dave}, nil).Once()
+	expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↕️ 1. Alice", "record_pick_456_1")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↕️ 2. Вася", "record_pick_456_2")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↕️ 2. Петя", "record_pick_456_3")),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Dave", "record_select_456_4"),
+			tgbotapi.NewInlineKeyboardButtonData("🤝", "record_tie_456_4"),
+			tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_4"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "record_back_456"),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Завершить", "record_finish_456"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456"),
+		),
+	)
+	expectedText := "Порядок победителей:\n1. Alice\n2–3. Вася, Петя\n\nКто занял 4-е место?\n🤝 — разделить место с предыдущим\n🚪 — выбыл, не доиграв"
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+	handler.HandleRecordCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestHandleRecordCallback_DNF(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_id",
+		From:    &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+		Data:    "record_dnf_456_2",
+	}
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	carol := storage.Player{TGID: 3, DisplayName: "Carol"}
+
+	mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+	mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+	mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+	mockService.On("AddDNFToRecording", int64(123), int64(456), int64(2)).Return([]storage.SessionPlayer{
+		{Player: alice, Place: 1}, {Player: bob, DNF: true},
+	}, nil).Once()
+	mockService.On("GetRecordingLineup", int64(123), int64(456)).Return(nil, nil).Once()
+	mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, bob, carol}, nil).Once()
+	// Выбывший не занимает места: следующим выбирается 2-е, а не 3-е
+	expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✖️ 🚪 Bob", "record_remove_456_2")),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Carol", "record_select_456_3"),
+			tgbotapi.NewInlineKeyboardButtonData("🤝", "record_tie_456_3"),
+			tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_3"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "record_back_456"),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Завершить", "record_finish_456"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456"),
+		),
+	)
+	expectedText := "Порядок победителей:\n1. Alice\n🚪 Bob\n\nКто занял 2-е место?\n🤝 — разделить место с предыдущим\n🚪 — выбыл, не доиграв"
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+	handler.HandleRecordCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestHandleRecordCallback_Lineup(t *testing.T) {
+	alice := storage.Player{TGID: 1, DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, DisplayName: "Bob"}
+	carol := storage.Player{TGID: 3, DisplayName: "Carol"}
+
+	// setup возвращает обработчик, которому уже разрешено вести сессию 456
+	setup := func(data string, lineupOpen bool) (*Handler, *MockGameService, *MockMessageSender, *tgbotapi.CallbackQuery) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 7},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+			Data:    data,
+		}
+		session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7, LineupOpen: lineupOpen}
+		mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+		mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+		mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+		return NewHandler(mockSender, mockService), mockService, mockSender, callback
+	}
+
+	t.Run("отметка игрока", func(t *testing.T) {
+		handler, mockService, mockSender, callback := setup("record_play_456_2", true)
+		mockService.On("ToggleLineupPlayer", int64(123), int64(456), int64(2)).Return([]storage.Player{alice, bob}, nil).Once()
+		mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, bob, carol}, nil).Once()
+		mockService.On("GetGameConfig", int64(123)).Return(service.DefaultGameConfig, nil).Once()
+		expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Alice", "record_play_456_1")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Bob", "record_play_456_2")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Carol", "record_play_456_3")),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("➡️ Далее", "record_next_456"),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456"),
+			),
+		)
+		expectedText := "Кто играл? Отметьте от 2 до 6 игроков и нажмите «➡️ Далее».\nОтмечено: 2"
+		mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("слишком много игроков", func(t *testing.T) {
+		handler, mockService, mockSender, callback := setup("record_play_456_3", true)
+		mockService.On("ToggleLineupPlayer", int64(123), int64(456), int64(3)).Return(nil, service.ErrTooManyPlayers).Once()
+		mockService.On("GetGameConfig", int64(123)).Return(storage.GameConfig{MinPlayers: 2, MaxPlayers: 2}, nil).Once()
+		mockSender.On("Send", tgbotapi.NewMessage(123, "В игре должно быть от 2 до 2 игроков.")).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("места выбираются среди состава", func(t *testing.T) {
+		handler, mockService, mockSender, callback := setup("record_next_456", true)
+		mockService.On("ConfirmLineup", int64(123), int64(456)).Return([]storage.Player{alice, bob}, nil).Once()
+		mockService.On("GetRecordingLineup", int64(123), int64(456)).Return([]storage.Player{alice, bob}, nil).Once()
+		expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Alice", "record_select_456_1"),
+				tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_1"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Bob", "record_select_456_2"),
+				tgbotapi.NewInlineKeyboardButtonData("🚪", "record_dnf_456_2"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⬅️ Состав", "record_lineup_456"),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456"),
+			),
+		)
+		expectedText := "Кто занял 1-е место?\n🚪 — выбыл, не доиграв"
+		mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("отметка после подтверждения состава", func(t *testing.T) {
+		handler, mockService, mockSender, callback := setup("record_play_456_2", false)
+		mockService.On("ToggleLineupPlayer", int64(123), int64(456), int64(2)).Return(nil, service.ErrLineupLocked).Once()
+		mockSender.On("Send", tgbotapi.NewMessage(123, "Состав уже подтвержден. Чтобы изменить его, нажмите «⬅️ Состав».")).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("повторное подтверждение состава", func(t *testing.T) {
+		handler, mockService, mockSender, callback := setup("record_next_456", false)
+		mockService.On("ConfirmLineup", int64(123), int64(456)).Return(nil, service.ErrLineupLocked).Once()
+		mockSender.On("Send", tgbotapi.NewMessage(123, "Состав уже подтвержден. Чтобы изменить его, нажмите «⬅️ Состав».")).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("место игроку не из состава", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 7},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+			Data:    "record_select_456_3",
+		}
+		session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+		mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+		mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+		// Кнопка осталась от старого состава: подсказка вместо общей ошибки
+		mockService.On("AddPlayerToRecording", int64(123), int64(456), int64(3), false).Return(nil, service.ErrNotInLineup).Once()
+		mockSender.On("Request", tgbotapi.NewCallbackWithAlert("cb_id", "Этого игрока нет в составе игры. Чтобы изменить состав, нажмите «⬅️ Состав».")).Return(nil, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "Send", mock.Anything)
+	})
+
+	t.Run("место уже выбрано", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 7},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+			Data:    "record_tie_456_1",
+		}
+		session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+		mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+		mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+		mockService.On("AddPlayerToRecording", int64(123), int64(456), int64(1), true).Return(nil, service.ErrAlreadyPlaced).Once()
+		mockSender.On("Request", tgbotapi.NewCallbackWithAlert("cb_id", "Этому игроку место уже выбрано. Чтобы его поменять, нажмите на игрока (↕️).")).Return(nil, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "Send", mock.Anything)
+	})
+
+	t.Run("выбывший до подтверждения состава", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "cb_id",
+			From:    &tgbotapi.User{ID: 7},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+			Data:    "record_dnf_456_2",
+		}
+		session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7, LineupOpen: true}
+		mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+		mockService.On("CanControlRecording", session, int64(7)).Return(true, nil).Once()
+		mockService.On("AddDNFToRecording", int64(123), int64(456), int64(2)).Return(nil, service.ErrLineupOpen).Once()
+		mockSender.On("Request", tgbotapi.NewCallbackWithAlert("cb_id", "Сначала отметьте, кто играл, и нажмите «➡️ Далее».")).Return(nil, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "Send", mock.Anything)
+	})
+
+	t.Run("все места расставлены", func(t *testing.T) {
+		handler, mockService, mockSender, callback := setup("record_select_456_1", false)
+		// Последнего оставшегося сервис ставит на место сам
+		mockService.On("AddPlayerToRecording", int64(123), int64(456), int64(1), false).Return([]storage.SessionPlayer{
+			{Player: alice, Place: 1}, {Player: bob, Place: 2},
+		}, nil).Once()
+		mockService.On("GetRecordingLineup", int64(123), int64(456)).Return([]storage.Player{alice, bob}, nil).Once()
+		expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↕️ 1. Alice", "record_pick_456_1")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↕️ 2. Bob", "record_pick_456_2")),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "record_back_456"),
+				tgbotapi.NewInlineKeyboardButtonData("✅ Завершить", "record_finish_456"),
+				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "record_cancel_456"),
+			),
+		)
+		expectedText := "Порядок победителей:\n1. Alice\n2. Bob\n\nВсе места расставлены. Нажмите «✅ Завершить», чтобы сохранить игру."
+		mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleRecordCallback(context.Background(), callback)
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+}
+
+func TestHandleGameConfig(t *testing.T) {
+	chat := &tgbotapi.Chat{ID: 123, Type: "private"}
+	command := func(args string) *tgbotapi.Message {
+		text := "/gameconfig"
+		if args != "" {
+			text += " " + args
+		}
+		return &tgbotapi.Message{
+			Chat:     chat,
+			From:     &tgbotapi.User{ID: 7},
+			Text:     text,
+			Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/gameconfig")}},
+		}
+	}
+
+	t.Run("изменение максимума", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		updated := storage.GameConfig{MinPlayers: 2, MaxPlayers: 8, AutoPlaceLast: true}
+		mockService.On("GetGameConfig", int64(123)).Return(service.DefaultGameConfig, nil).Once()
+		mockService.On("SetGameConfig", int64(123), updated).Return(nil).Once()
+		mockSender.On("Send", tgbotapi.NewMessage(123, formatGameConfig(updated))).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleGameConfig(context.Background(), command("max 8"))
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("неверные настройки", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		mockService.On("GetGameConfig", int64(123)).Return(service.DefaultGameConfig, nil).Once()
+		mockService.On("SetGameConfig", int64(123), storage.GameConfig{MinPlayers: 7, MaxPlayers: 6, AutoPlaceLast: true}).Return(service.ErrInvalidGameConfig).Once()
+		mockSender.On("Send", tgbotapi.NewMessage(123, "В игре может быть от 2 до 10 игроков, и минимум не может быть больше максимума.")).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleGameConfig(context.Background(), command("min 7"))
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("неизвестная настройка", func(t *testing.T) {
+		mockService := new(MockGameService)
+		mockSender := new(MockMessageSender)
+		handler := NewHandler(mockSender, mockService)
+
+		mockService.On("GetGameConfig", int64(123)).Return(service.DefaultGameConfig, nil).Once()
+		mockSender.On("Send", tgbotapi.NewMessage(123, "Использование: /gameconfig [min <число> | max <число> | autolast on|off]")).Return(tgbotapi.Message{}, nil).Once()
+
+		handler.HandleGameConfig(context.Background(), command("autolast maybe"))
+
+		mockService.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+}
+
+func TestFormatGameResults_DNF(t *testing.T) {
+	game := &storage.Game{Results: []storage.GameResult{
+		{Player: storage.Player{DisplayName: "Alice"}, Place: 1, Points: 2},
+		{Player: storage.Player{DisplayName: "Bob"}, Place: 2, Points: 1},
+		{Player: storage.Player{DisplayName: "Вася"}, Place: 3, Points: -1, DNF: true},
+		{Player: storage.Player{DisplayName: "Петя"}, Place: 3, Points: -1, DNF: true},
+	}}
+	want := "1. Alice — +2\n2. Bob — +1\n🚪 Вася, Петя — -1\n"
+	if got := formatGameResults(game); got != want {
+		t.Errorf("formatGameResults() = %q, ожидалось %q", got, want)
+	}
+}
+
+func TestFormatGameResults_Ties(t *testing.T) {
+	game := &storage.Game{Results: []storage.GameResult{
+		{Player: storage.Player{DisplayName: "Alice"}, Place: 1, Points: 4},
+		{Player: storage.Player{DisplayName: "Вася"}, Place: 2, Points: 3},
+		{Player: storage.Player{DisplayName: "Петя"}, Place: 2, Points: 3},
+		{Player: storage.Player{DisplayName: "Dave"}, Place: 4, Points: 1},
+	}}
+	want := "1. Alice — +4\n2–3. Вася, Петя — +3\n4. Dave — +1\n"
+	if got := formatGameResults(game); got != want {
+		t.Errorf("formatGameResults() = %q, ожидалось %q", got, want)
+	}
+}
+
+func TestHandleRecordCallback_Forbidden(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	// Чужое нажатие получает подсказку и не меняет сессию
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_id",
+		From:    &tgbotapi.User{ID: 8},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+		Data:    "record_finish_456",
+	}
+	session := &storage.RecordingSession{ChatID: 123, MessageID: 456, OwnerTGID: 7}
+
+	mockService.On("GetRecordingSession", int64(123), int64(456)).Return(session, nil).Once()
+	mockService.On("CanControlRecording", session, int64(8)).Return(false, nil).Once()
+	mockSender.On("Request", tgbotapi.NewCallbackWithAlert("cb_id", "Эту запись ведет другой игрок 🙅")).Return(nil, nil).Once()
+
+	handler.HandleRecordCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+	mockService.AssertNotCalled(t, "FinishRecording", mock.Anything, mock.Anything)
+}
+
+func TestParseRecordCallback(t *testing.T) {
+	tests := []struct {
+		data      string
+		action    string
+		messageID int64
+		playerID  int64
+		otherID   int64
+		ok        bool
+	}{
+		{"record_select_501_2", "select", 501, 2, 0, true},
+		{"record_finish_501", "finish", 501, 0, 0, true},
+		{"record_swap_501_2_3", "swap", 501, 2, 3, true},
+		{"record_finish", "", 0, 0, 0, false},
+		{"record_select_x_2", "", 0, 0, 0, false},
+		{"record_swap_501_2_3_4", "", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		action, messageID, playerID, otherID, ok := parseRecordCallback(tt.data)
+		if action != tt.action || messageID != tt.messageID || playerID != tt.playerID || otherID != tt.otherID || ok != tt.ok {
+			t.Errorf("parseRecordCallback(%q) = %q, %d, %d, %d, %v, ожидалось %q, %d, %d, %d, %v",
+				tt.data, action, messageID, playerID, otherID, ok, tt.action, tt.messageID, tt.playerID, tt.otherID, tt.ok)
+		}
+	}
+	if data := recordCallbackData("remove", 501, 2); data != "record_remove_501_2" {
+		t.Errorf("recordCallbackData = %q", data)
+	}
+}
+
+func TestHandleGamesCallback(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_id",
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 456},
+		Data:    "games_page_5",
+	}
+	date := time.Date(2026, 10, 12, 18, 40, 0, 0, time.UTC)
+	games := []storage.Game{
+		{ID: 7, CreatedAt: date, Results: []storage.GameResult{
+			{Player: storage.Player{DisplayName: "Alice"}, Place: 1, Points: 2},
+			{Player: storage.Player{DisplayName: "Bob"}, Place: 2, Points: 1},
+		}},
+	}
+
+	mockSender.On("Request", mock.Anything).Return(nil, nil).Once()
+	mockService.On("ListGames", int64(123), 5, gamesPageSize).Return(games, 11, nil).Once()
+
+	expectedText := "📜 Игры 6–6 из 11:\n" +
+		"\n#7 · 12.10.2026 18:40\n1. Alice +2 · 2. Bob +1\n" +
+		"\nПодробнее об игре: /game <номер>"
+	expectedKeyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("◀️", "games_page_0"),
+		tgbotapi.NewInlineKeyboardButtonData("▶️", "games_page_6"),
+	))
+	mockSender.On("Send", tgbotapi.NewEditMessageTextAndMarkup(123, 456, expectedText, expectedKeyboard)).Return(tgbotapi.Message{}, nil).Once()
+
+	handler.HandleGamesCallback(context.Background(), callback)
+
+	mockService.AssertExpectations(t)
+	mockSender.AssertExpectations(t)
+}
+
+func TestHandleVs(t *testing.T) {
+	mockService := new(MockGameService)
+	mockSender := new(MockMessageSender)
+	handler := NewHandler(mockSender, mockService)
+
+	msg := &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{ID: 123},
+		From:     &tgbotapi.User{ID: 1},
+		Text:     "/vs @alice @Bob",
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 3}},
+	}
+	alice := storage.Player{TGID: 1, Username: "alice", DisplayName: "Alice"}
+	bob := storage.Player{TGID: 2, Username: "bob", DisplayName: "Bob"}
+
+	mockService.On("GetAllPlayers", int64(123)).Return([]storage.Player{alice, bob}, nil).Once()
+	mockService.On("GetHeadToHead", int64(123), int64(1), int64(2)).Return(&service.HeadToHead{
+		PlayerA: alice, PlayerB: bob,
+		Games: 5, WinsA: 3, WinsB: 2,
+		AvgPlaceDiff: 0.4,
+		PointsA:      6, PointsB: 3,
+		StreakLeader: 1, Streak: 2,
+	}, nil).Once()
+
+	expectedText := "⚔️ Alice vs Bob\n\n" +
+		"🎲 Общих игр: 5\n" +
+		"🏆 Выше соперника: Alice — 3, Bob — 2\n" +
+		"📍 Alice в среднем на 0.4 места выше\n" +
+		"💰 Очков отобрано: Alice — 6, Bob — 3\n" +
+		"🔥 Alice выше в последних 2 встречах подряд\n"
+	mockSender.On("Send", tgbotapi.NewMessage(123, expectedText)).Return(tgbotapi.Message{}, nil).Once()
 
-	handler.HandleRecordCallback(callback)
+	handler.HandleVs(context.Background(), msg)
 
 	mockService.AssertExpectations(t)
 	mockSender.AssertExpectations(t)
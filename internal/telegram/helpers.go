@@ -1,9 +1,13 @@
 package telegram
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashakosti/Go_Bot_Svintus/internal/storage"
 )
 
 func sendMessage(bot MessageSender, msg tgbotapi.Chattable) {
@@ -12,6 +16,34 @@ func sendMessage(bot MessageSender, msg tgbotapi.Chattable) {
 	}
 }
 
+// answerCallback отвечает на нажатие кнопки, чтобы у нее пропал индикатор загрузки.
+func answerCallback(bot MessageSender, callback tgbotapi.CallbackConfig) {
+	if _, err := bot.Request(callback); err != nil {
+		log.Printf("Failed to send callback request: %v", err)
+	}
+}
+
+// isChatAdmin проверяет, является ли пользователь администратором чата.
+// В личной переписке с ботом пользователь считается администратором.
+func isChatAdmin(bot MessageSender, chat *tgbotapi.Chat, userID int64) bool {
+	if chat.IsPrivate() {
+		return true
+	}
+	resp, err := bot.Request(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: userID},
+	})
+	if err != nil || resp == nil {
+		log.Printf("Failed to get chat member %d in chat %d: %v", userID, chat.ID, err)
+		return false
+	}
+	var member tgbotapi.ChatMember
+	if err := json.Unmarshal(resp.Result, &member); err != nil {
+		log.Printf("Failed to decode chat member: %v", err)
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
+
 // Pluralize возвращает правильную форму слова в зависимости от числа.
 func Pluralize(count int, forms [3]string) string {
 	if count%10 == 1 && count%100 != 11 {
@@ -22,3 +54,55 @@ func Pluralize(count int, forms [3]string) string {
 	}
 	return forms[2]
 }
+
+// groupByPlace разбивает упорядоченные по месту элементы на группы игроков, деливших одно место.
+func groupByPlace[T any](items []T, place func(T) int) [][]T {
+	var groups [][]T
+	for i, item := range items {
+		if i > 0 && place(item) == place(items[i-1]) {
+			groups[len(groups)-1] = append(groups[len(groups)-1], item)
+			continue
+		}
+		groups = append(groups, []T{item})
+	}
+	return groups
+}
+
+func resultPlace(r storage.GameResult) int     { return r.Place }
+func sessionPlace(p storage.SessionPlayer) int { return p.Place }
+
+// resultGroupLine возвращает строку группы результатов с местом; выбывшие показываются без места.
+func resultGroupLine(group []storage.GameResult) string {
+	if group[0].DNF {
+		return "🚪 " + strings.Join(resultNames(group), ", ")
+	}
+	return placeLine(group[0].Place, resultNames(group))
+}
+
+// countFinished возвращает число доигравших игроков сессии.
+func countFinished(players []storage.SessionPlayer) int {
+	finished := 0
+	for _, p := range players {
+		if !p.DNF {
+			finished++
+		}
+	}
+	return finished
+}
+
+// resultNames возвращает имена игроков группы результатов.
+func resultNames(group []storage.GameResult) []string {
+	names := make([]string, len(group))
+	for i, r := range group {
+		names[i] = r.Player.DisplayName
+	}
+	return names
+}
+
+// placeLine возвращает место и имена: "1. Вася" или "2–3. Вася, Петя" для игроков, деливших место.
+func placeLine(place int, names []string) string {
+	if len(names) > 1 {
+		return fmt.Sprintf("%d–%d. %s", place, place+len(names)-1, strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("%d. %s", place, strings.Join(names, ", "))
+}
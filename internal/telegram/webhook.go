@@ -0,0 +1,126 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretTokenHeader - заголовок, в котором Telegram присылает секрет вебхука.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// secretTokenPattern - допустимые символы секрета по документации Bot API.
+var secretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// WebhookConfig - настройки режима вебхука.
+type WebhookConfig struct {
+	// Listen - адрес HTTP-сервера, например ":8080".
+	Listen string
+	// Path - секретный путь, на который приходят обновления, например "/telegram/3f9a...".
+	Path string
+	// Secret - значение заголовка X-Telegram-Bot-Api-Secret-Token.
+	Secret string
+	// URL - публичный адрес бота за прокси, например "https://bot.example.com".
+	// Если задан, вебхук регистрируется в Telegram при запуске; иначе его нужно зарегистрировать самостоятельно.
+	URL string
+}
+
+// Validate проверяет, что настроек достаточно для запуска вебхука.
+func (c WebhookConfig) Validate() error {
+	if !strings.HasPrefix(c.Path, "/") || len(c.Path) < 2 {
+		return fmt.Errorf("webhook path must start with / and not be empty, got %q", c.Path)
+	}
+	if !secretTokenPattern.MatchString(c.Secret) {
+		return errors.New("webhook secret must be 1-256 characters A-Z, a-z, 0-9, _ or -")
+	}
+	return nil
+}
+
+// NewWebhookHandler возвращает HTTP-обработчик, который принимает обновления от Telegram,
+// проверяет секрет и передает обновления в updates.
+func NewWebhookHandler(secret string, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+		if r.Context().Err() != nil {
+			// Бот останавливается - пусть Telegram пришлет обновление повторно
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			// Telegram не получит 200 и пришлет обновление повторно
+		}
+	})
+}
+
+// listenWebhook запускает HTTP-сервер вебхука и при необходимости регистрирует вебхук в Telegram.
+// Возвращает канал обновлений и функцию остановки сервера. Когда ctx отменен, запросы, ждущие
+// места в очереди, завершаются без ответа 200, и Telegram пришлет эти обновления повторно.
+// Канал закрывается, только если сервер успел остановиться и в него больше никто не пишет.
+func (b *Bot) listenWebhook(ctx context.Context, cfg WebhookConfig) (tgbotapi.UpdatesChannel, func(context.Context), error) {
+	if cfg.URL != "" {
+		params := tgbotapi.Params{
+			"url":          strings.TrimSuffix(cfg.URL, "/") + cfg.Path,
+			"secret_token": cfg.Secret,
+		}
+		if _, err := b.bot.MakeRequest("setWebhook", params); err != nil {
+			return nil, nil, fmt.Errorf("failed to set webhook: %w", err)
+		}
+		log.Printf("Webhook registered at %s", cfg.URL)
+	}
+
+	updates := make(chan tgbotapi.Update, b.bot.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, NewWebhookHandler(cfg.Secret, updates))
+
+	server := &http.Server{
+		Addr:        cfg.Listen,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("webhook server failed: %v", err)
+		}
+	}()
+	log.Printf("Webhook server listening on %s", cfg.Listen)
+
+	stop := func(ctx context.Context) {
+		if err := server.Shutdown(ctx); err != nil {
+			// Какие-то запросы еще обрабатываются и могут писать в updates, поэтому канал
+			// не закрываем: они завершатся сами, ведь ctx сервера уже отменен.
+			log.Printf("Webhook server shutdown: %v", err)
+			server.Close()
+			return
+		}
+		close(updates)
+	}
+	return updates, stop, nil
+}
@@ -0,0 +1,84 @@
+package telegram
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	body, err := os.ReadFile("testdata/update_join.json")
+	if err != nil {
+		t.Fatalf("failed to read recorded update: %v", err)
+	}
+
+	t.Run("валидный секрет", func(t *testing.T) {
+		updates := make(chan tgbotapi.Update, 1)
+		req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+		req.Header.Set(secretTokenHeader, "s3cret")
+		rec := httptest.NewRecorder()
+
+		NewWebhookHandler("s3cret", updates).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ожидался код 200, получен %d", rec.Code)
+		}
+		select {
+		case update := <-updates:
+			if update.UpdateID != 815000123 || update.Message.Command() != "join" || update.Message.Chat.ID != -100123 {
+				t.Errorf("обновление разобрано неверно: %+v", update)
+			}
+		default:
+			t.Fatal("обновление не передано в канал")
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		code   int
+	}{
+		{"неверный секрет", http.MethodPost, "wrong", string(body), http.StatusForbidden},
+		{"без секрета", http.MethodPost, "", string(body), http.StatusForbidden},
+		{"не POST", http.MethodGet, "s3cret", "", http.StatusMethodNotAllowed},
+		{"битый JSON", http.MethodPost, "s3cret", "{", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan tgbotapi.Update, 1)
+			req := httptest.NewRequest(tt.method, "/hook", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(secretTokenHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+
+			NewWebhookHandler("s3cret", updates).ServeHTTP(rec, req)
+
+			if rec.Code != tt.code {
+				t.Errorf("ожидался код %d, получен %d", tt.code, rec.Code)
+			}
+			if len(updates) != 0 {
+				t.Error("обновление не должно передаваться дальше")
+			}
+		})
+	}
+}
+
+func TestWebhookConfig_Validate(t *testing.T) {
+	if err := (WebhookConfig{Path: "/hook", Secret: "abc_DEF-123"}).Validate(); err != nil {
+		t.Errorf("неожиданная ошибка: %v", err)
+	}
+	if err := (WebhookConfig{Path: "hook", Secret: "abc"}).Validate(); err == nil {
+		t.Error("ожидалась ошибка для пути без /")
+	}
+	if err := (WebhookConfig{Path: "/hook", Secret: "with space"}).Validate(); err == nil {
+		t.Error("ожидалась ошибка для секрета с недопустимыми символами")
+	}
+}
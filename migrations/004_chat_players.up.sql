@@ -0,0 +1,21 @@
+-- Участие игроков в чатах: у каждого игрока свой счёт в каждом чате.
+CREATE TABLE IF NOT EXISTS chat_players (
+    chat_id BIGINT NOT NULL,
+    player_tg_id BIGINT NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    score INT NOT NULL DEFAULT 0,
+    joined_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (chat_id, player_tg_id)
+);
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS chat_id BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS games_chat_id_idx ON games (chat_id);
+
+-- Существующие данные переносим в чат по умолчанию (chat_id = 0).
+-- Чтобы привязать их к реальной группе, достаточно выполнить
+-- UPDATE chat_players SET chat_id = <id> WHERE chat_id = 0;
+-- UPDATE games SET chat_id = <id> WHERE chat_id = 0;
+INSERT INTO chat_players (chat_id, player_tg_id, score)
+SELECT 0, tg_id, COALESCE(score, 0) FROM players
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE players DROP COLUMN IF EXISTS score;
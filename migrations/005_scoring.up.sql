@@ -0,0 +1,8 @@
+-- Настройки чата: выбранная стратегия подсчёта очков.
+CREATE TABLE IF NOT EXISTS chat_settings (
+    chat_id BIGINT PRIMARY KEY,
+    scoring TEXT NOT NULL DEFAULT 'linear'
+);
+
+-- Стратегия сохраняется вместе с игрой, чтобы старые результаты можно было объяснить.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS scoring TEXT NOT NULL DEFAULT 'linear';
@@ -0,0 +1,14 @@
+-- Рейтинг Эло игрока в чате и история его изменений по играм.
+ALTER TABLE chat_players ADD COLUMN IF NOT EXISTS rating DOUBLE PRECISION NOT NULL DEFAULT 1500;
+
+CREATE TABLE IF NOT EXISTS rating_history (
+    id SERIAL PRIMARY KEY,
+    game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    chat_id BIGINT NOT NULL,
+    player_tg_id BIGINT NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    rating_before DOUBLE PRECISION NOT NULL,
+    rating_after DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS rating_history_player_idx ON rating_history (chat_id, player_tg_id, game_id);
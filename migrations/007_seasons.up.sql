@@ -0,0 +1,23 @@
+-- Сезоны чата. Одновременно в чате может быть только один незавершенный сезон.
+CREATE TABLE IF NOT EXISTS seasons (
+    id SERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    name TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at TIMESTAMPTZ,
+    UNIQUE (chat_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS seasons_active_idx ON seasons (chat_id) WHERE ended_at IS NULL;
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS season_id INT REFERENCES seasons(id) ON DELETE SET NULL;
+
+-- Итоговая таблица сезона, сохраняется при его завершении.
+CREATE TABLE IF NOT EXISTS season_standings (
+    season_id INT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    player_tg_id BIGINT NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INT NOT NULL,
+    score INT NOT NULL,
+    games INT NOT NULL,
+    PRIMARY KEY (season_id, player_tg_id)
+);
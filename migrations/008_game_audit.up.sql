@@ -0,0 +1,13 @@
+-- Журнал изменений записанных игр: кто и когда отменил или изменил игру.
+-- Ссылки на games нет: отмененная игра удаляется, а запись в журнале остается.
+CREATE TABLE IF NOT EXISTS game_audit (
+    id SERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    game_id INT NOT NULL,
+    action TEXT NOT NULL,
+    actor_tg_id BIGINT NOT NULL,
+    details JSONB,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS game_audit_game_idx ON game_audit (chat_id, game_id);
@@ -0,0 +1,14 @@
+-- Предыдущие версии мест и очков игры, сохраняются при каждом редактировании.
+CREATE TABLE IF NOT EXISTS game_result_versions (
+    game_id INT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    player_tg_id BIGINT NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INT NOT NULL,
+    points INT NOT NULL,
+    edited_by BIGINT NOT NULL,
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (game_id, version, player_tg_id)
+);
+
+-- Сессия записи может редактировать уже сохраненную игру.
+ALTER TABLE IF EXISTS recording_sessions ADD COLUMN IF NOT EXISTS edit_game_id INT;
@@ -0,0 +1,51 @@
+-- Приводим схему к тому, что использует код.
+-- 1. game_results: в коде игрок - user_id, а очки хранятся вместе с местом (place, points).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'game_results' AND column_name = 'player_id') THEN
+        ALTER TABLE game_results RENAME COLUMN player_id TO user_id;
+    END IF;
+END $$;
+
+ALTER TABLE game_results ADD COLUMN IF NOT EXISTS place INT;
+ALTER TABLE game_results ADD COLUMN IF NOT EXISTS points INT;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'game_results' AND column_name = 'score_change') THEN
+        UPDATE game_results SET points = score_change WHERE points IS NULL;
+        ALTER TABLE game_results DROP COLUMN score_change;
+    END IF;
+END $$;
+
+-- Для старых результатов без места восстанавливаем его по очкам внутри игры.
+UPDATE game_results r
+SET place = ranked.place
+FROM (
+    SELECT id, RANK() OVER (PARTITION BY game_id ORDER BY points DESC) AS place
+    FROM game_results
+) ranked
+WHERE r.id = ranked.id AND r.place IS NULL;
+
+UPDATE game_results SET points = 0 WHERE points IS NULL;
+ALTER TABLE game_results ALTER COLUMN place SET NOT NULL;
+ALTER TABLE game_results ALTER COLUMN points SET NOT NULL;
+CREATE INDEX IF NOT EXISTS game_results_game_idx ON game_results (game_id);
+
+-- 2. Сессии записи игры (выбор игроков кнопками), раньше не создавались ни одной миграцией.
+CREATE TABLE IF NOT EXISTS recording_sessions (
+    chat_id BIGINT PRIMARY KEY,
+    message_id BIGINT NOT NULL,
+    edit_game_id INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE recording_sessions ADD COLUMN IF NOT EXISTS edit_game_id INT;
+
+CREATE TABLE IF NOT EXISTS session_players (
+    session_chat_id BIGINT NOT NULL REFERENCES recording_sessions(chat_id) ON DELETE CASCADE,
+    player_tg_id BIGINT NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INT NOT NULL,
+    PRIMARY KEY (session_chat_id, player_tg_id)
+);
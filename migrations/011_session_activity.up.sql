@@ -0,0 +1,4 @@
+-- Время последнего действия в сессии записи: по нему истекают брошенные сессии.
+ALTER TABLE recording_sessions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+UPDATE recording_sessions SET updated_at = created_at;
+CREATE INDEX IF NOT EXISTS recording_sessions_updated_idx ON recording_sessions (updated_at);
@@ -0,0 +1,5 @@
+-- Статус результата: finished - игрок доиграл, dnf - выбыл, не доиграв. Выбывшие не занимают
+-- места среди доигравших и получают штраф вместо очков.
+ALTER TABLE game_results ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'finished';
+ALTER TABLE game_result_versions ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'finished';
+ALTER TABLE session_players ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'finished';
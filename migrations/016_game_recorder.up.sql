@@ -0,0 +1,3 @@
+-- Кто записал игру: кроме администраторов, отменить ее кнопкой под результатами может только он.
+-- 0 - игра записана до появления колонки или без сессии записи.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS recorded_by BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+// Package migrations содержит SQL-миграции схемы базы. Они встроены в бинарник
+// и применяются при запуске (см. storage.Migrate).
+package migrations
+
+import "embed"
+
+// FS - файлы миграций PostgreSQL вида NNN_name.up.sql.
+//
+//go:embed *.up.sql
+var FS embed.FS
+
+// SQLiteFS - миграции SQLite-хранилища, в каталоге sqlite/ (см. sqlite.Store.Migrate).
+//
+//go:embed sqlite/*.up.sql
+var SQLiteFS embed.FS
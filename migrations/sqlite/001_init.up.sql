@@ -0,0 +1,108 @@
+-- Схема SQLite-хранилища. Таблицы и колонки те же, что в PostgreSQL,
+-- время хранится в микросекундах Unix (INTEGER).
+CREATE TABLE players (
+    tg_id INTEGER PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT '',
+    display_name TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE chat_players (
+    chat_id INTEGER NOT NULL,
+    player_tg_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    score INTEGER NOT NULL DEFAULT 0,
+    rating REAL NOT NULL DEFAULT 1500,
+    joined_at INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, player_tg_id)
+);
+
+CREATE TABLE chat_settings (
+    chat_id INTEGER PRIMARY KEY,
+    scoring TEXT NOT NULL DEFAULT 'linear'
+);
+
+-- Одновременно в чате может быть только один незавершенный сезон.
+CREATE TABLE seasons (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    started_at INTEGER NOT NULL,
+    ended_at INTEGER,
+    UNIQUE (chat_id, name)
+);
+CREATE UNIQUE INDEX seasons_active_idx ON seasons (chat_id) WHERE ended_at IS NULL;
+
+-- AUTOINCREMENT: ID удаленных игр не используются повторно, как у SERIAL.
+CREATE TABLE games (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    scoring TEXT NOT NULL DEFAULT 'linear',
+    season_id INTEGER REFERENCES seasons(id) ON DELETE SET NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX games_chat_id_idx ON games (chat_id);
+
+CREATE TABLE game_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INTEGER NOT NULL,
+    points INTEGER NOT NULL
+);
+CREATE INDEX game_results_game_idx ON game_results (game_id);
+
+CREATE TABLE rating_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    chat_id INTEGER NOT NULL,
+    player_tg_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    rating_before REAL NOT NULL,
+    rating_after REAL NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX rating_history_player_idx ON rating_history (chat_id, player_tg_id, game_id);
+
+CREATE TABLE season_standings (
+    season_id INTEGER NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    player_tg_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INTEGER NOT NULL,
+    score INTEGER NOT NULL,
+    games INTEGER NOT NULL,
+    PRIMARY KEY (season_id, player_tg_id)
+);
+
+-- Ссылки на games нет: отмененная игра удаляется, а запись в журнале остается.
+CREATE TABLE game_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    game_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor_tg_id INTEGER NOT NULL,
+    details TEXT,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX game_audit_game_idx ON game_audit (chat_id, game_id);
+
+CREATE TABLE game_result_versions (
+    game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    player_tg_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INTEGER NOT NULL,
+    points INTEGER NOT NULL,
+    edited_by INTEGER NOT NULL,
+    edited_at INTEGER NOT NULL,
+    PRIMARY KEY (game_id, version, player_tg_id)
+);
+
+CREATE TABLE recording_sessions (
+    chat_id INTEGER PRIMARY KEY,
+    message_id INTEGER NOT NULL,
+    edit_game_id INTEGER,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE session_players (
+    session_chat_id INTEGER NOT NULL REFERENCES recording_sessions(chat_id) ON DELETE CASCADE,
+    player_tg_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INTEGER NOT NULL,
+    PRIMARY KEY (session_chat_id, player_tg_id)
+);
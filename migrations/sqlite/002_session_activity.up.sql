@@ -0,0 +1,4 @@
+-- Время последнего действия в сессии записи: по нему истекают брошенные сессии.
+ALTER TABLE recording_sessions ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+UPDATE recording_sessions SET updated_at = created_at;
+CREATE INDEX recording_sessions_updated_idx ON recording_sessions (updated_at);
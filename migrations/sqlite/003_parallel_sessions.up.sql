@@ -0,0 +1,23 @@
+-- Несколько сессий записи в одном чате: сессия определяется чатом и сообщением с ее клавиатурой.
+-- Сессии - временные данные, поэтому таблицы пересоздаются; незавершенные записи придется начать заново.
+DROP TABLE session_players;
+DROP TABLE recording_sessions;
+
+CREATE TABLE recording_sessions (
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    edit_game_id INTEGER,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, message_id)
+);
+CREATE INDEX recording_sessions_updated_idx ON recording_sessions (updated_at);
+
+CREATE TABLE session_players (
+    session_chat_id INTEGER NOT NULL,
+    session_message_id INTEGER NOT NULL,
+    player_tg_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    place INTEGER NOT NULL,
+    PRIMARY KEY (session_chat_id, session_message_id, player_tg_id),
+    FOREIGN KEY (session_chat_id, session_message_id) REFERENCES recording_sessions (chat_id, message_id) ON DELETE CASCADE
+);
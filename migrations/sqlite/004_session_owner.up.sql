@@ -0,0 +1,2 @@
+-- Кто начал сессию записи: по умолчанию кнопки ее клавиатуры может нажимать только он (и выбранные игроки).
+ALTER TABLE recording_sessions ADD COLUMN owner_tg_id INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,17 @@
+-- Настройки игры чата: сколько игроков может быть в игре и ставить ли последнего
+-- оставшегося участника на последнее место автоматически. NULL - настройки по умолчанию.
+ALTER TABLE chat_settings ADD COLUMN min_players INTEGER;
+ALTER TABLE chat_settings ADD COLUMN max_players INTEGER;
+ALTER TABLE chat_settings ADD COLUMN auto_place_last INTEGER;
+
+-- Состав игры: запись начинается с вопроса, кто играл, и места выбираются только среди них.
+-- lineup_open - состав еще набирается; у сессий редактирования и старых сессий его нет.
+ALTER TABLE recording_sessions ADD COLUMN lineup_open INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE session_lineup (
+    session_chat_id INTEGER NOT NULL,
+    session_message_id INTEGER NOT NULL,
+    player_tg_id INTEGER NOT NULL REFERENCES players(tg_id) ON DELETE CASCADE,
+    PRIMARY KEY (session_chat_id, session_message_id, player_tg_id),
+    FOREIGN KEY (session_chat_id, session_message_id) REFERENCES recording_sessions (chat_id, message_id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- Порядок выбора игроков в сессии записи: кнопка "⬅️ Назад" убирает последнего выбранного,
+-- а не игрока на последнем месте. 0 - игрок выбран до появления колонки.
+ALTER TABLE session_players ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;